@@ -7,6 +7,7 @@ import (
 	api "gf_api/internal/controller/api"
 	childsysdataapi "gf_api/internal/controller/client3.0_api/child_sys_data_api"
 	childsysnumber "gf_api/internal/controller/client3.0_api/child_sys_number_api"
+	commandapi "gf_api/internal/controller/command_api"
 	configapi "gf_api/internal/controller/config_api"
 	controlsysapi "gf_api/internal/controller/client3.0_api/control_sys_api"
 	gethikdataapi "gf_api/internal/controller/client3.0_api/get_hik_data_api"
@@ -14,6 +15,9 @@ import (
 	getstationnoteapi "gf_api/internal/controller/client3.0_api/get_station_note_api"
 	getsyslogapi "gf_api/internal/controller/client3.0_api/get_sys_log_api"
 	gettimeapi "gf_api/internal/controller/client3.0_api/get_time_api"
+	"gf_api/internal/controller/middleware"
+	notifyapi "gf_api/internal/controller/notify_api"
+	"gf_api/internal/logic"
 
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/net/ghttp"
@@ -27,12 +31,33 @@ var (
 		Usage: "main",
 		Brief: "启动 HTTP 服务",
 		Func: func(ctx context.Context, parser *gcmd.Parser) (err error) {
+			// 表结构由 gf_api migrate 创建，启动时只检查有没有没执行的迁移
+			logic.WarnPendingMigrations(ctx)
+			// 台站模型缓存：启动时加载，后台定时和 keyspace 通知刷新
+			logic.StartModelCacheRefresher(ctx)
+			// 台站总览历史快照：定时写入 PostgreSQL，OverViewData 带 at 参数时查询
+			logic.StartOverviewHistory(ctx)
+			// 告警引擎：定时按规则评估 svr_DATA 的值，告警写入 PostgreSQL
+			logic.StartAlarmEngine(ctx)
+			// 通知：新产生或升级的告警、下发失败的控制命令按路由发送到 webhook、邮件或群机器人
+			logic.StartNotifier(ctx)
+			// 本地历史库：采样配置的工位号的 svr_DATA 写入 PostgreSQL，外部历史服务不可用时 DevHis 从这里取数
+			logic.StartHistorian(ctx)
+			// 控制命令：IssueOperateNew 受理的命令由后台按顺序转发，状态写入 PostgreSQL
+			logic.StartCommandDispatcher(ctx)
+			// 定时控制命令：到期的定时和周期任务按 IssueOperateNew 相同的流程写入命令队列
+			logic.StartCommandScheduler(ctx)
+
 			s := g.Server()
 			// 注册路由组
 			s.Group("/api", func(group *ghttp.RouterGroup) {
 				//鉴权中间件，为/api所有路由添加。测试阶段先不用
+				//控制命令下发、审批和定时任务的修改在各自的 Register 中单独加了鉴权
 				//group.Middleware(ghttp.MiddlewareHandlerResponse, middleware.AuthMiddleware)
 
+				// GET 响应加 ETag、支持 If-None-Match 返回 304 和 gzip 压缩，台站客户端轮询时省流量
+				group.Middleware(middleware.ConditionalMiddleware)
+
 				// Basic 相关接口
 				gettimeapi.Register(group)
 				childsysnumber.Register(group)
@@ -46,6 +71,10 @@ var (
 				gethikdataapi.Register(group)
 				getsyslogapi.Register(group)
 				controlsysapi.Register(group)
+				commandapi.Register(group)
+
+				// Admin 管理接口
+				notifyapi.Register(group)
 
 				// Config 相关接口（配置管理）
 				configapi.Register(group)
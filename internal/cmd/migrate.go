@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gcmd"
+)
+
+// Migrate 执行 manifest/sql 下没有执行过的数据库迁移，见 logic.Migrate
+var Migrate = gcmd.Command{
+	Name:  "migrate",
+	Usage: "migrate [-dir manifest/sql]",
+	Brief: "执行数据库迁移",
+	Arguments: []gcmd.Argument{
+		{Name: "dir", Short: "d", Brief: "迁移文件目录，默认取 database.migrations（manifest/sql）"},
+	},
+	Func: func(ctx context.Context, parser *gcmd.Parser) error {
+		dir := parser.GetOpt("dir", logic.MigrationsDir(ctx)).String()
+		done, err := logic.Migrate(ctx, dir)
+		for _, m := range done {
+			g.Log().Infof(ctx, "已执行迁移 %s", m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			g.Log().Info(ctx, "数据库已是最新，没有需要执行的迁移")
+		}
+		return nil
+	},
+}
+
+func init() {
+	if err := Main.AddCommand(&Migrate); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/os/gcmd"
+)
+
+// Validate 检查台站模型一致性，例如：
+//
+//	gf_api validate
+//	gf_api validate -stationIds=0101,0102 -output=report.json -strict
+var Validate = gcmd.Command{
+	Name:  "validate",
+	Usage: "validate [-stationIds=0101,0102] [-output=report.json] [-strict]",
+	Brief: "检查台站模型：缺失的模型ID、parno、关联工位号，station_node 的父节点环和重名节点",
+	Arguments: []gcmd.Argument{
+		{Name: "stationIds", Short: "s", Brief: "逗号分隔的台站ID，不填检查所有台站"},
+		{Name: "output", Short: "o", Brief: "完整报告写入的 JSON 文件，不填只输出汇总"},
+		{Name: "strict", Orphan: true, Brief: "发现问题时以非0状态退出"},
+	},
+	Func: func(ctx context.Context, parser *gcmd.Parser) (err error) {
+		var stationIds []string
+		for _, id := range strings.Split(parser.GetOpt("stationIds").String(), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				stationIds = append(stationIds, id)
+			}
+		}
+
+		report, err := logic.ValidateStations(ctx, stationIds)
+		if err != nil {
+			return err
+		}
+
+		for _, res := range report.Results {
+			for _, msg := range res.Errors {
+				fmt.Printf("[%s] 检查出错: %s\n", res.StationId, msg)
+			}
+			for _, issue := range res.Issues {
+				where := issue.Path
+				if issue.NodeId != 0 {
+					where = fmt.Sprintf("%s#%d", where, issue.NodeId)
+				}
+				fmt.Printf("[%s] %s %s %s: %s\n", res.StationId, issue.Source, issue.Kind, where, issue.Message)
+			}
+		}
+		fmt.Printf("共检查 %d 个台站，发现 %d 个问题 %v\n", report.Stations, report.IssueCount, report.Counts)
+
+		if output := parser.GetOpt("output").String(); output != "" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(output, data, 0o644); err != nil {
+				return fmt.Errorf("写入报告失败: %w", err)
+			}
+			fmt.Printf("完整报告已写入 %s\n", output)
+		}
+
+		if parser.GetOpt("strict") != nil && report.IssueCount > 0 {
+			return fmt.Errorf("发现 %d 个台站模型问题", report.IssueCount)
+		}
+		return nil
+	},
+}
+
+func init() {
+	if err := Main.AddCommand(&Validate); err != nil {
+		panic(err)
+	}
+}
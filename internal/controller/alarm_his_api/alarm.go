@@ -3,16 +3,34 @@ package alarmhisapi
 // 设备历史数据接口 - 调用外部服务获取设备历史记录
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gf_api/internal/controller/middleware"
+	"gf_api/internal/logic"
 	"gf_api/internal/service"
 
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gogf/gf/v2/os/gtime"
 )
 
 // Register 把当前模块的所有路由注册到 group
 func Register(group *ghttp.RouterGroup) {
 	group.GET("/DevHis", GetDevHis)
-	group.GET("/Resource/AlarmHis", GetAlarmHis) // 该接口依赖方待定
+	group.GET("/Resource/AlarmHis", GetAlarmHis)
+	group.GET("/Resource/AlarmActive", GetAlarmActive)
+	group.GET("/Resource/AlarmGroups", GetAlarmGroups)
+	group.GET("/Resource/AlarmActions", GetAlarmActions)
+	// 告警操作必须鉴权：操作人取鉴权上下文中的用户
+	group.Group("/", func(group *ghttp.RouterGroup) {
+		group.Middleware(middleware.AuthMiddleware)
+		group.POST("/Resource/AlarmAck", AckAlarm)
+		group.POST("/Resource/AlarmComment", CommentAlarm)
+		group.POST("/Resource/AlarmShelve", ShelveAlarm)
+		group.POST("/Resource/AlarmUnshelve", UnshelveAlarm)
+	})
 }
 
 // GetDevHis 获取设备历史数据
@@ -49,16 +67,43 @@ func GetDevHis(r *ghttp.Request) {
 		return
 	}
 
+	// 数据来源：不指定时用外部服务，外部服务不可达时回退到本地历史库
+	source := r.Get("source").String()
+	if source != "" && source != service.HisSourceExternal && source != service.HisSourceLocal {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": "参数 source 只能是 external 或 local",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 带 interval 时按间隔聚合，返回图表序列
+	if r.Get("interval").String() != "" {
+		getDevHisAggregated(ctx, r, positionId, beginTime, endTime, source)
+		return
+	}
+
 	// 获取可选的分页参数
 	pageIndex := r.Get("pageIndex", "1").Int()
 	pageSize := r.Get("pageSize", "20").Int()
 
+	if source == service.HisSourceLocal {
+		getDevHisLocal(ctx, r, positionId, beginTime, endTime, pageIndex, pageSize)
+		return
+	}
+
 	// 创建外部服务实例
 	externalService := service.NewExternalService(ctx)
 
 	// 调用外部服务
 	result, err := externalService.GetDevHis(ctx, positionId, beginTime, endTime, pageIndex, pageSize)
 	if err != nil {
+		// 外部服务不可达时改用本地历史库
+		if service.FallbackToLocal(source, err, g.Cfg().MustGet(ctx, "historian.fallback", true).Bool()) {
+			getDevHisLocal(ctx, r, positionId, beginTime, endTime, pageIndex, pageSize)
+			return
+		}
 		// 如果是业务错误响应（外部接口返回的错误），原样返回
 		if errorResponse, ok := err.(*service.BusinessError); ok {
 			r.Response.WriteJson(errorResponse.Response)
@@ -77,46 +122,225 @@ func GetDevHis(r *ghttp.Request) {
 	r.Response.WriteJson(result)
 }
 
-// GetAlarmHis 获取告警历史数据
-// 该接口用于获取资源告警历史记录，通过调用第三方接口进行数据透传
-// 注意：当前第三方接口还未确定，暂时返回模拟数据
-func GetAlarmHis(r *ghttp.Request) {
-	ctx := context.Background()
-	_ = ctx // 预留用于后续第三方接口调用
+// getDevHisLocal 从本地历史库分页返回原始采样
+func getDevHisLocal(ctx context.Context, r *ghttp.Request, positionId, beginTime, endTime string, pageIndex, pageSize int) {
+	begin, err := gtime.StrToTime(beginTime)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": "参数 beginTime 格式错误，应为 YYYY-MM-DD HH:mm:ss",
+			"data":    nil,
+		})
+		return
+	}
+	end, err := gtime.StrToTime(endTime)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": "参数 endTime 格式错误，应为 YYYY-MM-DD HH:mm:ss",
+			"data":    nil,
+		})
+		return
+	}
+	list, total, err := logic.QueryHistorianRaw(ctx, positionId, begin.Time, end.Time, pageIndex, pageSize)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    500,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data": g.Map{
+			"source":     service.HisSourceLocal,
+			"positionId": positionId,
+			"pageIndex":  pageIndex,
+			"pageSize":   pageSize,
+			"total":      total,
+			"list":       list,
+		},
+	})
+}
 
-	// 从URL参数中获取positionId（设备位置ID）
-	positionId := r.Get("positionId").String()
-	if positionId == "" {
+// getDevHisAggregated 聚合模式：服务端逐页拉取外部历史数据，按 interval 分桶计算 agg，positionId 可以逗号分隔多个
+func getDevHisAggregated(ctx context.Context, r *ghttp.Request, positionIds, beginTime, endTime, source string) {
+	interval, err := service.ParseHisInterval(r.Get("interval").String())
+	if err != nil {
 		r.Response.WriteJson(g.Map{
 			"code":    400,
-			"message": "缺少参数 positionId",
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	aggs, err := service.ParseHisAggs(r.Get("agg").String())
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": err.Error(),
 			"data":    nil,
 		})
 		return
 	}
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(positionIds, ",") {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if maxPositions := g.Cfg().MustGet(ctx, "external.hisDataService.devHis.maxPositions", 10).Int(); len(ids) > maxPositions {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": fmt.Sprintf("positionId 最多 %d 个", maxPositions),
+			"data":    nil,
+		})
+		return
+	}
+
+	externalService := service.NewExternalService(ctx)
+	result, err := externalService.AggregateDevHis(ctx, service.DevHisAggQuery{
+		PositionIds: ids,
+		BeginTime:   beginTime,
+		EndTime:     endTime,
+		Interval:    interval,
+		Aggs:        aggs,
+		Source:      source,
+	})
+	if err != nil {
+		if errorResponse, ok := err.(*service.BusinessError); ok {
+			r.Response.WriteJson(errorResponse.Response)
+			return
+		}
+		r.Response.WriteJson(g.Map{
+			"code":    500,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data": g.Map{
+			"interval":  r.Get("interval").String(),
+			"agg":       aggs,
+			"beginTime": beginTime,
+			"endTime":   endTime,
+			"series":    result.Series,
+			"positions": result.Positions,
+		},
+	})
+}
+
+// GetAlarmHis 获取告警历史数据
+// 默认从本地告警引擎写入的 alarm_event 表查询；alarm.history.source=external 时透传外部历史服务的结果。
+// external.hisDataService.baseURL 同时是 DevHis 的地址，不能用它来决定告警历史的来源。
+func GetAlarmHis(r *ghttp.Request) {
+	ctx := context.Background()
+
+	// 从URL参数中获取positionId（设备位置ID）
+	positionId := r.Get("positionId").String()
+	stationId := r.Get("stationId").String()
+	beginTime := r.Get("beginTime").String()
+	endTime := r.Get("endTime").String()
 
 	// 获取可选的分页参数
 	pageIndex := r.Get("pageIndex", "1").Int()
 	pageSize := r.Get("pageSize", "20").Int()
 
-	// TODO: 调用第三方接口获取告警历史数据
-	// 第三方接口地址和参数格式待确定，确定后需要：
-	// 1. 在 internal/service/external.go 中添加对应的调用方法（如 GetAlarmHis）
-	// 2. 创建外部服务实例：externalService := service.NewExternalService(ctx)
-	// 3. 调用外部服务：result, err := externalService.GetAlarmHis(ctx, positionId, pageIndex, pageSize)
-	// 4. 处理错误并透传返回结果
+	if g.Cfg().MustGet(ctx, "alarm.history.source", "local").String() == "external" {
+		if positionId == "" {
+			r.Response.WriteJson(g.Map{
+				"code":    400,
+				"message": "缺少参数 positionId",
+				"data":    nil,
+			})
+			return
+		}
+		externalService := service.NewExternalService(ctx)
+		result, err := externalService.GetAlarmHis(ctx, positionId, beginTime, endTime, pageIndex, pageSize)
+		if err != nil {
+			// 如果是业务错误响应（外部接口返回的错误），原样返回
+			if errorResponse, ok := err.(*service.BusinessError); ok {
+				r.Response.WriteJson(errorResponse.Response)
+				return
+			}
+			r.Response.WriteJson(g.Map{
+				"code":    500,
+				"message": err.Error(),
+				"data":    nil,
+			})
+			return
+		}
+		// 透传返回结果
+		r.Response.WriteJson(result)
+		return
+	}
 
-	// 临时返回模拟数据，待第三方接口确定后替换为实际调用
+	if positionId == "" && stationId == "" {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": "缺少参数 positionId 或 stationId",
+			"data":    nil,
+		})
+		return
+	}
+	query := logic.AlarmQuery{
+		PositionId: positionId,
+		StationId:  stationId,
+		RootKey:    r.Get("rootKey").String(),
+		Severity:   r.Get("severity").String(),
+		State:      r.Get("state").String(),
+		PageIndex:  pageIndex,
+		PageSize:   pageSize,
+	}
+	for _, t := range []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{
+		{"beginTime", beginTime, &query.Begin},
+		{"endTime", endTime, &query.End},
+	} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := gtime.StrToTime(t.value)
+		if err != nil {
+			r.Response.WriteJson(g.Map{
+				"code":    400,
+				"message": fmt.Sprintf("参数 %s 格式错误，应为 YYYY-MM-DD HH:mm:ss", t.name),
+				"data":    nil,
+			})
+			return
+		}
+		*t.dst = parsed.Time
+	}
+
+	list, total, err := logic.QueryAlarmHistory(ctx, query)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    500,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
 	r.Response.WriteJson(g.Map{
 		"code":    200,
 		"message": "success",
 		"data": g.Map{
 			"positionId": positionId,
-			"pageIndex":  pageIndex,
-			"pageSize":   pageSize,
-			"total":      0,
-			"list":       []interface{}{},
-			"note":       "该接口的第三方调用逻辑待实现，当前返回模拟数据",
+			"stationId":  stationId,
+			"pageIndex":  query.PageIndex,
+			"pageSize":   query.PageSize,
+			"total":      total,
+			"list":       list,
 		},
 	})
 }
@@ -0,0 +1,175 @@
+package alarmhisapi
+
+// 告警确认、备注、搁置接口，操作人取自 AuthMiddleware 写入的 userID
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gogf/gf/v2/os/gtime"
+)
+
+// alarmActionRequest 告警操作的请求体
+type alarmActionRequest struct {
+	UserId   string `json:"-"` // 鉴权上下文中的用户
+	Id       int64  `json:"id"`
+	Comment  string `json:"comment"`
+	Duration string `json:"duration"` // 搁置时长，如 30m、2h
+	Until    string `json:"until"`    // 搁置截止时间，格式 YYYY-MM-DD HH:mm:ss，优先于 duration
+}
+
+// GetAlarmActive 获取当前活动告警，默认不包含搁置中的告警
+func GetAlarmActive(r *ghttp.Request) {
+	list := logic.ActiveAlarms(r.Get("includeShelved").Bool())
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data": g.Map{
+			"total": len(list),
+			"list":  list,
+		},
+	})
+}
+
+// GetAlarmGroups 获取按根因分组的活动告警，一组显示为一个事件
+func GetAlarmGroups(r *ghttp.Request) {
+	groups := logic.ActiveAlarmGroups(r.Get("stationId").String(), r.Get("includeShelved").Bool())
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data": g.Map{
+			"total": len(groups),
+			"list":  groups,
+		},
+	})
+}
+
+// AckAlarm 确认告警
+func AckAlarm(r *ghttp.Request) {
+	req, ok := parseAlarmAction(r)
+	if !ok {
+		return
+	}
+	ev, err := logic.AckAlarm(r.GetCtx(), req.Id, req.UserId, req.Comment)
+	writeAlarmActionResult(r, ev, err)
+}
+
+// CommentAlarm 给告警加备注
+func CommentAlarm(r *ghttp.Request) {
+	req, ok := parseAlarmAction(r)
+	if !ok {
+		return
+	}
+	ev, err := logic.CommentAlarm(r.GetCtx(), req.Id, req.UserId, req.Comment)
+	writeAlarmActionResult(r, ev, err)
+}
+
+// ShelveAlarm 搁置告警到指定时间
+func ShelveAlarm(r *ghttp.Request) {
+	req, ok := parseAlarmAction(r)
+	if !ok {
+		return
+	}
+	var until time.Time
+	switch {
+	case req.Until != "":
+		t, err := gtime.StrToTime(req.Until)
+		if err != nil {
+			writeAlarmError(r, 400, "参数 until 格式错误，应为 YYYY-MM-DD HH:mm:ss")
+			return
+		}
+		until = t.Time
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			writeAlarmError(r, 400, "参数 duration 格式错误，如 30m、2h")
+			return
+		}
+		until = time.Now().Add(d)
+	default:
+		writeAlarmError(r, 400, "缺少参数 until 或 duration")
+		return
+	}
+	ev, err := logic.ShelveAlarm(r.GetCtx(), req.Id, req.UserId, until, req.Comment)
+	writeAlarmActionResult(r, ev, err)
+}
+
+// UnshelveAlarm 取消搁置
+func UnshelveAlarm(r *ghttp.Request) {
+	req, ok := parseAlarmAction(r)
+	if !ok {
+		return
+	}
+	ev, err := logic.UnshelveAlarm(r.GetCtx(), req.Id, req.UserId, req.Comment)
+	writeAlarmActionResult(r, ev, err)
+}
+
+// GetAlarmActions 获取告警的操作记录
+func GetAlarmActions(r *ghttp.Request) {
+	id := r.Get("id").Int64()
+	if id <= 0 {
+		writeAlarmError(r, 400, "缺少参数 id")
+		return
+	}
+	list, err := logic.AlarmActions(r.GetCtx(), id)
+	if err != nil {
+		writeAlarmError(r, 500, err.Error())
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data": g.Map{
+			"id":   id,
+			"list": list,
+		},
+	})
+}
+
+func parseAlarmAction(r *ghttp.Request) (*alarmActionRequest, bool) {
+	var req alarmActionRequest
+	if err := r.Parse(&req); err != nil {
+		writeAlarmError(r, 400, fmt.Sprintf("请求参数解析失败: %v", err))
+		return nil, false
+	}
+	if req.UserId = r.GetCtxVar("userID").String(); req.UserId == "" {
+		writeAlarmError(r, 401, "告警操作需要登录")
+		return nil, false
+	}
+	if req.Id <= 0 {
+		writeAlarmError(r, 400, "缺少参数 id")
+		return nil, false
+	}
+	return &req, true
+}
+
+func writeAlarmActionResult(r *ghttp.Request, ev *logic.AlarmEvent, err error) {
+	switch {
+	case err == nil:
+		r.Response.WriteJson(g.Map{
+			"code":    200,
+			"message": "success",
+			"data":    ev,
+		})
+	case errors.Is(err, logic.ErrAlarmInvalid):
+		writeAlarmError(r, 400, err.Error())
+	case errors.Is(err, logic.ErrAlarmNotFound):
+		writeAlarmError(r, 404, err.Error())
+	case errors.Is(err, logic.ErrAlarmTransition):
+		writeAlarmError(r, 409, err.Error())
+	default:
+		writeAlarmError(r, 500, err.Error())
+	}
+}
+
+func writeAlarmError(r *ghttp.Request, code int, message string) {
+	r.Response.WriteJson(g.Map{
+		"code":    code,
+		"message": message,
+		"data":    nil,
+	})
+}
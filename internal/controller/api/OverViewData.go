@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"gf_api/internal/controller/middleware"
 	"gf_api/internal/db"
+	"gf_api/internal/logic"
+	"gf_api/internal/model"
 	"math"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
 	_ "github.com/gogf/gf/contrib/drivers/pgsql/v2"
@@ -24,8 +26,17 @@ import (
 // Register 把当前模块的所有路由注册到 group
 func Register(group *ghttp.RouterGroup) {
 	group.GET("/Basic/OverViewData", GetOverViewData)
+	group.GET("/Basic/OverViewData/ws", GetOverViewDataWs)
+	group.GET("/Basic/OverViewDataBatch", GetOverViewDataBatch)
+	group.GET("/Basic/OverViewDiff", GetOverViewDiff)
+	group.GET("/Basic/OverViewExport", GetOverViewExport)
 	group.GET("/Basic/AllStation", GetAllStaitonInfo)
 	group.GET("/Basic/AllStationId", GetAllStationId)
+	// 一致性检查会扫描所有台站的模型和 svr_DATA_*，报告里有完整的模型错误，必须鉴权
+	group.Group("/", func(group *ghttp.RouterGroup) {
+		group.Middleware(middleware.AuthMiddleware)
+		group.GET("/Admin/StationModelValidate", GetStationModelValidate)
+	})
 }
 
 // 台站总览的结构体
@@ -63,6 +74,7 @@ var modelKeyMapping = map[string]string{
 // 必须先取所有台站信息数据列表得到 stationId, 接口：http://127.0.0.1:8001/api/Basic/AllStationId
 func GetOverViewDataOld(r *ghttp.Request) {
 	ctx := context.Background()
+	resolver := logic.CurrentResolver(ctx)
 
 	// Step 1. 请求 /api/Basic/AllStationId 获取 stationId 列表，只取第一个
 	allURL := "http://127.0.0.1:8001/api/Basic/AllStationId" // 建议写到 config.yaml
@@ -290,38 +302,8 @@ func GetOverViewDataOld(r *ghttp.Request) {
 							// 遍历 dynamic_model_id 下的每个属性（key:属性名，value:属性值）
 							for attrKey, attrVal := range dyn {
 								if attrObj, ok := attrVal.(map[string]any); ok {
-									// 提取 para_name、relation_parno、is_enable
-									//parno, _ := attrObj["parno"].(string)
-									relationParno, _ := attrObj["relation_parno"].(string)
-									isEnable := "0"                        //默认
-									if v, ok := attrObj["is_enable"]; ok { //is_enable这个字段不一定在redis中存在
-										switch vv := v.(type) {
-										case string:
-											isEnable = vv
-										case float64: // JSON 里数字默认是 float64
-											if vv == 1 {
-												isEnable = "1"
-											}
-										}
-									}
-									// fmt.Println("parno:", parno)
-									// fmt.Println("relation_parno:", relationParno)
-									// fmt.Println("is_enable:", isEnable)
-
-									// =============== 规则逻辑开始 ===============
-									// 设变量 Num = position_id，默认情况
-									num := nodeInfo.positionID
-
-									// 如果 relation_position_id 和 relation_parno 都有值 → Num = relation_position_id
-									if nodeInfo.relationPositionID != "" && relationParno != "" {
-										num = nodeInfo.relationPositionID
-									}
-
-									// 如果 is_enable = "1" → 强制 Num = position_id
-									if isEnable == "1" {
-										num = nodeInfo.positionID
-									}
-									// =============== 规则逻辑结束 ===============
+									// 按取值规则确定 Num（规则见 logic.AttributeResolver）
+									num := resolver.Locate(model.AttributeDynamic, attrObj, nodeInfo.positionID, nodeInfo.relationPositionID).PositionId
 
 									// 拼接 redis的key = svr_DATA_Num
 									redisKey := fmt.Sprintf("svr_DATA_%s", num)
@@ -413,37 +395,8 @@ func GetOverViewDataOld(r *ghttp.Request) {
 							// 遍历 setitem_model_id 下的每个属性（key:属性名，value:属性值）
 							for attrKey, attrVal := range set {
 								if attrObj, ok := attrVal.(map[string]any); ok {
-									// 提取 para_name、relation_parno、is_enable
-									relationParno, _ := attrObj["relation_parno"].(string)
-									isEnable := "0"                        //默认
-									if v, ok := attrObj["is_enable"]; ok { //is_enable这个字段不一定在redis中存在
-										switch vv := v.(type) {
-										case string:
-											isEnable = vv
-										case float64: // JSON 里数字默认是 float64
-											if vv == 1 {
-												isEnable = "1"
-											}
-										}
-									}
-									// fmt.Println("parno:", parno)
-									// fmt.Println("relation_parno:", relationParno)
-									// fmt.Println("is_enable:", isEnable)
-
-									// =============== 规则逻辑开始 ===============
-									// 设变量 Num = position_id，默认情况
-									num := nodeInfo.positionID
-
-									// 如果 relation_position_id 和 relation_parno 都有值 → Num = relation_position_id
-									if nodeInfo.relationPositionID != "" && relationParno != "" {
-										num = nodeInfo.relationPositionID
-									}
-
-									// 如果 is_enable = "1" → 强制 Num = position_id
-									if isEnable == "1" {
-										num = nodeInfo.positionID
-									}
-									// =============== 规则逻辑结束 ===============
+									// 按取值规则确定 Num（规则见 logic.AttributeResolver）
+									num := resolver.Locate(model.AttributeSetItem, attrObj, nodeInfo.positionID, nodeInfo.relationPositionID).PositionId
 
 									// 拼接 redis的key = svr_DATA_Num
 									redisKey := fmt.Sprintf("svr_DATA_%s", num)
@@ -555,8 +508,8 @@ func GetOverViewData(r *ghttp.Request) {
 
 	//db.InitRedis() //初始化Redis
 
-	// 加载模型缓存（只读一次 Redis）
-	cache, err := LoadModelCache(ctx)
+	// 取共享的模型缓存（启动时加载，后台定时和 keyspace 通知刷新）
+	cache, err := logic.GetModelCache(ctx)
 	if err != nil {
 		r.Response.WriteJson(g.Map{"error": fmt.Sprintf("加载模型缓存失败: %v", err)})
 		return
@@ -573,6 +526,12 @@ func GetOverViewData(r *ghttp.Request) {
 		return
 	}
 
+	// at=<时间> 时从历史快照重建当时的总览
+	if at := r.Get("at").String(); at != "" {
+		getOverViewDataAt(r, stationId, at)
+		return
+	}
+
 	// // 1. 取 Basic
 	// stepStart = time.Now()
 	// basicVal, err := db.Redis.HGet(ctx, "svr_stationNodeModelBasic", stationId).Result()
@@ -625,76 +584,60 @@ func GetOverViewData(r *ghttp.Request) {
 	// }
 	// fmt.Printf("阶段4 Idx JSON解析耗时: %v ms\n", time.Since(stepStart).Milliseconds())
 
-	// 1.读取 Basic 和 Idx（并行）
+	// 1.读取并解析 Basic 和 Idx（并行）
 	stepStart = time.Now()
-	var (
-		basicStr, idxStr string
-		basicErr, idxErr error
-	)
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-
-		basicStr, basicErr = db.Redis.HGet(ctx, "svr_stationNodeModelBasic", stationId).Result()
-	}()
-
-	go func() {
-		defer wg.Done()
-
-		idxStr, idxErr = db.Redis.HGet(ctx, "svr_stationNodeModelIdx", stationId).Result()
-	}()
-
-	wg.Wait()
-
-	if basicErr != nil {
-		r.Response.WriteJson(g.Map{"error": fmt.Sprintf("读取 svr_stationNodeModelBasic 出错: %v", basicErr)})
+	basic, idx, source, err := logic.LoadStationModel(ctx, stationId)
+	if err != nil {
+		r.Response.WriteJson(g.Map{"error": err.Error()})
 		return
 	}
-	if idxErr != nil {
-		r.Response.WriteJson(g.Map{"error": fmt.Sprintf("读取 svr_stationNodeModelIdx 出错: %v", idxErr)})
+	fmt.Printf("阶段1 读取并解析 Basic/Idx 来源: %s 耗时: %v ms\n", source, time.Since(stepStart).Milliseconds())
+
+	// 2.搭出台站树结构，确定每个属性从哪个 svr_DATA_* 取值
+	stepStart = time.Now()
+	builder := logic.NewStationTreeBuilder(stationId, basic, idx, cache)
+	builder.Tree.Source = source
+	// path=发射机/1号机 只返回该子树，attrs=a,b 只返回这些字段和属性，子树外的 svr_DATA_* 不加载
+	path := model.SplitPath(r.Get("path").String())
+	attrs := splitParam(r.Get("attrs").String())
+	node := builder.Select(path, attrs)
+	if node == nil {
+		r.Response.WriteJson(g.Map{
+			"error": fmt.Sprintf("台站 %s 中未找到节点 %s", stationId, strings.Join(path, "/")),
+		})
 		return
 	}
-	fmt.Printf("阶段1 耗时: %v ms\n", time.Since(stepStart).Milliseconds())
+	nums := builder.DataNums()
+	fmt.Printf("阶段2 构造结构并提取工位号 数量: %d 耗时: %v ms\n", len(nums), time.Since(stepStart).Milliseconds())
 
-	// 2.解析 JSON（并行）
+	// 3.按批次 pipeline 预加载 svr_DATA_* 到内存，部分失败时用已读到的数据继续合并
 	stepStart = time.Now()
-	var basic, idx map[string]interface{}
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-
-		_ = json.Unmarshal([]byte(basicStr), &basic)
-	}()
-	go func() {
-		defer wg.Done()
-
-		_ = json.Unmarshal([]byte(idxStr), &idx)
-	}()
-	wg.Wait()
-	fmt.Printf("阶段2 JSON解析耗时: %v ms\n", time.Since(stepStart).Milliseconds())
-
-	// // 3.扫描 idx，找出所有 positionId / rPositionId
-	// stepStart = time.Now()
-	// nums := collectAllPositions(idx)
-	// fmt.Printf("阶段3 提取 positionId/rPositionId 数量: %d 耗时: %v ms\n", len(nums), time.Since(stepStart).Milliseconds())
+	dataCache, err := logic.PreloadDataByNums(ctx, nums)
+	if err != nil {
+		fmt.Printf("preloadDataByNums 出错: %v\n", err)
+	}
+	fmt.Printf("阶段3 批量加载 Redis 数据耗时: %v ms\n", time.Since(stepStart).Milliseconds())
 
-	// // 4.批量预加载 svr_DATA_* 到内存
-	// stepStart = time.Now()
-	// dataCache, err := preloadDataByNums(ctx, nums)
-	// if err != nil {
-	// 	fmt.Printf("preloadDataByNums 出错: %v\n", err)
-	// }
-	// fmt.Printf("阶段4 批量加载 Redis 数据耗时: %v ms\n", time.Since(stepStart).Milliseconds())
+	// 模型和数据都没变时直接返回 304，不再填值和序列化
+	etag := logic.OverviewETag(cache, basic, idx, dataCache, stationId, source, strings.Join(path, "/"),
+		strings.Join(attrs, ","), r.Get("format").String())
+	if middleware.CheckNotModified(r, etag) {
+		return
+	}
 
+	// 4.填值
 	stepStart = time.Now()
-	//  5.合并
-	//mergeRecursiveCache(ctx, basic, idx, cache, dataCache)
-	mergeRecursive(basic, idx, cache) //使用这个函数，就得定义cache
+	builder.Fill(dataCache)
+	node.Project(attrs)
+	//mergeRecursive(basic, idx, cache) //逐个属性查 redis，速度较慢
 	//mergeRecursiveOld(ctx, basic, idx) //使用这个函数无需定义cache
-	fmt.Printf("阶段5 mergeRecursive 耗时: %v ms\n", time.Since(stepStart).Milliseconds())
+	fmt.Printf("阶段4 填充属性值耗时: %v ms\n", time.Since(stepStart).Milliseconds())
+
+	// format=rich 时输出带属性类型、取值工位号和 parno 的结构，默认保持原来的格式
+	var content interface{} = node.WireMap()
+	if r.Get("format").String() == "rich" {
+		content = node.Rich()
+	}
 
 	// 计算耗时
 	duration := time.Since(start) // 计算执行时长
@@ -702,71 +645,31 @@ func GetOverViewData(r *ghttp.Request) {
 
 	// 输出 JSON 给前端前，包装一下
 	response := g.Map{
-		"stationId":   stationId,
-		"MachineName": "",
-		"Result":      "true",
-		"timestamp":   time.Now().Format("2006-01-02 15:04:05"),
-		"time":        durationMs,
-		"Message":     "",
-		"Content":     basic, // 这是原本的合并结果
+		"stationId":    stationId,
+		"path":         node.PathString(),
+		"MachineName":  "",
+		"Result":       "true",
+		"timestamp":    time.Now().Format("2006-01-02 15:04:05"),
+		"time":         durationMs,
+		"Message":      "",
+		"modelVersion": cache.Version, // 模型缓存的版本号
+		"source":       source,        // 台站模型来源：redis 或 station_node（redis 中还没有该台站的模型时）
+		"Content":      content,       // 这是原本的合并结果
 	}
 
 	r.Response.WriteJson(response)
 	//r.Response.WriteJson(json.RawMessage(data))
 }
 
-// 扫描 idx 中的所有 positionId / rPositionId
-func collectAllPositions(node map[string]interface{}) []string {
-	numSet := make(map[string]struct{})
-	var collect func(map[string]interface{})
-	collect = func(m map[string]interface{}) {
-		if v, ok := m["positionId"].(string); ok && v != "" {
-			numSet[v] = struct{}{}
-		}
-		if v, ok := m["rPositionId"].(string); ok && v != "" {
-			numSet[v] = struct{}{}
+// splitParam 拆分逗号分隔的参数，忽略空项
+func splitParam(param string) []string {
+	var items []string
+	for _, item := range strings.Split(param, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
-
-		for _, v := range m {
-			if sub, ok := v.(map[string]interface{}); ok {
-				collect(sub)
-			}
-		}
-	}
-	collect(node)
-
-	nums := make([]string, 0, len(numSet))
-	for k := range numSet {
-		nums = append(nums, k)
-	}
-	return nums
-}
-
-// 批量预加载 Redis 中所有 svr_DATA_*（按 positionId / rPositionId）
-func preloadDataByNums(ctx context.Context, nums []string) (map[string]map[string]string, error) {
-	dataCache := make(map[string]map[string]string)
-	if len(nums) == 0 {
-		return dataCache, nil
-	}
-
-	pipe := db.Redis.Pipeline()
-	cmds := make(map[string]*redis.MapStringStringCmd) // ✅ 改这里
-
-	for _, num := range nums {
-		key := fmt.Sprintf("svr_DATA_%s", num)
-		cmds[key] = pipe.HGetAll(ctx, key)
-	}
-
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return nil, err
 	}
-
-	for key, cmd := range cmds {
-		dataCache[key] = cmd.Val()
-	}
-
-	return dataCache, nil
+	return items
 }
 
 // mergeRecursive 合并 Basic 和 Idx，并展开 rConfig
@@ -827,7 +730,7 @@ func mergeRecursiveOld(ctx context.Context, basic, idx map[string]interface{}) {
 }
 
 // mergeRecursive 合并数据总览的基本属性Basic 和 数据总览的详细属性Idx。这个函数是从缓存中取，而不是每次都去查redis，速度快点。20251014 ldc
-func mergeRecursive(basic, idx map[string]interface{}, cache *ModelCache) {
+func mergeRecursive(basic, idx map[string]interface{}, cache *logic.ModelCache) {
 	subStart := time.Now()
 	if id, ok := idx["dynamic_model_id"].(string); ok && id != "" {
 		processDynamicModelCached(idx, id, cache)
@@ -891,108 +794,6 @@ func mergeRecursive(basic, idx map[string]interface{}, cache *ModelCache) {
 	fmt.Printf("mergeRecursive总耗时: %v\n", time.Since(subStart))
 }
 
-// 从svr_Data缓存集中取值
-func mergeRecursiveCache(ctx context.Context, basic, idx map[string]interface{}, cache *ModelCache, dataCache map[string]map[string]string) {
-	subStart := time.Now()
-	if id, ok := idx["dynamic_model_id"].(string); ok && id != "" {
-		processDynamicModelCachedNew(ctx, idx, id, cache, dataCache)
-		basic["dynamic_model_id"] = id
-	}
-
-	if id, ok := idx["static_model_id"].(string); ok && id != "" {
-		processStaticModelCached(idx, id, cache)
-		basic["static_model_id"] = id
-	}
-
-	if id, ok := idx["setitem_model_id"].(string); ok && id != "" {
-		processSetitemModelCached(idx, id, cache)
-		basic["setitem_model_id"] = id
-	}
-
-	for k, v := range idx {
-		if k == "dynamic_model_id" || k == "static_model_id" || k == "setitem_model_id" {
-			continue
-		}
-
-		if k == "rConfig" {
-			if sub, ok := v.(map[string]interface{}); ok {
-				mergeRecursive(basic, sub, cache)
-			}
-			continue
-		}
-
-		switch sub := v.(type) {
-		case map[string]interface{}:
-			if _, exists := basic[k]; !exists {
-				basic[k] = make(map[string]interface{})
-			}
-			mergeRecursive(basic[k].(map[string]interface{}), sub, cache)
-		default:
-			basic[k] = v
-		}
-	}
-	fmt.Printf("mergeRecursiveCache 总耗时: %v\n", time.Since(subStart))
-}
-
-// 预加载模型，动态、静态和设置项 20251014 ldc
-type ModelCache struct {
-	Dynamic map[string]map[string]map[string]interface{}
-	Static  map[string]map[string]interface{}
-	SetItem map[string]map[string]map[string]interface{}
-}
-
-// 加载redis模型缓存,以便减少访问redis的次数 20251014 ldc
-func LoadModelCache(ctx context.Context) (*ModelCache, error) {
-	cache := &ModelCache{
-		Dynamic: make(map[string]map[string]map[string]interface{}),
-		Static:  make(map[string]map[string]interface{}),
-		SetItem: make(map[string]map[string]map[string]interface{}),
-	}
-
-	// 动态模型的结果集
-	if all, err := db.Redis.HGetAll(ctx, "svr_dynamic_model").Result(); err == nil {
-		for id, jsonStr := range all {
-			var obj map[string]map[string]interface{}
-			if err := json.Unmarshal([]byte(jsonStr), &obj); err == nil {
-				cache.Dynamic[id] = obj
-			}
-		}
-	}
-
-	// modelID := "DTVTrans1000W_1_DynamicModel"
-	// // 取出这个模型的定义（结果是一个 map）
-	// modelDef, ok := cache.Dynamic[modelID]
-	// if !ok {
-	// 	fmt.Println("找不到 Dynamic 模型:", modelID)
-	// }
-	// // 打印这个模型下的所有属性定义
-	// for attr, def := range modelDef {
-	// 	fmt.Printf("属性名: %s, 定义: %v\n", attr, def)
-	// }
-
-	// 静态模型的结果集
-	if all, err := db.Redis.HGetAll(ctx, "svr_static_model").Result(); err == nil {
-		for id, jsonStr := range all {
-			var obj map[string]interface{}
-			if err := json.Unmarshal([]byte(jsonStr), &obj); err == nil {
-				cache.Static[id] = obj
-			}
-		}
-	}
-
-	// 设置模型的结果集
-	if all, err := db.Redis.HGetAll(ctx, "svr_setitem_model").Result(); err == nil {
-		for id, jsonStr := range all {
-			var obj map[string]map[string]interface{}
-			if err := json.Unmarshal([]byte(jsonStr), &obj); err == nil {
-				cache.SetItem[id] = obj
-			}
-		}
-	}
-
-	return cache, nil
-}
-
 // 从缓存中取动态属性  20251014 ldc
 /***
 查dynamic_model_id的值的时候，DTVSystemSwitcher_1属性中有工位号positionId和关联工位号rpositionId，
@@ -1003,121 +804,12 @@ func LoadModelCache(ctx context.Context) (*ModelCache, error) {
 4.去redis中查key=svr_DATA_Num的结果集。
 5.使用的是rpositionId得到的结果集，则取relation_parno作为key去结果集中查到具体值；使用positionId得到的结果集，则取parno作为key去结果集中查到具体值。
 ***/
-func processDynamicModelCached(node map[string]interface{}, modelID string, cache *ModelCache) {
-	positionId, _ := node["positionId"].(string)
-	rPositionId, _ := node["rPositionId"].(string)
-
-	// 从缓存中根据动态属性id取出动态模型的结果集
-	modelDef, ok := cache.Dynamic[modelID]
-	if !ok {
-		return
-	}
-
-	// 遍历结果集中的所有属性定义
-	for attrName, attrDef := range modelDef {
-		//attrName = strings.ToLower(attrName)
-
-		relationParno, _ := attrDef["relation_parno"].(string)
-		parno, _ := attrDef["parno"].(string)
-		isEnable, _ := attrDef["is_enable"].(float64)
-
-		// 决定使用哪个工位号 Num
-		Num := positionId
-		useRelation := false
-
-		if rPositionId != "" && relationParno != "" {
-			Num = rPositionId
-			useRelation = true
-		}
-		if isEnable == 1 {
-			Num = positionId
-			useRelation = false
-		}
-
-		// 查询 Redis
-		dataKey := fmt.Sprintf("svr_DATA_%s", Num)
-		dataVal, err := db.Redis.HGetAll(context.Background(), dataKey).Result()
-		if err != nil || len(dataVal) == 0 {
-			continue
-		}
-
-		// 全部 key 转为小写，动态属性先暂时不需要转小写
-		// lowerMap := make(map[string]string, len(dataVal))
-		// for k, v := range dataVal {
-		// 	lowerMap[strings.ToLower(k)] = v
-		// }
-
-		// 根据是否是关联取不同的字段值
-		var finalValue string
-		if useRelation {
-			//finalValue = lowerMap[strings.ToLower(relationParno)]
-			finalValue = dataVal[relationParno]
-		} else {
-			//finalValue = lowerMap[strings.ToLower(parno)]
-			finalValue = dataVal[parno]
-		}
-
-		// 设置节点属性值，即使为空
-		node[attrName] = finalValue
-	}
-}
-
-// 改为从svr_Data缓存集中取数
-func processDynamicModelCachedNew(ctx context.Context, node map[string]interface{}, modelID string, cache *ModelCache, dataCache map[string]map[string]string) {
-	positionId, _ := node["positionId"].(string)
-	rPositionId, _ := node["rPositionId"].(string)
-
-	// 从缓存中根据动态属性id取出动态模型的结果集
-	modelDef, ok := cache.Dynamic[modelID]
-	if !ok {
-		return
-	}
-
-	// 遍历结果集中的所有属性定义
-	for attrName, attrDef := range modelDef {
-		//attrName = strings.ToLower(attrName)
-
-		relationParno, _ := attrDef["relation_parno"].(string)
-		parno, _ := attrDef["parno"].(string)
-		isEnable, _ := attrDef["is_enable"].(float64)
-
-		// 决定使用哪个工位号 Num
-		Num := positionId
-		useRelation := false
-
-		if rPositionId != "" && relationParno != "" {
-			Num = rPositionId
-			useRelation = true
-		}
-		if isEnable == 1 {
-			Num = positionId
-			useRelation = false
-		}
-
-		// 查询 Redis
-		dataKey := fmt.Sprintf("svr_DATA_%s", Num)
-		dataVal, ok := dataCache[dataKey]
-		if !ok || len(dataVal) == 0 {
-			continue
-		}
-
-		// 根据是否是关联取不同的字段值
-		var finalValue string
-		if useRelation {
-			//finalValue = lowerMap[strings.ToLower(relationParno)]
-			finalValue = dataVal[relationParno]
-		} else {
-			//finalValue = lowerMap[strings.ToLower(parno)]
-			finalValue = dataVal[parno]
-		}
-
-		// 设置节点属性值，即使为空
-		node[attrName] = finalValue
-	}
+func processDynamicModelCached(node map[string]interface{}, modelID string, cache *logic.ModelCache) {
+	processDataModelCached(node, model.AttributeDynamic, cache.Dynamic[modelID], cache.Resolver)
 }
 
 // 从缓存中取静态属性 20251014 ldc
-func processStaticModelCached(node map[string]interface{}, modelID string, cache *ModelCache) {
+func processStaticModelCached(node map[string]interface{}, modelID string, cache *logic.ModelCache) {
 	// 从缓存中获取静态模型定义
 	modelDef, ok := cache.Static[modelID]
 	if !ok {
@@ -1150,58 +842,27 @@ func processStaticModelCached(node map[string]interface{}, modelID string, cache
 4.去redis中查key=svr_DATA_Num的结果集。
 5.使用的是rpositionId得到的结果集，则取relation_parno作为key去结果集中查到具体值；使用positionId得到的结果集，则取parno作为key去结果集中查到具体值。
 ***/
-func processSetitemModelCached(node map[string]interface{}, modelID string, cache *ModelCache) {
+func processSetitemModelCached(node map[string]interface{}, modelID string, cache *logic.ModelCache) {
+	processDataModelCached(node, model.AttributeSetItem, cache.SetItem[modelID], cache.Resolver)
+}
+
+// processDataModelCached 动态属性和设置项属性的取值，规则由 logic.AttributeResolver 统一处理
+func processDataModelCached(node map[string]interface{}, kind model.AttributeKind, modelDef map[string]map[string]interface{}, resolver *logic.AttributeResolver) {
 	positionId, _ := node["positionId"].(string)
 	rPositionId, _ := node["rPositionId"].(string)
 
-	modelDef, ok := cache.SetItem[modelID]
-	if !ok {
-		return
-	}
-
 	for attrName, attrDef := range modelDef {
-		attrName = strings.ToLower(attrName)
+		ref := resolver.Locate(kind, attrDef, positionId, rPositionId)
 
-		// 取配置字段
-		parno, _ := attrDef["parno"].(string)
-		relationParno, _ := attrDef["relation_parno"].(string)
-		isEnable, _ := attrDef["is_enable"].(float64)
-
-		// ----------- 第2步：确定 Num ----------
-		Num := positionId
-		useR := false
-		if rPositionId != "" && relationParno != "" {
-			Num = rPositionId
-			useR = true
-		}
-		if isEnable == 1 {
-			Num = positionId
-			useR = false
-		}
-
-		// ----------- 第3步：从 Redis 获取数据 ----------
-		dataKey := fmt.Sprintf("svr_DATA_%s", Num)
-		dataVal, err := db.Redis.HGetAll(context.Background(), dataKey).Result()
-		if err != nil || len(dataVal) == 0 {
-			continue
-		}
-
-		// ----------- 第4步：全小写处理 ----------
-		lowerMap := make(map[string]string)
-		for k, v := range dataVal {
-			lowerMap[strings.ToLower(k)] = v
+		// 查询 Redis
+		dataVal, err := db.Redis.HGetAll(context.Background(), logic.DataKey(ref.PositionId)).Result()
+		if err != nil {
+			dataVal = nil
 		}
-
-		// ----------- 第5步：根据使用哪种 Num 取值 ----------
-		var val string
-		if useR && relationParno != "" {
-			val = lowerMap[strings.ToLower(relationParno)]
-		} else if parno != "" {
-			val = lowerMap[strings.ToLower(parno)]
+		if raw, ok := resolver.Resolve(kind, ref, attrDef, logic.NewDataRecord(dataVal)); ok {
+			// 设置节点属性值，即使为空
+			node[resolver.Name(kind, attrName)] = raw
 		}
-
-		// ----------- 第6步：赋值到节点 ----------
-		node[attrName] = val
 	}
 }
 
@@ -1238,17 +899,8 @@ func processDynamicModel(ctx context.Context, node map[string]interface{}, model
 		//全部转为小写
 		attrName = strings.ToLower(attrName)
 
-		relationParno, _ := attrDef["relation_parno"].(string)
-		isEnable, _ := attrDef["is_enable"].(float64)
-
 		// 规则：决定 Num
-		Num := positionId
-		if rPositionId != "" && relationParno != "" {
-			Num = rPositionId
-		}
-		if isEnable == 1 {
-			Num = positionId
-		}
+		Num := logic.CurrentResolver(ctx).Locate(model.AttributeDynamic, attrDef, positionId, rPositionId).PositionId
 
 		// 去 Redis 查数据值
 		dataKey := fmt.Sprintf("svr_DATA_%s", Num)
@@ -1331,17 +983,8 @@ func processSetitemModel(ctx context.Context, node map[string]interface{}, model
 		//全部转为小写
 		attrName = strings.ToLower(attrName)
 
-		relationParno, _ := attrDef["relation_parno"].(string)
-		isEnable, _ := attrDef["is_enable"].(float64)
-
 		// 规则：决定 Num
-		Num := positionId
-		if rPositionId != "" && relationParno != "" {
-			Num = rPositionId
-		}
-		if isEnable == 1 {
-			Num = positionId
-		}
+		Num := logic.CurrentResolver(ctx).Locate(model.AttributeSetItem, attrDef, positionId, rPositionId).PositionId
 
 		// 去 Redis 查数据值
 		dataKey := fmt.Sprintf("svr_DATA_%s", Num)
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// 多台站总览数据接口
+// 参数 stationIds：逗号分隔的台站ID，或者 all 表示 svr_station_id 中的所有台站。
+// 每个台站单独返回 Result/Message，某个台站出错不影响其他台站。
+func GetOverViewDataBatch(r *ghttp.Request) {
+	ctx := context.Background()
+	start := time.Now()
+
+	param := strings.TrimSpace(r.Get("stationIds").String())
+	if param == "" {
+		r.Response.WriteJson(g.Map{
+			"error": "缺少参数 stationIds",
+		})
+		return
+	}
+
+	var stationIds []string
+	if strings.EqualFold(param, "all") {
+		ids, err := logic.ListStationIds(ctx)
+		if err != nil {
+			r.Response.WriteJson(g.Map{"error": fmt.Sprintf("读取台站ID失败: %v", err)})
+			return
+		}
+		stationIds = ids
+	} else {
+		stationIds = splitParam(param)
+	}
+
+	results, modelVersion, err := logic.BuildStationTrees(ctx, stationIds)
+	if err != nil {
+		r.Response.WriteJson(g.Map{"error": err.Error()})
+		return
+	}
+
+	rich := r.Get("format").String() == "rich"
+	failed := 0
+	stations := make([]g.Map, 0, len(results))
+	for _, res := range results {
+		if res.Err != nil {
+			failed++
+			stations = append(stations, g.Map{
+				"stationId": res.StationId,
+				"Result":    "false",
+				"Message":   res.Err.Error(),
+				"Content":   nil,
+			})
+			continue
+		}
+
+		var content interface{} = res.Tree.Root.WireMap()
+		if rich {
+			content = res.Tree.Root.Rich()
+		}
+		stations = append(stations, g.Map{
+			"stationId": res.StationId,
+			"source":    res.Tree.Source,
+			"Result":    "true",
+			"Message":   "",
+			"Content":   content,
+		})
+	}
+
+	r.Response.WriteJson(g.Map{
+		"MachineName":  "",
+		"Result":       "true",
+		"timestamp":    time.Now().Format("2006-01-02 15:04:05"),
+		"time":         time.Since(start).Milliseconds(),
+		"Message":      "",
+		"modelVersion": modelVersion,
+		"total":        len(results),
+		"failed":       failed,
+		"Content":      stations,
+	})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gf_api/internal/logic"
+	"gf_api/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// getOverViewDataAt 从历史快照重建台站在 at 时刻的总览，同样支持 path 和 attrs 参数。
+// 历史快照只保存旧版输出结构，不支持 format=rich。
+func getOverViewDataAt(r *ghttp.Request, stationId, atParam string) {
+	ctx := context.Background()
+	start := time.Now()
+
+	at, err := logic.ParseSnapshotTime(atParam)
+	if err != nil {
+		r.Response.WriteJson(g.Map{"error": err.Error()})
+		return
+	}
+	if r.Get("format").String() == "rich" {
+		r.Response.WriteJson(g.Map{"error": "历史快照不支持 format=rich"})
+		return
+	}
+
+	res, err := logic.OverviewAt(ctx, stationId, at)
+	if errors.Is(err, logic.ErrNoSnapshot) {
+		r.Response.WriteJson(g.Map{
+			"error": fmt.Sprintf("台站 %s 在 %s 之前没有历史快照", stationId, at.Format("2006-01-02 15:04:05")),
+		})
+		return
+	} else if err != nil {
+		r.Response.WriteJson(g.Map{"error": err.Error()})
+		return
+	}
+
+	path := model.SplitPath(r.Get("path").String())
+	target, found := logic.FindWirePath(res.Content, path)
+	sub, isMap := target.(map[string]interface{})
+	if !found || !isMap {
+		r.Response.WriteJson(g.Map{
+			"error": fmt.Sprintf("台站 %s 的历史快照中未找到节点 %s", stationId, r.Get("path").String()),
+		})
+		return
+	}
+
+	r.Response.WriteJson(g.Map{
+		"stationId":    stationId,
+		"path":         r.Get("path").String(),
+		"MachineName":  "",
+		"Result":       "true",
+		"timestamp":    time.Now().Format("2006-01-02 15:04:05"),
+		"time":         time.Since(start).Milliseconds(),
+		"Message":      "",
+		"at":           at.Format("2006-01-02 15:04:05"),
+		"capturedAt":   res.CapturedAt.Format("2006-01-02 15:04:05"), // 实际使用的快照采集时间
+		"modelVersion": res.ModelVersion,
+		"Content":      logic.ProjectWire(sub, splitParam(r.Get("attrs").String())),
+	})
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gorilla/websocket"
+)
+
+// 台站总览数据的 WebSocket 推送
+// 连接后先推一份全量 snapshot，之后只推 JSON Patch 风格的 patch；
+// 断线重连时带上 since（上次收到的 version）和 epoch，能补齐时只补发缺失的 patch。
+
+const (
+	wsWriteTimeout = 10 * time.Second // 单条消息写超时，写不出去的慢客户端直接断开
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 25 * time.Second
+)
+
+var overviewUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// GetOverViewDataWs 订阅台站总览变化，例如 /api/Basic/OverViewData/ws?stationId=0101&since=12&epoch=...
+func GetOverViewDataWs(r *ghttp.Request) {
+	stationId := r.Get("stationId").String()
+	if stationId == "" {
+		r.Response.WriteJson(g.Map{
+			"error": "缺少参数 stationId",
+		})
+		return
+	}
+	since := r.Get("since").Int64()
+	epoch := r.Get("epoch").Int64()
+
+	conn, err := overviewUpgrader.Upgrade(r.Response.Writer, r.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已经写回了错误响应
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub, err := logic.SubscribeOverview(ctx, stationId, since, epoch)
+	if err != nil {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		_ = conn.WriteJSON(g.Map{
+			"type":      "error",
+			"stationId": stationId,
+			"message":   err.Error(),
+		})
+		return
+	}
+	defer sub.Close()
+
+	// 读协程：处理 pong 和客户端关闭，客户端发来的其他消息忽略
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-sub.Notify():
+			for _, ev := range sub.Drain() {
+				_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				if err := conn.WriteJSON(ev); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
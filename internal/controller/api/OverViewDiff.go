@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"gf_api/internal/logic"
+	"gf_api/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// 台站总览比较接口。
+// 左边是 stationId 在 from 时刻的总览，右边是 otherStationId（不填为同一台站）在 to 时刻的总览，
+// from/to 不填表示当前值，带时间时从历史快照重建。
+// 例如同一台站现在和一小时前比较：stationId=0101&from=2025-09-01 08:00:00；
+// 主站和备站比较：stationId=0101&otherStationId=0102&ignore=positionId,rPositionId。
+func GetOverViewDiff(r *ghttp.Request) {
+	ctx := context.Background()
+	start := time.Now()
+
+	stationId := r.Get("stationId").String()
+	if stationId == "" {
+		r.Response.WriteJson(g.Map{"error": "缺少参数 stationId"})
+		return
+	}
+	left := logic.OverviewSide{StationId: stationId}
+	right := logic.OverviewSide{StationId: r.Get("otherStationId").String()}
+	if right.StationId == "" {
+		right.StationId = stationId
+	}
+
+	for _, p := range []struct {
+		name string
+		at   *time.Time
+	}{{"from", &left.At}, {"to", &right.At}} {
+		if v := r.Get(p.name).String(); v != "" {
+			t, err := logic.ParseSnapshotTime(v)
+			if err != nil {
+				r.Response.WriteJson(g.Map{"error": err.Error()})
+				return
+			}
+			*p.at = t
+		}
+	}
+	if left == right {
+		r.Response.WriteJson(g.Map{"error": "比较的两边相同，请指定 from/to 或 otherStationId"})
+		return
+	}
+
+	path := model.SplitPath(r.Get("path").String())
+	diff, err := logic.CompareOverviewSides(ctx, left, right, path, splitParam(r.Get("ignore").String()))
+	if err != nil {
+		r.Response.WriteJson(g.Map{"error": err.Error()})
+		return
+	}
+
+	r.Response.WriteJson(g.Map{
+		"MachineName": "",
+		"Result":      "true",
+		"timestamp":   time.Now().Format("2006-01-02 15:04:05"),
+		"time":        time.Since(start).Milliseconds(),
+		"Message":     "",
+		"left":        left.Label(),
+		"right":       right.Label(),
+		"summary": g.Map{
+			"added":   len(diff.Added),
+			"removed": len(diff.Removed),
+			"changed": len(diff.Changed),
+		},
+		"Content": diff,
+	})
+}
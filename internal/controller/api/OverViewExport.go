@@ -0,0 +1,58 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gf_api/internal/logic"
+	"gf_api/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// 台站总览导出接口，把总览平铺成 台站/节点路径/属性名/类型/工位号/parno/值 的表格。
+// 参数 format：csv（默认）或 xlsx；subSystem：只导出该子系统（可以是多级路径），子系统外的 svr_DATA_* 不加载。
+func GetOverViewExport(r *ghttp.Request) {
+	ctx := context.Background()
+
+	stationId := r.Get("stationId").String()
+	if stationId == "" {
+		r.Response.WriteJson(g.Map{"error": "缺少参数 stationId"})
+		return
+	}
+	format := strings.ToLower(r.Get("format", "csv").String())
+	if format != "csv" && format != "xlsx" {
+		r.Response.WriteJson(g.Map{"error": fmt.Sprintf("不支持的导出格式 %s，只支持 csv 和 xlsx", format)})
+		return
+	}
+
+	node, err := logic.BuildStationSubtree(ctx, stationId, model.SplitPath(r.Get("subSystem").String()), nil)
+	if err != nil {
+		r.Response.WriteJson(g.Map{"error": err.Error()})
+		return
+	}
+	rows := logic.ExportRows(stationId, node)
+
+	// 先写到内存里，出错时还能返回 JSON
+	var buf bytes.Buffer
+	contentType := "text/csv; charset=utf-8"
+	if format == "xlsx" {
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+		err = logic.WriteExportXLSX(&buf, stationId, rows)
+	} else {
+		err = logic.WriteExportCSV(&buf, rows)
+	}
+	if err != nil {
+		r.Response.WriteJson(g.Map{"error": fmt.Sprintf("生成导出文件失败: %v", err)})
+		return
+	}
+
+	filename := fmt.Sprintf("overview_%s_%s.%s", stationId, time.Now().Format("20060102150405"), format)
+	r.Response.Header().Set("Content-Type", contentType)
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	r.Response.Write(buf.Bytes())
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// 台站模型一致性检查接口，和命令行 validate 子命令输出同样的报告。
+// 参数 stationIds：逗号分隔的台站ID，不填或 all 表示 svr_station_id 中的所有台站。
+func GetStationModelValidate(r *ghttp.Request) {
+	ctx := context.Background()
+	start := time.Now()
+
+	var stationIds []string
+	if param := strings.TrimSpace(r.Get("stationIds").String()); !strings.EqualFold(param, "all") {
+		stationIds = splitParam(param)
+	}
+
+	report, err := logic.ValidateStations(ctx, stationIds)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"Result":  "false",
+			"Message": err.Error(),
+			"Content": nil,
+		})
+		return
+	}
+
+	r.Response.WriteJson(g.Map{
+		"MachineName": "",
+		"Result":      "true",
+		"timestamp":   time.Now().Format("2006-01-02 15:04:05"),
+		"time":        time.Since(start).Milliseconds(),
+		"Message":     "",
+		"Content":     report,
+	})
+}
@@ -7,18 +7,24 @@ import (
 	"strings"
 	"time"
 
+	"gf_api/internal/logic"
+	"gf_api/internal/model"
+
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/net/ghttp"
 )
 
-//获取子系统数据 ldc 20250901 已完成，但是因为获取总览数据的接口比较慢，因此本接口也慢
+//获取子系统数据 ldc 20250901
+//子系统数据直接在进程内构造台站总览再取对应节点，不再回环请求 OverViewData 接口。
+//带 mode=sse（或请求头 Accept: text/event-stream）时以 Server-Sent Events 持续推送该子系统的变化。
+//SubSystem 可以是多级路径，例如 发射机/1号机，每一级先精确匹配，再不区分大小写匹配。
 
 // Register 把当前模块的所有路由注册到 group
 func Register(group *ghttp.RouterGroup) {
 	group.GET("/Basic/ProgramSystemDataSubscribe", GetProgramSystemDataSubscribe)
 }
 
-// 从台站总览数据接口的子系统节点取数据，必须先有台站总览数据接口。
+// 从台站总览数据的子系统节点取数据
 func GetProgramSystemDataSubscribe(r *ghttp.Request) {
 	ctx := context.Background()
 	timeStart := time.Now()
@@ -26,7 +32,7 @@ func GetProgramSystemDataSubscribe(r *ghttp.Request) {
 	// 从 URL 参数中获取 StationId和SubSystem
 	stationId := r.Get("StationId").String()
 	subSystem := r.Get("SubSystem").String()
-	if stationId == "" && subSystem == "" {
+	if stationId == "" || subSystem == "" {
 		r.Response.WriteJson(g.Map{
 			"Result":      false,
 			"Message":     "缺少参数 StationId和SubSystem",
@@ -37,101 +43,118 @@ func GetProgramSystemDataSubscribe(r *ghttp.Request) {
 		return
 	}
 
-	// 2调用内部接口 /api/alldata 获取总览数据
-	url := fmt.Sprintf("http://127.0.0.1:8001/api/Basic/OverViewData?stationId=%s", stationId)
-	fmt.Println("URL:", url)
-	resp, err := g.Client().Get(ctx, url)
-	if err != nil {
-		r.Response.WriteJson(g.Map{
-			"Result":      false,
-			"Message":     fmt.Sprintf("请求 OverViewData 接口失败: %v", err),
-			"Content":     nil,
-			"MachineName": "",
-		})
+	if r.Get("mode").String() == "sse" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		streamSubSystem(r, stationId, subSystem)
 		return
 	}
-	defer resp.Close()
-
-	// 3解析返回的 JSON
-	body := resp.ReadAll()
 
-	// 4解析 JSON 数据变为Go的map对象
-	var overviewData map[string]interface{}
-	if err := json.Unmarshal(body, &overviewData); err != nil {
+	// 进程内只构造 SubSystem 对应的子树，子树外的 svr_DATA_* 不加载
+	node, err := logic.BuildStationSubtree(ctx, stationId, model.SplitPath(subSystem), nil)
+	if err != nil {
 		r.Response.WriteJson(g.Map{
 			"Result":      false,
-			"Message":     fmt.Sprintf("解析 JSON 失败: %v", err),
+			"Message":     fmt.Sprintf("获取子系统 %s 失败: %v", subSystem, err),
 			"Content":     nil,
 			"MachineName": "",
 		})
 		return
 	}
+	target := node.WireMap()
 
-	// 5查找 SubSystem 节点（不区分大小写）
-	contentRaw, ok := overviewData["Content"]
-	if !ok {
-		r.Response.WriteJson(g.Map{
-			"Result":      false,
-			"Message":     "响应数据中缺少 Content 节点",
-			"Content":     nil,
-			"MachineName": "",
-		})
-		return
+	timeEnd := time.Since(timeStart)
+	r.Response.WriteJson(g.Map{
+		"Result":      true,
+		"time":        timeEnd.Milliseconds(),
+		"Message":     "",
+		"station_id":  stationId,
+		"subSystem":   subSystem,
+		"Content":     target,
+		"MachineName": "",
+	})
+}
+
+// streamSubSystem 以 SSE 推送单个子系统的数据：
+// 按子系统路径订阅，后台只构造该子树、只加载子树内的 svr_DATA_*，推送的增量都在子树内；
+// 连接后先推一次 event: update，之后子系统数据有变化才推；
+// 每 heartbeat 秒（默认取 overview.sse.heartbeat，15s）推一次 event: heartbeat，客户端断开后立即退出。
+func streamSubSystem(r *ghttp.Request, stationId, subSystem string) {
+	reqCtx := r.Context()
+
+	heartbeat := time.Duration(r.Get("heartbeat").Int()) * time.Second
+	if heartbeat <= 0 {
+		heartbeat = g.Cfg().MustGet(reqCtx, "overview.sse.heartbeat", "15s").Duration()
+	}
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
 	}
 
-	// Content 通常是一个 map[string]interface{}
-	contentMap, ok := contentRaw.(map[string]interface{})
-	if !ok {
+	sub, err := logic.SubscribeOverviewPath(reqCtx, stationId, model.SplitPath(subSystem), 0, 0)
+	if err != nil {
 		r.Response.WriteJson(g.Map{
 			"Result":      false,
-			"Message":     "Content 节点不是合法的 JSON 对象",
+			"Message":     fmt.Sprintf("订阅子系统 %s 失败: %v", subSystem, err),
 			"Content":     nil,
 			"MachineName": "",
 		})
 		return
 	}
-
-	// 开始在 Content 里查找 subSystem
-	var target interface{}
-	found := false
-
-	for k, v := range contentMap {
-
-		if strings.EqualFold(k, subSystem) {
-			target = v
-			found = true
-			break
+	defer sub.Close()
+
+	r.Response.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	r.Response.Header().Set("Cache-Control", "no-cache")
+	r.Response.Header().Set("Connection", "keep-alive")
+	r.Response.Header().Set("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-reqCtx.Done():
+			return
+		case <-ticker.C:
+			writeEvent(r, "heartbeat", 0, g.Map{"timestamp": time.Now().Format("2006-01-02 15:04:05")})
+		case <-sub.Notify():
+			if !subSystemChanged(sub.Drain()) {
+				continue
+			}
+			snap := sub.Snapshot()
+			writeEvent(r, "update", snap.Version, g.Map{
+				"Result":      true,
+				"Message":     "",
+				"station_id":  stationId,
+				"subSystem":   subSystem,
+				"version":     snap.Version,
+				"timestamp":   snap.Timestamp,
+				"Content":     snap.Content,
+				"MachineName": "",
+			})
 		}
 	}
+}
 
-	if !found {
-		r.Response.WriteJson(g.Map{
-			"Result":      false,
-			"Message":     fmt.Sprintf("在 Content 中未找到子系统 %s", subSystem),
-			"Content":     nil,
-			"MachineName": "",
-		})
+// writeEvent 写一条 SSE 消息并立即刷出
+func writeEvent(r *ghttp.Request, event string, id int64, data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
 		return
 	}
+	var sb strings.Builder
+	if id > 0 {
+		fmt.Fprintf(&sb, "id: %d\n", id)
+	}
+	fmt.Fprintf(&sb, "event: %s\ndata: %s\n\n", event, b)
+	r.Response.Write(sb.String())
+	r.Response.Flush()
+}
 
-	// 6返回结果
-	if !found {
-		r.Response.WriteJson(g.Map{
-			"Result":      false,
-			"Message":     fmt.Sprintf("未找到 SubSystem=%s 的数据", subSystem),
-			"Content":     nil,
-			"MachineName": "",
-		})
-		return
+// subSystemChanged 取出的消息中有快照或者非空的增量时需要推送。
+// 订阅的是子树，增量的路径都在子树内，不需要再和上一次推送的内容比较。
+func subSystemChanged(events []logic.OverviewEvent) bool {
+	for _, ev := range events {
+		if ev.Type == "snapshot" || len(ev.Ops) > 0 {
+			return true
+		}
 	}
-	timeEnd := time.Since(timeStart)
-	r.Response.WriteJson(g.Map{
-		"Result":      true,
-		"time":        timeEnd.Milliseconds(),
-		"Message":     "",
-		"station_id":  stationId,
-		"subSystem":   subSystem,
-		"Content":     target,
-		"MachineName": "",
-	})
+	return false
 }
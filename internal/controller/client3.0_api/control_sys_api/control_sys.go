@@ -3,98 +3,99 @@ package controlsysapi
 //台站客户端-操作命令下发  ldc 20251023
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"gf_api/internal/controller/middleware"
+	"gf_api/internal/logic"
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/net/ghttp"
 )
 
-// Register 把当前模块的所有路由注册到 group
+// Register 把当前模块的所有路由注册到 group。
+// 下发控制命令兼容不带 token 的台站客户端：带 token 时申请人取鉴权上下文中的用户，
+// 没有用户时普通命令照常受理，需要审批的关键操作被拒绝（login_required）。
 func Register(group *ghttp.RouterGroup) {
-	group.POST("/Resource/IssueOperateNew", IssueOperate)
+	group.Group("/", func(group *ghttp.RouterGroup) {
+		group.Middleware(middleware.OptionalAuthMiddleware)
+		group.POST("/Resource/IssueOperateNew", IssueOperate)
+	})
 }
 
+// IssueOperate 下发控制命令：先按台站节点的操作模型校验，通过后写入命令队列并返回命令ID，由后台转发到下发服务。
+// 校验不通过时 data 为拒绝原因（code/field/message/allowed），命令不会转发；关键操作返回 pending_approval 和审批期限。
 func IssueOperate(r *ghttp.Request) {
 	ctx := context.Background()
 
-	// 读取 POST 请求体的 JSON 数据示例：
-	var reqData map[string]interface{}
-	if err := r.Parse(&reqData); err != nil {
+	// 读取 POST 请求体的 JSON 数据
+	var req logic.CommandRequest
+	if err := r.Parse(&req); err != nil {
 		r.Response.WriteJson(g.Map{
 			"result":  "error",
 			"message": fmt.Sprintf("请求参数解析失败: %v", err),
 		})
 		return
 	}
+	g.Log().Infof(ctx, "收到控制命令: positionId=%s name=%s para=%s paranew=%s user=%s clientIp=%s",
+		req.PositionId, req.Name, req.Para, req.Paranew, req.UserName, req.ClientIp)
 
-	fmt.Println("收到的请求数据:", reqData)
-
-	// 取出字段
-	positionId := reqData["positionId"]
-	name := reqData["name"]
-	para := reqData["para"]
-	paranew := reqData["paranew"]
-	frequency := reqData["frequency"]
-	clientIp := reqData["clientIp"]
-	userCode := reqData["userCode"]
-	UserName := reqData["UserName"]
-	realName := reqData["realName"]
-	AgentType := reqData["AgentType"]
-	fmt.Println("positionId:", positionId)
-	fmt.Println("name:", name)
-	fmt.Println("para:", para)
-	fmt.Println("paranew:", paranew)
-	fmt.Println("frequency:", frequency)
-	fmt.Println("clientIp:", clientIp)
-	fmt.Println("userCode:", userCode)
-	fmt.Println("UserName:", UserName)
-	fmt.Println("realName:", realName)
-	fmt.Println("AgentType:", AgentType)
-
-	// 3️⃣ 组织要转发的请求数据
-	postData := g.Map{
-		"positionId": positionId,
-		"name":       name,
-		"para":       para,
-		"paranew":    paranew,
-		"frequency":  frequency,
-		"clientIp":   clientIp,
-		"userCode":   userCode,
-		"UserName":   UserName,
-		"realName":   realName,
-		"AgentType":  AgentType,
-	}
-
-	// 4️⃣ 发起 POST 请求到目标接口
-	targetURL := "http://111.111.8.242:8005/api/Resource/IssueOperateNew"
-
-	resp, err := g.Client().Post(ctx, targetURL, postData)
+	// 按操作模型校验，不合法的命令不转发
+	target, err := logic.ValidateCommand(ctx, &req)
 	if err != nil {
+		var rej *logic.CommandRejection
+		if errors.As(err, &rej) {
+			g.Log().Warningf(ctx, "控制命令被拒绝: positionId=%s name=%s %s: %s", req.PositionId, req.Name, rej.Code, rej.Message)
+			r.Response.WriteJson(g.Map{
+				"result":  "error",
+				"message": rej.Message,
+				"data":    rej,
+			})
+			return
+		}
 		r.Response.WriteJson(g.Map{
 			"result":  "error",
-			"message": fmt.Sprintf("转发接口请求失败: %v", err),
+			"message": fmt.Sprintf("命令校验失败: %v", err),
 		})
 		return
 	}
-	defer resp.Close()
-
-	// 5️⃣ 读取目标接口返回结果
-	body := resp.ReadAll()
 
-	var responseData interface{}
-	if err := json.Unmarshal(body, &responseData); err != nil {
+	// 写入命令队列后立即返回命令ID，由下发协程转发，状态通过 /Resource/Command 查询。
+	// 关键操作停在 pending_approval，由另一个用户通过 /Resource/CommandApprove 审批后才进入队列。
+	requestedBy := r.GetCtxVar("userID").String()
+	cmd, err := logic.SubmitCommand(ctx, &req, target, requestedBy)
+	if err != nil {
+		var rej *logic.CommandRejection
+		if errors.As(err, &rej) {
+			r.Response.WriteJson(g.Map{
+				"result":  "error",
+				"message": rej.Message,
+				"data":    rej,
+			})
+			return
+		}
 		r.Response.WriteJson(g.Map{
 			"result":  "error",
-			"message": fmt.Sprintf("解析返回 JSON 失败: %v", err),
-			"data":    string(body), // 解析失败则返回原始字符串
+			"message": fmt.Sprintf("命令受理失败: %v", err),
+		})
+		return
+	}
+	if cmd.Status == logic.CommandPendingApproval {
+		r.Response.WriteJson(g.Map{
+			"result":  "success",
+			"message": "关键操作已提交，等待审批",
+			"data": g.Map{
+				"commandId":        cmd.Id,
+				"status":           cmd.Status,
+				"approvalDeadline": cmd.ApprovalDeadline,
+			},
 		})
 		return
 	}
-
-	// 成功解析 JSON，直接返回
 	r.Response.WriteJson(g.Map{
 		"result":  "success",
-		"message": "转发成功",
-		"data":    responseData, // 这里是结构化 JSON
+		"message": "命令已受理",
+		"data": g.Map{
+			"commandId": cmd.Id,
+			"status":    cmd.Status,
+		},
 	})
 }
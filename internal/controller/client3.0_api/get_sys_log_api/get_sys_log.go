@@ -34,8 +34,8 @@ func GetLogData(r *ghttp.Request) {
 		return
 	}
 
-	// 查询 operation_log 表的所有字段
-	sql := `select user_name, ip_addr, station_id, postion_id, operate_detail, operate_time, real_name, frequency, para_data, remarks from operation_log WHERE postion_id =? and log_type=? limit 20`
+	// 查询 operation_log 表的所有字段，最新的在前（控制命令的回读结果也写在这里）
+	sql := `select user_name, ip_addr, station_id, postion_id, operate_detail, operate_time, real_name, frequency, para_data, remarks from operation_log WHERE postion_id =? and log_type=? order by operate_time desc limit 20`
 	fmt.Printf("PgDB 是否为 nil？ %v\n", db.PgDB == nil)
 	results, err := db.PgDB.Query(ctx, sql, positionId, logType)
 	if err != nil {
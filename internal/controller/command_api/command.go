@@ -0,0 +1,203 @@
+package commandapi
+
+// 控制命令的状态查询和关键操作审批接口，命令由 /Resource/IssueOperateNew 受理
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gf_api/internal/controller/middleware"
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gogf/gf/v2/os/gtime"
+)
+
+// Register 把当前模块的所有路由注册到 group
+func Register(group *ghttp.RouterGroup) {
+	group.GET("/Resource/Commands", GetCommands)
+	group.GET("/Resource/Command", GetCommand)
+	group.GET("/Resource/CommandApprovals", GetCommandApprovals)
+	// 审批和定时任务的修改必须鉴权：审批人、创建人取鉴权上下文中的用户
+	group.Group("/", func(group *ghttp.RouterGroup) {
+		group.Middleware(middleware.AuthMiddleware)
+		group.POST("/Resource/CommandApprove", ApproveCommand)
+		group.POST("/Resource/CommandReject", RejectCommand)
+		registerScheduleWrites(group)
+	})
+	registerScheduleReads(group)
+}
+
+// GetCommands 分页查询控制命令，可按工位号、台站、状态、用户、定时任务和受理时间过滤
+func GetCommands(r *ghttp.Request) {
+	query := logic.CommandQuery{
+		PositionId: r.Get("positionId").String(),
+		StationId:  r.Get("stationId").String(),
+		Status:     r.Get("status").String(),
+		UserCode:   r.Get("userCode").String(),
+		ScheduleId: r.Get("scheduleId").Int64(),
+		PageIndex:  r.Get("pageIndex", "1").Int(),
+		PageSize:   r.Get("pageSize", "20").Int(),
+	}
+	for _, t := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"beginTime", &query.Begin},
+		{"endTime", &query.End},
+	} {
+		value := r.Get(t.name).String()
+		if value == "" {
+			continue
+		}
+		parsed, err := gtime.StrToTime(value)
+		if err != nil {
+			r.Response.WriteJson(g.Map{
+				"code":    400,
+				"message": fmt.Sprintf("参数 %s 格式错误，应为 YYYY-MM-DD HH:mm:ss", t.name),
+				"data":    nil,
+			})
+			return
+		}
+		*t.dst = parsed.Time
+	}
+
+	list, total, err := logic.QueryCommands(r.GetCtx(), query)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    500,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data": g.Map{
+			"pageIndex": query.PageIndex,
+			"pageSize":  query.PageSize,
+			"total":     total,
+			"list":      list,
+		},
+	})
+}
+
+// GetCommand 查询一条命令的当前状态和状态变化记录
+func GetCommand(r *ghttp.Request) {
+	id := r.Get("id").Int64()
+	if id <= 0 {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": "缺少参数 id",
+			"data":    nil,
+		})
+		return
+	}
+	cmd, err := logic.GetCommand(r.GetCtx(), id)
+	if err != nil {
+		code := 500
+		if errors.Is(err, logic.ErrCommandNotFound) {
+			code = 404
+		}
+		r.Response.WriteJson(g.Map{
+			"code":    code,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data":    cmd,
+	})
+}
+
+// GetCommandApprovals 分页查询需要审批的关键操作命令，status 默认为 pending_approval，为 all 时不按状态过滤
+func GetCommandApprovals(r *ghttp.Request) {
+	query := logic.CommandQuery{
+		PositionId:   r.Get("positionId").String(),
+		StationId:    r.Get("stationId").String(),
+		Status:       r.Get("status", logic.CommandPendingApproval).String(),
+		NeedApproval: true,
+		PageIndex:    r.Get("pageIndex", "1").Int(),
+		PageSize:     r.Get("pageSize", "20").Int(),
+	}
+	if query.Status == "all" {
+		query.Status = ""
+	}
+	list, total, err := logic.QueryCommands(r.GetCtx(), query)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    500,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data": g.Map{
+			"pageIndex": query.PageIndex,
+			"pageSize":  query.PageSize,
+			"total":     total,
+			"list":      list,
+		},
+	})
+}
+
+// ApproveCommand 审批通过等待审批的命令，审批人为当前登录用户，不能是申请人
+func ApproveCommand(r *ghttp.Request) {
+	writeApprovalResult(r, logic.ApproveCommand)
+}
+
+// RejectCommand 驳回等待审批的命令，申请人自己可以撤回
+func RejectCommand(r *ghttp.Request) {
+	writeApprovalResult(r, logic.RejectCommand)
+}
+
+// writeApprovalResult 读取 id/comment 执行审批，按错误类型返回 404/409/403/400
+func writeApprovalResult(r *ghttp.Request, do func(ctx context.Context, id int64, user, comment string) (*logic.Command, error)) {
+	id := r.Get("id").Int64()
+	if id <= 0 {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": "缺少参数 id",
+			"data":    nil,
+		})
+		return
+	}
+	cmd, err := do(r.GetCtx(), id, r.GetCtxVar("userID").String(), r.Get("comment").String())
+	if err != nil {
+		var (
+			rej  *logic.CommandRejection
+			code = 500
+			data interface{}
+		)
+		switch {
+		case errors.Is(err, logic.ErrCommandNotFound):
+			code = 404
+		case errors.Is(err, logic.ErrCommandTransition):
+			code = 409
+		case errors.Is(err, logic.ErrCommandApprover):
+			code = 403
+		case errors.As(err, &rej):
+			code, data = 400, rej
+		}
+		r.Response.WriteJson(g.Map{
+			"code":    code,
+			"message": err.Error(),
+			"data":    data,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data":    cmd,
+	})
+}
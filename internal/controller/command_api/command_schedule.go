@@ -0,0 +1,168 @@
+package commandapi
+
+// 定时和周期控制命令的创建、查询、暂停、恢复和取消
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gogf/gf/v2/os/gtime"
+)
+
+// scheduleRequest 创建定时任务的请求：命令字段与 IssueOperateNew 相同，另外指定 runAt 或 cron
+type scheduleRequest struct {
+	logic.CommandRequest
+	Remark  string `json:"remark"`
+	Cron    string `json:"cron"`
+	RunAt   string `json:"runAt"`
+	Misfire string `json:"misfire"`
+}
+
+// registerScheduleReads 注册定时任务的查询路由
+func registerScheduleReads(group *ghttp.RouterGroup) {
+	group.GET("/Resource/CommandSchedules", GetCommandSchedules)
+	group.GET("/Resource/CommandSchedule", GetCommandSchedule)
+}
+
+// registerScheduleWrites 注册定时任务的创建和状态修改路由，调用方负责加鉴权中间件
+func registerScheduleWrites(group *ghttp.RouterGroup) {
+	group.POST("/Resource/CommandSchedule", CreateCommandSchedule)
+	group.POST("/Resource/CommandSchedulePause", PauseCommandSchedule)
+	group.POST("/Resource/CommandScheduleResume", ResumeCommandSchedule)
+	group.POST("/Resource/CommandScheduleCancel", CancelCommandSchedule)
+}
+
+// GetCommandSchedules 分页查询定时任务，可按工位号、台站和状态过滤
+func GetCommandSchedules(r *ghttp.Request) {
+	query := logic.CommandScheduleQuery{
+		PositionId: r.Get("positionId").String(),
+		StationId:  r.Get("stationId").String(),
+		Status:     r.Get("status").String(),
+		PageIndex:  r.Get("pageIndex", "1").Int(),
+		PageSize:   r.Get("pageSize", "20").Int(),
+	}
+	list, total, err := logic.QueryCommandSchedules(r.GetCtx(), query)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    500,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data": g.Map{
+			"pageIndex": query.PageIndex,
+			"pageSize":  query.PageSize,
+			"total":     total,
+			"list":      list,
+		},
+	})
+}
+
+// GetCommandSchedule 查询一个定时任务，每次执行的命令通过 /Resource/Commands?scheduleId= 查询
+func GetCommandSchedule(r *ghttp.Request) {
+	changeSchedule(r, logic.GetCommandSchedule)
+}
+
+// CreateCommandSchedule 创建定时任务，创建人为当前登录用户
+func CreateCommandSchedule(r *ghttp.Request) {
+	var req scheduleRequest
+	if err := r.Parse(&req); err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": fmt.Sprintf("请求参数解析失败: %v", err),
+			"data":    nil,
+		})
+		return
+	}
+	s := &logic.CommandSchedule{
+		CommandRequest: req.CommandRequest,
+		Remark:         req.Remark,
+		Cron:           req.Cron,
+		Misfire:        req.Misfire,
+		CreatedBy:      r.GetCtxVar("userID").String(),
+	}
+	if req.RunAt != "" {
+		runAt, err := gtime.StrToTime(req.RunAt)
+		if err != nil {
+			r.Response.WriteJson(g.Map{
+				"code":    400,
+				"message": "参数 runAt 格式错误，应为 YYYY-MM-DD HH:mm:ss",
+				"data":    nil,
+			})
+			return
+		}
+		t := runAt.Time
+		s.RunAt = &t
+	}
+	s, err := logic.CreateCommandSchedule(r.GetCtx(), s)
+	writeScheduleResult(r, s, err)
+}
+
+// PauseCommandSchedule 暂停定时任务
+func PauseCommandSchedule(r *ghttp.Request) {
+	changeSchedule(r, logic.PauseCommandSchedule)
+}
+
+// ResumeCommandSchedule 恢复暂停的定时任务
+func ResumeCommandSchedule(r *ghttp.Request) {
+	changeSchedule(r, logic.ResumeCommandSchedule)
+}
+
+// CancelCommandSchedule 取消定时任务，已经写入队列的命令不受影响
+func CancelCommandSchedule(r *ghttp.Request) {
+	changeSchedule(r, logic.CancelCommandSchedule)
+}
+
+func changeSchedule(r *ghttp.Request, do func(ctx context.Context, id int64) (*logic.CommandSchedule, error)) {
+	id := r.Get("id").Int64()
+	if id <= 0 {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": "缺少参数 id",
+			"data":    nil,
+		})
+		return
+	}
+	s, err := do(r.GetCtx(), id)
+	writeScheduleResult(r, s, err)
+}
+
+// writeScheduleResult 按错误类型返回 404/409/400
+func writeScheduleResult(r *ghttp.Request, s *logic.CommandSchedule, err error) {
+	if err != nil {
+		var (
+			rej  *logic.CommandRejection
+			code = 500
+			data interface{}
+		)
+		switch {
+		case errors.Is(err, logic.ErrScheduleNotFound):
+			code = 404
+		case errors.Is(err, logic.ErrScheduleTransition):
+			code = 409
+		case errors.Is(err, logic.ErrScheduleInvalid):
+			code = 400
+		case errors.As(err, &rej):
+			code, data = 400, rej
+		}
+		r.Response.WriteJson(g.Map{
+			"code":    code,
+			"message": err.Error(),
+			"data":    data,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data":    s,
+	})
+}
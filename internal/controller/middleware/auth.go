@@ -112,3 +112,13 @@ func AuthMiddleware(r *ghttp.Request) {
 	// 继续执行后续中间件或请求处理函数
 	r.Middleware.Next()
 }
+
+// OptionalAuthMiddleware 带 token 时和 AuthMiddleware 一样验证并写入 userID，没有 token 时不鉴权直接放行，
+// 用于兼容不带 token 的台站客户端，需要用户的操作由业务自己拒绝
+func OptionalAuthMiddleware(r *ghttp.Request) {
+	if r.Header.Get("Authorization") == "" {
+		r.Middleware.Next()
+		return
+	}
+	AuthMiddleware(r)
+}
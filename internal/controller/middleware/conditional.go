@@ -0,0 +1,196 @@
+package middleware
+
+// 条件请求和压缩中间件：给 GET 响应加 ETag，If-None-Match 命中时返回 304，按客户端的 Accept-Encoding 用 br 或 gzip 压缩。
+// 台站客户端按固定间隔轮询总览、台站信息和频率节目，内容大多没变，远端台站链路慢，省下的流量很可观。
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// ConditionalMiddleware 在处理函数执行完后处理响应：
+//  1. 处理函数没有设置 ETag 时，用响应内容的哈希作为 ETag；
+//  2. 请求的 If-None-Match 与 ETag 一致时清空内容返回 304；
+//  3. 内容不小于 server.compress.minSize（默认1024字节）时按 Accept-Encoding 协商压缩：
+//     q 值高的优先，相同时 br 优先于 gzip；压缩级别为 server.compress.brLevel（默认5）和 server.compress.level。
+//
+// 只处理 GET/HEAD 的 200 响应，WebSocket、已经直接写出或自带 Content-Encoding 的响应不处理。
+// 内容随每次请求变化（如带时间戳）的处理函数应先用数据版本调用 CheckNotModified，否则内容哈希每次都不同。
+func ConditionalMiddleware(r *ghttp.Request) {
+	r.Middleware.Next()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return
+	}
+	if r.Header.Get("Upgrade") != "" || r.Response.IsHijacked() || r.Response.IsHeaderWrote() {
+		return
+	}
+	if r.Response.Status != 0 && r.Response.Status != http.StatusOK {
+		return
+	}
+	header := r.Response.Header()
+	if header.Get("Content-Encoding") != "" {
+		return
+	}
+	body := r.Response.Buffer()
+	if len(body) == 0 {
+		return
+	}
+
+	header.Add("Vary", "Accept-Encoding")
+	encoding := ""
+	if len(body) >= g.Cfg().MustGet(r.GetCtx(), "server.compress.minSize", 1024).Int() {
+		encoding = negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	}
+	if compressedContentType(header.Get("Content-Type")) {
+		encoding = ""
+	}
+	compress := encoding != ""
+
+	etag := header.Get("ETag")
+	if etag == "" {
+		etag = ContentETag(body)
+	}
+	if compress {
+		// 不同编码的内容不一样，强 ETag 要求逐字节相同，压缩时用弱 ETag
+		etag = weakETag(etag)
+	}
+	if CheckNotModified(r, etag) || !compress {
+		return
+	}
+
+	compressed, err := compressBody(body, encoding,
+		g.Cfg().MustGet(r.GetCtx(), "server.compress.level", gzip.DefaultCompression).Int(),
+		g.Cfg().MustGet(r.GetCtx(), "server.compress.brLevel", 5).Int())
+	if err != nil {
+		g.Log().Warningf(r.GetCtx(), "%s 压缩响应失败，按原样返回: %v", encoding, err)
+		return
+	}
+	header.Set("Content-Encoding", encoding)
+	header.Del("Content-Length")
+	r.Response.SetBuffer(compressed)
+}
+
+// compressedContentType 内容本身已经压缩过（zip、xlsx 等 Office 文档、图片、音视频），再压也没用
+func compressedContentType(ct string) bool {
+	ct = strings.ToLower(ct)
+	for _, s := range []string{"zip", "officedocument", "spreadsheetml", "opendocument"} {
+		if strings.Contains(ct, s) {
+			return true
+		}
+	}
+	return strings.HasPrefix(ct, "image/") || strings.HasPrefix(ct, "audio/") || strings.HasPrefix(ct, "video/")
+}
+
+// compressBody 按 encoding（br 或 gzip）压缩内容
+func compressBody(body []byte, encoding string, gzipLevel, brLevel int) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		zw  interface {
+			Write([]byte) (int, error)
+			Close() error
+		}
+	)
+	switch encoding {
+	case "br":
+		zw = brotli.NewWriterLevel(&buf, brLevel)
+	default:
+		w, err := gzip.NewWriterLevel(&buf, gzipLevel)
+		if err != nil {
+			w = gzip.NewWriter(&buf)
+		}
+		zw = w
+	}
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ContentETag 根据响应内容生成 ETag
+func ContentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// CheckNotModified 设置 ETag，If-None-Match 命中时清空已写的内容并返回 304。
+// 处理函数能拿到数据版本号时可以先调用它，命中就不必构造内容。
+// 返回 true 表示已经按 304 处理，处理函数应直接返回。
+func CheckNotModified(r *ghttp.Request, etag string) bool {
+	r.Response.Header().Set("ETag", etag)
+	if !etagMatch(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	r.Response.ClearBuffer()
+	r.Response.Header().Del("Content-Length")
+	r.Response.Header().Del("Content-Type")
+	r.Response.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch If-None-Match 按弱比较：忽略 W/ 前缀，支持逗号分隔的多个值和 *
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+func weakETag(etag string) string {
+	if strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return "W/" + etag
+}
+
+// negotiateEncoding 从 Accept-Encoding 中选压缩方式：q 值最高的 br 或 gzip，相同时 br 优先，都不接受时返回空。
+// 明确列出的编码优先于 *，q=0 表示不接受。
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{"br", "gzip"} {
+		if q := encodingQuality(acceptEncoding, encoding); q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// encodingQuality Accept-Encoding 中 encoding 的 q 值，没有列出时取 * 的 q 值，都没有为0
+func encodingQuality(acceptEncoding, encoding string) float64 {
+	wildcard := 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		switch {
+		case strings.EqualFold(name, encoding):
+			return q
+		case name == "*":
+			wildcard = q
+		}
+	}
+	return wildcard
+}
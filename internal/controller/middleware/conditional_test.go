@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, deflate, br", "br"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"br;q=0, gzip", "gzip"},
+		{"gzip;q=0, br;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.5, gzip", "gzip"},
+		{"br;q=0, *", "gzip"},
+		{"GZIP", "gzip"},
+	}
+	for _, c := range cases {
+		if got := negotiateEncoding(c.accept); got != c.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", c.accept, got, c.want)
+		}
+	}
+}
+
+func TestCompressBody(t *testing.T) {
+	body := []byte(strings.Repeat(`{"stationId":"0101","value":"12.5"},`, 200))
+	for _, encoding := range []string{"br", "gzip"} {
+		compressed, err := compressBody(body, encoding, gzip.DefaultCompression, 5)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if len(compressed) >= len(body) {
+			t.Errorf("%s: 压缩后 %d 字节，不小于原始的 %d 字节", encoding, len(compressed), len(body))
+		}
+		var r io.Reader
+		if encoding == "br" {
+			r = brotli.NewReader(bytes.NewReader(compressed))
+		} else if r, err = gzip.NewReader(bytes.NewReader(compressed)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, body) {
+			t.Errorf("%s: 解压结果不一致: %v", encoding, err)
+		}
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	cases := []struct {
+		ifNoneMatch, etag string
+		want              bool
+	}{
+		{"", `"a"`, false},
+		{`"a"`, `"a"`, true},
+		{`W/"a"`, `"a"`, true},
+		{`"a"`, `W/"a"`, true},
+		{`"b", "a"`, `"a"`, true},
+		{`"b"`, `"a"`, false},
+		{"*", `"a"`, true},
+	}
+	for _, c := range cases {
+		if got := etagMatch(c.ifNoneMatch, c.etag); got != c.want {
+			t.Errorf("etagMatch(%q, %q) = %v, want %v", c.ifNoneMatch, c.etag, got, c.want)
+		}
+	}
+	if got := weakETag(`"a"`); got != `W/"a"` {
+		t.Errorf("weakETag = %s", got)
+	}
+	if ContentETag([]byte("x")) != ContentETag([]byte("x")) || ContentETag([]byte("x")) == ContentETag([]byte("y")) {
+		t.Error("ContentETag 应只由内容决定")
+	}
+}
+
+func TestCompressedContentType(t *testing.T) {
+	cases := []struct {
+		ct   string
+		want bool
+	}{
+		{"application/json", false},
+		{"text/csv; charset=utf-8", false},
+		{"text/html; charset=utf-8", false},
+		{"application/zip", true},
+		{"application/gzip", true},
+		{"application/x-7z-compressed", false},
+		{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", true},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", true},
+		{"application/vnd.oasis.opendocument.spreadsheet", true},
+		{"image/png", true},
+		{"video/mp4", true},
+	}
+	for _, c := range cases {
+		if got := compressedContentType(c.ct); got != c.want {
+			t.Errorf("compressedContentType(%q) = %v, want %v", c.ct, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package notifyapi
+
+// 通知发件箱查询和通道测试接口
+import (
+	"gf_api/internal/controller/middleware"
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// Register 把当前模块的所有路由注册到 group
+func Register(group *ghttp.RouterGroup) {
+	// 测试接口会向所有配置的通道真实发送消息，发件箱里有告警内容，都必须鉴权
+	group.Group("/", func(group *ghttp.RouterGroup) {
+		group.Middleware(middleware.AuthMiddleware)
+		group.GET("/Admin/NotifyOutbox", GetNotifyOutbox)
+		group.POST("/Admin/NotifyTest", NotifyTest)
+	})
+}
+
+// GetNotifyOutbox 分页查询通知发件箱
+func GetNotifyOutbox(r *ghttp.Request) {
+	list, total, err := logic.QueryNotifyOutbox(r.GetCtx(), r.Get("status").String(),
+		r.Get("pageIndex", "1").Int(), r.Get("pageSize", "20").Int())
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    500,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data": g.Map{
+			"total": total,
+			"list":  list,
+		},
+	})
+}
+
+// NotifyTest 通过指定通道直接发一条测试通知，检查通道配置是否可用
+func NotifyTest(r *ghttp.Request) {
+	channel := r.Get("channel").String()
+	if channel == "" {
+		r.Response.WriteJson(g.Map{
+			"code":    400,
+			"message": "缺少参数 channel",
+			"data":    nil,
+		})
+		return
+	}
+	if err := logic.SendTestNotification(r.GetCtx(), channel); err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    500,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    200,
+		"message": "success",
+		"data":    g.Map{"channel": channel},
+	})
+}
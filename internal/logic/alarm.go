@@ -0,0 +1,606 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gf_api/internal/db"
+	"gf_api/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// 实时告警引擎。
+// 定时构造所有台站的总览树，对动态属性和设置项属性的值按告警规则判断，产生、更新和消除告警，写入 PostgreSQL 的 alarm_event 表。
+// 规则有三个来源，优先级从高到低：
+//  1. alarm_rule 表中按 position_id 配置的规则（工位号 + 属性名）；
+//  2. alarm_rule 表中按 model_id 配置的规则（模型 + 属性名，对使用该模型的所有节点生效）；
+//  3. 设置项/动态模型属性定义中的上下限字段（alarm.limitFields.upper / lower，默认 upper_limit / lower_limit）。
+//
+// 同一个节点的同一个属性只有一条活动告警，级别变化时更新这条告警，恢复正常后消除。
+// 祖先节点有活动告警时，子孙节点的告警归到最上层的根因告警下（见 alarm_correlate.go）。
+// 取不到值（svr_DATA 缺失、台站构造失败）时不改变告警状态。
+
+// 告警级别，从高到低
+const (
+	SeverityCritical = "critical"
+	SeverityMajor    = "major"
+	SeverityMinor    = "minor"
+	SeverityWarning  = "warning"
+)
+
+// SeverityRank 级别的高低，未知级别为0
+func SeverityRank(severity string) int {
+	switch severity {
+	case SeverityCritical:
+		return 4
+	case SeverityMajor:
+		return 3
+	case SeverityMinor:
+		return 2
+	case SeverityWarning:
+		return 1
+	}
+	return 0
+}
+
+// 规则类型
+const (
+	AlarmRuleThreshold = "threshold" // 数值越限
+	AlarmRuleState     = "state"     // 状态值匹配
+)
+
+// 规则来源
+const (
+	AlarmRuleSourcePosition = "position"
+	AlarmRuleSourceModel    = "model"
+	AlarmRuleSourceLimit    = "limit"
+)
+
+// AlarmThreshold 一级越限：值大于 Above 或小于 Below 时告警
+type AlarmThreshold struct {
+	Severity string   `json:"severity"`
+	Above    *float64 `json:"above,omitempty"`
+	Below    *float64 `json:"below,omitempty"`
+}
+
+// AlarmRule 一条告警规则
+type AlarmRule struct {
+	Id         int64             `json:"id"`
+	Name       string            `json:"name"`
+	Source     string            `json:"source"`               // position / model / limit
+	ModelId    string            `json:"modelId,omitempty"`    // 按模型配置时的模型ID
+	PositionId string            `json:"positionId,omitempty"` // 按工位号配置时的工位号（实际取值的工位号）
+	Attribute  string            `json:"attribute"`            // 属性名或 parno，不区分大小写
+	Kind       string            `json:"kind"`                 // threshold / state
+	Thresholds []AlarmThreshold  `json:"thresholds,omitempty"`
+	States     map[string]string `json:"states,omitempty"`   // 状态值 -> 级别，不区分大小写
+	Deadband   float64           `json:"deadband,omitempty"` // 越限恢复的回差，避免在限值附近反复告警和消除
+	Message    string            `json:"message,omitempty"`
+}
+
+// Evaluate 按规则判断值，返回告警级别，正常时返回空。current 为当前活动告警的级别，用于回差判断。
+func (r *AlarmRule) Evaluate(raw interface{}, current string) string {
+	switch r.Kind {
+	case AlarmRuleState:
+		val := strings.ToLower(strings.TrimSpace(gconv.String(raw)))
+		for state, severity := range r.States {
+			if strings.ToLower(strings.TrimSpace(state)) == val {
+				return severity
+			}
+		}
+		return ""
+	case AlarmRuleThreshold:
+		v, ok := numericValue(raw)
+		if !ok {
+			return ""
+		}
+		best := ""
+		for _, t := range r.Thresholds {
+			// 当前已经处于该级别或更高级别时，回到限值内 Deadband 以上才算恢复
+			band := 0.0
+			if current != "" && SeverityRank(current) >= SeverityRank(t.Severity) {
+				band = r.Deadband
+			}
+			hit := (t.Above != nil && v > *t.Above-band) || (t.Below != nil && v < *t.Below+band)
+			if hit && SeverityRank(t.Severity) > SeverityRank(best) {
+				best = t.Severity
+			}
+		}
+		return best
+	}
+	return ""
+}
+
+// numericValue 属性值转数字，空字符串和非数字返回 false
+func numericValue(raw interface{}) (float64, bool) {
+	switch v := model.ParseAttributeValue(raw).(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// AlarmEvent 一条告警
+type AlarmEvent struct {
+	Id         int64      `json:"id"`
+	AlarmKey   string     `json:"alarmKey"` // 台站/节点路径/属性名，同一时刻只有一条活动告警
+	StationId  string     `json:"stationId"`
+	Path       string     `json:"path"`
+	Attribute  string     `json:"attribute"`
+	PositionId string     `json:"positionId"`
+	Parno      string     `json:"parno"`
+	RuleId     int64      `json:"ruleId"`
+	RuleSource string     `json:"ruleSource"`
+	Severity   string     `json:"severity"`
+	Value      string     `json:"value"`
+	Message    string     `json:"message"`
+	State      string     `json:"state"` // active / acked / cleared
+	RaisedAt   time.Time  `json:"raisedAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	ClearedAt  *time.Time `json:"clearedAt,omitempty"`
+
+	AckedBy      string     `json:"ackedBy,omitempty"`
+	AckedAt      *time.Time `json:"ackedAt,omitempty"`
+	ShelvedBy    string     `json:"shelvedBy,omitempty"`
+	ShelvedUntil *time.Time `json:"shelvedUntil,omitempty"` // 搁置到该时间，期间不出现在活动告警列表中，也不发通知
+
+	RootKey    string `json:"rootKey,omitempty"` // 根因告警的 AlarmKey，为空表示自身就是根因
+	Suppressed bool   `json:"suppressed"`        // 归到根因告警下后不再单独发通知
+}
+
+// Shelved 告警在 now 时是否处于搁置中
+func (ev *AlarmEvent) Shelved(now time.Time) bool {
+	return ev.ShelvedUntil != nil && now.Before(*ev.ShelvedUntil)
+}
+
+// 告警状态：active → acked → cleared，未确认的告警也可以直接消除
+const (
+	AlarmActive  = "active"
+	AlarmAcked   = "acked"
+	AlarmCleared = "cleared"
+)
+
+// AlarmKey 告警的唯一标识
+func AlarmKey(stationId, path, attribute string) string {
+	return stationId + "/" + path + "/" + attribute
+}
+
+// AlarmRuleSet 一次评估使用的全部规则
+type AlarmRuleSet struct {
+	byPosition map[string][]*AlarmRule // positionId -> 规则
+	byModel    map[string][]*AlarmRule // modelId -> 规则
+	limits     map[string]*AlarmRule   // 模型类型/modelId/小写属性名 -> 上下限规则，按需生成
+	cache      *ModelCache
+	upperField string
+	lowerField string
+	severity   string
+}
+
+// NewAlarmRuleSet 整理规则，cache 用于从模型属性定义中取上下限
+func NewAlarmRuleSet(ctx context.Context, rules []*AlarmRule, cache *ModelCache) *AlarmRuleSet {
+	s := &AlarmRuleSet{
+		byPosition: make(map[string][]*AlarmRule),
+		byModel:    make(map[string][]*AlarmRule),
+		limits:     make(map[string]*AlarmRule),
+		cache:      cache,
+		upperField: g.Cfg().MustGet(ctx, "alarm.limitFields.upper", "upper_limit").String(),
+		lowerField: g.Cfg().MustGet(ctx, "alarm.limitFields.lower", "lower_limit").String(),
+		severity:   g.Cfg().MustGet(ctx, "alarm.limitSeverity", SeverityMajor).String(),
+	}
+	for _, r := range rules {
+		switch {
+		case r.PositionId != "":
+			s.byPosition[r.PositionId] = append(s.byPosition[r.PositionId], r)
+		case r.ModelId != "":
+			s.byModel[r.ModelId] = append(s.byModel[r.ModelId], r)
+		}
+	}
+	return s
+}
+
+// Match 找到属性适用的规则，没有时返回 nil
+func (s *AlarmRuleSet) Match(a *model.Attribute) *AlarmRule {
+	if a.Kind == model.AttributeStatic {
+		return nil
+	}
+	for _, r := range s.byPosition[a.PositionId] {
+		if r.matches(a) {
+			return r
+		}
+	}
+	for _, r := range s.byModel[a.ModelId] {
+		if r.matches(a) {
+			return r
+		}
+	}
+	return s.limitRule(a)
+}
+
+func (r *AlarmRule) matches(a *model.Attribute) bool {
+	return strings.EqualFold(r.Attribute, a.Name) || (a.Parno != "" && strings.EqualFold(r.Attribute, a.Parno))
+}
+
+// limitRule 从模型属性定义的上下限字段生成规则，两个字段都没有时返回 nil
+func (s *AlarmRuleSet) limitRule(a *model.Attribute) *AlarmRule {
+	if s.cache == nil || (s.upperField == "" && s.lowerField == "") {
+		return nil
+	}
+	key := string(a.Kind) + "/" + a.ModelId + "/" + strings.ToLower(a.Name)
+	if r, ok := s.limits[key]; ok {
+		return r
+	}
+
+	var models map[string]map[string]map[string]interface{}
+	if a.Kind == model.AttributeSetItem {
+		models = s.cache.SetItem
+	} else {
+		models = s.cache.Dynamic
+	}
+	var def map[string]interface{}
+	for name, d := range models[a.ModelId] {
+		if strings.EqualFold(name, a.Name) {
+			def = d
+			break
+		}
+	}
+
+	var r *AlarmRule
+	upper, hasUpper := limitValue(def, s.upperField)
+	lower, hasLower := limitValue(def, s.lowerField)
+	if hasUpper || hasLower {
+		t := AlarmThreshold{Severity: s.severity}
+		if hasUpper {
+			t.Above = &upper
+		}
+		if hasLower {
+			t.Below = &lower
+		}
+		r = &AlarmRule{
+			Source:     AlarmRuleSourceLimit,
+			ModelId:    a.ModelId,
+			Attribute:  a.Name,
+			Kind:       AlarmRuleThreshold,
+			Thresholds: []AlarmThreshold{t},
+		}
+	}
+	s.limits[key] = r
+	return r
+}
+
+func limitValue(def map[string]interface{}, field string) (float64, bool) {
+	if def == nil || field == "" {
+		return 0, false
+	}
+	v, ok := def[field]
+	if !ok || v == nil {
+		return 0, false
+	}
+	return numericValue(v)
+}
+
+// AlarmChange 一次评估中告警的变化
+type AlarmChange struct {
+	Type  string      `json:"type"` // raised / updated / cleared
+	Event *AlarmEvent `json:"event"`
+	// PrevSeverity updated 时变化前的级别，用来区分升级和降级
+	PrevSeverity string `json:"prevSeverity,omitempty"`
+	// PrevRootKey updated 时变化前的根因告警
+	PrevRootKey string `json:"prevRootKey,omitempty"`
+}
+
+// 告警变化类型
+const (
+	AlarmRaised  = "raised"
+	AlarmUpdated = "updated"
+)
+
+// AlarmEngine 告警引擎，活动告警保存在内存中，启动时从 alarm_event 表恢复
+type AlarmEngine struct {
+	mu     sync.Mutex
+	active map[string]*AlarmEvent
+}
+
+var (
+	alarmEngine     = &AlarmEngine{}
+	alarmStarted    atomic.Bool
+	alarmListenerMu sync.RWMutex
+	alarmListeners  []func(ctx context.Context, changes []AlarmChange)
+)
+
+// OnAlarmChange 注册告警变化的回调，每次评估后（已写入数据库、已释放引擎锁）调用一次
+func OnAlarmChange(fn func(ctx context.Context, changes []AlarmChange)) {
+	alarmListenerMu.Lock()
+	defer alarmListenerMu.Unlock()
+	alarmListeners = append(alarmListeners, fn)
+}
+
+// StartAlarmEngine 启动告警评估，每 alarm.interval（默认10s）评估一次；alarm.enabled=false 时不启动
+func StartAlarmEngine(ctx context.Context) {
+	if !g.Cfg().MustGet(ctx, "alarm.enabled", true).Bool() {
+		return
+	}
+	if !alarmStarted.CompareAndSwap(false, true) {
+		return
+	}
+	interval := g.Cfg().MustGet(ctx, "alarm.interval", "10s").Duration()
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := alarmEngine.RunOnce(ctx); err != nil {
+				g.Log().Warningf(ctx, "告警评估失败: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ActiveAlarms 当前未消除（包括已确认）的告警，按级别从高到低、产生时间从新到旧排序。
+// includeShelved=false 时不包含搁置中的告警。
+func ActiveAlarms(includeShelved bool) []AlarmEvent {
+	alarmEngine.mu.Lock()
+	defer alarmEngine.mu.Unlock()
+	now := time.Now()
+	list := make([]AlarmEvent, 0, len(alarmEngine.active))
+	for _, ev := range alarmEngine.active {
+		if !includeShelved && ev.Shelved(now) {
+			continue
+		}
+		list = append(list, *ev)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ri, rj := SeverityRank(list[i].Severity), SeverityRank(list[j].Severity)
+		if ri != rj {
+			return ri > rj
+		}
+		return list[i].RaisedAt.After(list[j].RaisedAt)
+	})
+	return list
+}
+
+// RunOnce 评估一次所有台站
+func (e *AlarmEngine) RunOnce(ctx context.Context) error {
+	if err := checkDB(); err != nil {
+		return err
+	}
+
+	cache, err := GetModelCache(ctx)
+	if err != nil {
+		return fmt.Errorf("加载模型缓存失败: %w", err)
+	}
+	rules, err := LoadAlarmRules(ctx)
+	if err != nil {
+		return err
+	}
+	ruleSet := NewAlarmRuleSet(ctx, rules, cache)
+
+	stationIds, err := ListStationIds(ctx)
+	if err != nil {
+		return err
+	}
+	results, _, err := BuildStationTrees(ctx, stationIds)
+	if err != nil {
+		return err
+	}
+
+	// 构造总览和通知回调都不持有锁，确认、搁置等操作不会被一次评估长时间挡住
+	changes, err := e.apply(ctx, results, ruleSet)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+
+	alarmListenerMu.RLock()
+	listeners := alarmListeners
+	alarmListenerMu.RUnlock()
+	for _, fn := range listeners {
+		fn(ctx, changes)
+	}
+	return nil
+}
+
+// apply 在引擎锁内评估、关联并写入告警变化，返回的变化是副本，释放锁后可以交给回调
+func (e *AlarmEngine) apply(ctx context.Context, results []StationTreeResult, ruleSet *AlarmRuleSet) ([]AlarmChange, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.active == nil {
+		active, err := loadActiveAlarms(ctx)
+		if err != nil {
+			return nil, err
+		}
+		e.active = active
+	}
+
+	changes := e.evaluateStations(results, ruleSet, time.Now())
+	changes = e.correlate(ctx, changes)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	if err := saveAlarmChanges(ctx, changes); err != nil {
+		// 写入失败时丢弃内存状态，下次从数据库重新加载，保证两边一致
+		e.active = nil
+		return nil, err
+	}
+	for _, ch := range changes {
+		if ch.Type == AlarmRaised {
+			if cur, ok := e.active[ch.Event.AlarmKey]; ok {
+				cur.Id = ch.Event.Id
+			}
+		}
+	}
+	return changes, nil
+}
+
+// evaluateStations 评估构造好的台站总览树，返回告警的变化。调用方持有 e.mu。
+// 取不到值的属性不改变告警状态，构造失败的台站跳过；只有节点、属性或模型已经不在树上的告警才消除。
+func (e *AlarmEngine) evaluateStations(results []StationTreeResult, rules *AlarmRuleSet, now time.Time) []AlarmChange {
+	changes := make([]AlarmChange, 0)
+	for _, res := range results {
+		if res.Err != nil || res.Tree == nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		res.Tree.Root.Walk(func(n *model.Node) bool {
+			path := n.PathString()
+			for _, name := range n.AttributeNames() {
+				a := n.Attributes[name]
+				seen[AlarmKey(res.StationId, path, a.Name)] = true
+				if ch := e.evaluate(res.StationId, path, a, rules, now); ch != nil {
+					changes = append(changes, *ch)
+				}
+			}
+			return true
+		})
+		changes = append(changes, e.clearStale(res.StationId, seen, now)...)
+	}
+	return changes
+}
+
+// evaluate 判断一个属性，返回告警的变化，没有变化时返回 nil
+func (e *AlarmEngine) evaluate(stationId, path string, a *model.Attribute, rules *AlarmRuleSet, now time.Time) *AlarmChange {
+	if a == nil || a.Missing {
+		return nil
+	}
+	key := AlarmKey(stationId, path, a.Name)
+	cur := e.active[key]
+	rule := rules.Match(a)
+	severity := ""
+	if rule != nil {
+		current := ""
+		if cur != nil {
+			current = cur.Severity
+		}
+		severity = rule.Evaluate(a.Raw, current)
+	}
+	value := gconv.String(a.Raw)
+
+	switch {
+	case severity == "" && cur == nil:
+		return nil
+	case severity == "":
+		delete(e.active, key)
+		cleared := *cur
+		cleared.State, cleared.Value, cleared.ClearedAt, cleared.UpdatedAt = AlarmCleared, value, &now, now
+		return &AlarmChange{Type: AlarmCleared, Event: &cleared}
+	case cur == nil:
+		ev := &AlarmEvent{
+			AlarmKey:   key,
+			StationId:  stationId,
+			Path:       path,
+			Attribute:  a.Name,
+			PositionId: a.PositionId,
+			Parno:      a.Parno,
+			RuleId:     rule.Id,
+			RuleSource: rule.Source,
+			Severity:   severity,
+			Value:      value,
+			Message:    alarmMessage(rule, a, value),
+			State:      AlarmActive,
+			RaisedAt:   now,
+			UpdatedAt:  now,
+		}
+		e.active[key] = ev
+		copied := *ev
+		return &AlarmChange{Type: AlarmRaised, Event: &copied}
+	case severity != cur.Severity:
+		if cur.State == AlarmAcked && SeverityRank(severity) > SeverityRank(cur.Severity) {
+			// 已确认的告警升级后需要重新确认
+			cur.State, cur.AckedBy, cur.AckedAt = AlarmActive, "", nil
+		}
+		prev := cur.Severity
+		cur.Severity, cur.Value, cur.UpdatedAt = severity, value, now
+		cur.RuleId, cur.RuleSource, cur.Message = rule.Id, rule.Source, alarmMessage(rule, a, value)
+		copied := *cur
+		return &AlarmChange{Type: AlarmUpdated, Event: &copied, PrevSeverity: prev}
+	}
+	// 级别不变只更新内存中的当前值，不写库
+	cur.Value = value
+	return nil
+}
+
+// clearStale 消除台站中本次没有评估到的活动告警：属性、节点或模型已经不在台站总览树上。
+// 只在台站总览构造成功后调用，构造失败的台站保持原来的告警。
+func (e *AlarmEngine) clearStale(stationId string, seen map[string]bool, now time.Time) []AlarmChange {
+	var changes []AlarmChange
+	for key, cur := range e.active {
+		if cur.StationId != stationId || seen[key] {
+			continue
+		}
+		delete(e.active, key)
+		cleared := *cur
+		cleared.State, cleared.ClearedAt, cleared.UpdatedAt = AlarmCleared, &now, now
+		changes = append(changes, AlarmChange{Type: AlarmCleared, Event: &cleared})
+	}
+	return changes
+}
+
+func alarmMessage(rule *AlarmRule, a *model.Attribute, value string) string {
+	if rule.Message != "" {
+		return rule.Message
+	}
+	name := rule.Name
+	if name == "" {
+		name = a.Name
+	}
+	return fmt.Sprintf("%s 异常，当前值 %s", name, value)
+}
+
+// LoadAlarmRules 读取 alarm_rule 表中启用的规则
+func LoadAlarmRules(ctx context.Context) ([]*AlarmRule, error) {
+	res, err := db.PgDB.Query(ctx, `SELECT id, name, model_id, position_id, attribute, kind, thresholds, states, deadband, message
+		FROM `+AlarmRuleTable+` WHERE enabled ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("查询告警规则失败: %w", err)
+	}
+	rules := make([]*AlarmRule, 0, len(res))
+	for _, row := range res {
+		r := &AlarmRule{
+			Id:         row["id"].Int64(),
+			Name:       row["name"].String(),
+			ModelId:    row["model_id"].String(),
+			PositionId: row["position_id"].String(),
+			Attribute:  row["attribute"].String(),
+			Kind:       row["kind"].String(),
+			Deadband:   row["deadband"].Float64(),
+			Message:    row["message"].String(),
+		}
+		r.Source = AlarmRuleSourceModel
+		if r.PositionId != "" {
+			r.Source = AlarmRuleSourcePosition
+		}
+		if s := row["thresholds"].String(); s != "" {
+			if err := json.Unmarshal([]byte(s), &r.Thresholds); err != nil {
+				g.Log().Warningf(ctx, "告警规则 %d 的 thresholds 格式错误，已忽略: %v", r.Id, err)
+				continue
+			}
+		}
+		if s := row["states"].String(); s != "" {
+			if err := json.Unmarshal([]byte(s), &r.States); err != nil {
+				g.Log().Warningf(ctx, "告警规则 %d 的 states 格式错误，已忽略: %v", r.Id, err)
+				continue
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
@@ -0,0 +1,263 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 告警的人工操作：确认、备注、搁置和取消搁置。
+// 每次操作都写一条 alarm_action 记录，并通过 InsertLog 写入日志服务（positionId 为告警的工位号）。
+// 操作持有告警引擎的锁，和评估过程互斥，内存中的活动告警与数据库保持一致。
+
+// 操作类型
+const (
+	AlarmActionAck      = "ack"
+	AlarmActionComment  = "comment"
+	AlarmActionShelve   = "shelve"
+	AlarmActionUnshelve = "unshelve"
+)
+
+var (
+	// ErrAlarmNotFound 告警不存在
+	ErrAlarmNotFound = errors.New("告警不存在")
+	// ErrAlarmTransition 告警当前状态不允许该操作
+	ErrAlarmTransition = errors.New("告警当前状态不允许该操作")
+	// ErrAlarmInvalid 操作参数不合法
+	ErrAlarmInvalid = errors.New("告警操作参数不合法")
+)
+
+// 操作人和备注的最大长度（字符），和 alarm_action 表的字段一致
+const (
+	alarmActionUserLen    = 64
+	alarmActionCommentLen = 512
+)
+
+// alarmApply 检查告警当前状态并修改，返回要更新的 SET 子句和参数
+type alarmApply func(ev *AlarmEvent, now time.Time) (set string, args []interface{}, err error)
+
+// AlarmAction 一条操作记录
+type AlarmAction struct {
+	Id           int64      `json:"id"`
+	AlarmId      int64      `json:"alarmId"`
+	Action       string     `json:"action"`
+	UserId       string     `json:"userId"`
+	Comment      string     `json:"comment"`
+	ShelvedUntil *time.Time `json:"shelvedUntil,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// AckAlarm 确认告警：active → acked
+func AckAlarm(ctx context.Context, alarmId int64, userId, comment string) (*AlarmEvent, error) {
+	return alarmEngine.transition(ctx, alarmId, AlarmAction{Action: AlarmActionAck, UserId: userId, Comment: comment}, applyAck(userId))
+}
+
+func applyAck(userId string) alarmApply {
+	return func(ev *AlarmEvent, now time.Time) (string, []interface{}, error) {
+		if ev.State != AlarmActive {
+			return "", nil, fmt.Errorf("%w：告警状态为 %s，只有 active 的告警可以确认", ErrAlarmTransition, ev.State)
+		}
+		ev.State, ev.AckedBy, ev.AckedAt = AlarmAcked, userId, &now
+		return `state = ?, acked_by = ?, acked_at = ?`, []interface{}{ev.State, userId, now}, nil
+	}
+}
+
+// CommentAlarm 给告警加备注，任何状态都可以
+func CommentAlarm(ctx context.Context, alarmId int64, userId, comment string) (*AlarmEvent, error) {
+	if comment == "" {
+		return nil, fmt.Errorf("%w：备注内容不能为空", ErrAlarmInvalid)
+	}
+	return alarmEngine.transition(ctx, alarmId, AlarmAction{Action: AlarmActionComment, UserId: userId, Comment: comment}, nil)
+}
+
+// ShelveAlarm 搁置告警到 until，期间不出现在活动告警列表中，也不发通知；已消除的告警不能搁置
+func ShelveAlarm(ctx context.Context, alarmId int64, userId string, until time.Time, comment string) (*AlarmEvent, error) {
+	if !until.After(time.Now()) {
+		return nil, fmt.Errorf("%w：搁置截止时间必须晚于当前时间", ErrAlarmInvalid)
+	}
+	return alarmEngine.transition(ctx, alarmId, AlarmAction{Action: AlarmActionShelve, UserId: userId, Comment: comment, ShelvedUntil: &until},
+		applyShelve(userId, until))
+}
+
+func applyShelve(userId string, until time.Time) alarmApply {
+	return func(ev *AlarmEvent, now time.Time) (string, []interface{}, error) {
+		if ev.State == AlarmCleared {
+			return "", nil, fmt.Errorf("%w：告警已消除，不能搁置", ErrAlarmTransition)
+		}
+		ev.ShelvedBy, ev.ShelvedUntil = userId, &until
+		return `shelved_by = ?, shelved_until = ?`, []interface{}{userId, until}, nil
+	}
+}
+
+// UnshelveAlarm 取消搁置
+func UnshelveAlarm(ctx context.Context, alarmId int64, userId, comment string) (*AlarmEvent, error) {
+	return alarmEngine.transition(ctx, alarmId, AlarmAction{Action: AlarmActionUnshelve, UserId: userId, Comment: comment}, applyUnshelve)
+}
+
+func applyUnshelve(ev *AlarmEvent, now time.Time) (string, []interface{}, error) {
+	if !ev.Shelved(now) {
+		return "", nil, fmt.Errorf("%w：告警没有处于搁置中", ErrAlarmTransition)
+	}
+	ev.ShelvedBy, ev.ShelvedUntil = "", nil
+	return `shelved_by = '', shelved_until = NULL`, nil, nil
+}
+
+// checkAlarmAction 检查操作人和备注：必须有操作人，长度不能超过表字段
+func checkAlarmAction(action AlarmAction) error {
+	switch {
+	case action.UserId == "":
+		return fmt.Errorf("%w：缺少操作人", ErrAlarmInvalid)
+	case utf8.RuneCountInString(action.UserId) > alarmActionUserLen:
+		return fmt.Errorf("%w：操作人不能超过 %d 个字符", ErrAlarmInvalid, alarmActionUserLen)
+	case utf8.RuneCountInString(action.Comment) > alarmActionCommentLen:
+		return fmt.Errorf("%w：备注不能超过 %d 个字符", ErrAlarmInvalid, alarmActionCommentLen)
+	}
+	return nil
+}
+
+// transition 读取告警、检查并修改状态、写入操作记录，成功后同步内存中的活动告警，释放引擎锁后写日志。
+// apply 为 nil 时只记录操作。
+func (e *AlarmEngine) transition(ctx context.Context, alarmId int64, action AlarmAction, apply alarmApply) (*AlarmEvent, error) {
+	if err := checkAlarmAction(action); err != nil {
+		return nil, err
+	}
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+
+	ev, err := e.applyTransition(ctx, alarmId, action, apply)
+	if err != nil {
+		return nil, err
+	}
+	// 日志服务在锁外异步写入，日志服务慢或不可用时不拖住操作请求和告警评估
+	go logAlarmAction(context.WithoutCancel(ctx), ev, action)
+	return ev, nil
+}
+
+// applyTransition 在引擎锁内读取告警、修改状态并同步内存中的活动告警，返回修改后的告警
+func (e *AlarmEngine) applyTransition(ctx context.Context, alarmId int64, action AlarmAction, apply alarmApply) (*AlarmEvent, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	row, err := db.PgDB.GetOne(ctx, `SELECT `+alarmEventColumns+` FROM `+AlarmEventTable+` WHERE id = ?`, alarmId)
+	if err != nil {
+		return nil, fmt.Errorf("查询告警失败: %w", err)
+	}
+	if row.IsEmpty() {
+		return nil, ErrAlarmNotFound
+	}
+	ev := alarmEventFromRecord(row)
+
+	now := time.Now()
+	var (
+		set  string
+		args []interface{}
+	)
+	if apply != nil {
+		if set, args, err = apply(ev, now); err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.PgDB.Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		if set != "" {
+			if _, err := tx.Exec(`UPDATE `+AlarmEventTable+` SET `+set+`, updated_at = ? WHERE id = ?`,
+				append(args, now, alarmId)...); err != nil {
+				return err
+			}
+			ev.UpdatedAt = now
+		}
+		_, err := tx.Exec(`INSERT INTO `+AlarmActionTable+` (alarm_id, action, user_id, comment, shelved_until, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			alarmId, action.Action, action.UserId, action.Comment, nullableTime(action.ShelvedUntil), now)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("写入告警操作失败: %w", err)
+	}
+
+	// 内存中的活动告警是评估的依据，和数据库一起更新；引擎还没加载时下次从数据库读取
+	if cur, ok := e.active[ev.AlarmKey]; ok && cur.Id == ev.Id {
+		cur.State, cur.AckedBy, cur.AckedAt = ev.State, ev.AckedBy, ev.AckedAt
+		cur.ShelvedBy, cur.ShelvedUntil, cur.UpdatedAt = ev.ShelvedBy, ev.ShelvedUntil, ev.UpdatedAt
+	}
+	return ev, nil
+}
+
+// alarmLogTimeout 写日志服务的超时时间
+const alarmLogTimeout = 5 * time.Second
+
+// logAlarmAction 操作写入日志服务，日志服务不可用不影响操作本身
+func logAlarmAction(ctx context.Context, ev *AlarmEvent, action AlarmAction) {
+	ctx, cancel := context.WithTimeout(ctx, alarmLogTimeout)
+	defer cancel()
+
+	content := fmt.Sprintf("告警%s - 告警ID: %d, 台站: %s, 节点: %s, 属性: %s, 级别: %s, 状态: %s",
+		alarmActionName(action.Action), ev.Id, ev.StationId, ev.Path, ev.Attribute, ev.Severity, ev.State)
+	if action.ShelvedUntil != nil {
+		content += ", 搁置到: " + action.ShelvedUntil.Format("2006-01-02 15:04:05")
+	}
+	if action.Comment != "" {
+		content += ", 备注: " + action.Comment
+	}
+	_, err := InsertLog(ctx, LogInsertParams{
+		LogType:     "info",
+		Level:       "info",
+		Status:      "NORMAL",
+		ChildSystem: "AlarmSystem",
+		Module:      "Alarm",
+		PositionId:  ev.PositionId,
+		LogContent:  content,
+		LogUser:     action.UserId,
+		LogTime:     time.Now().Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		g.Log().Warningf(ctx, "告警操作写入日志服务失败: %v", err)
+	}
+}
+
+func alarmActionName(action string) string {
+	switch action {
+	case AlarmActionAck:
+		return "确认"
+	case AlarmActionComment:
+		return "备注"
+	case AlarmActionShelve:
+		return "搁置"
+	case AlarmActionUnshelve:
+		return "取消搁置"
+	}
+	return action
+}
+
+// AlarmActions 告警的操作记录，按时间顺序
+func AlarmActions(ctx context.Context, alarmId int64) ([]AlarmAction, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	res, err := db.PgDB.GetAll(ctx, `SELECT id, alarm_id, action, user_id, comment, shelved_until, created_at
+		FROM `+AlarmActionTable+` WHERE alarm_id = ? ORDER BY created_at, id`, alarmId)
+	if err != nil {
+		return nil, fmt.Errorf("查询告警操作记录失败: %w", err)
+	}
+	list := make([]AlarmAction, 0, len(res))
+	for _, row := range res {
+		list = append(list, AlarmAction{
+			Id:           row["id"].Int64(),
+			AlarmId:      row["alarm_id"].Int64(),
+			Action:       row["action"].String(),
+			UserId:       row["user_id"].String(),
+			Comment:      row["comment"].String(),
+			ShelvedUntil: recordTime(row["shelved_until"]),
+			CreatedAt:    row["created_at"].Time(),
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,101 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyAck(t *testing.T) {
+	now := time.Now()
+	ev := &AlarmEvent{State: AlarmActive}
+	if _, _, err := applyAck("u1")(ev, now); err != nil {
+		t.Fatalf("确认 active 的告警失败: %v", err)
+	}
+	if ev.State != AlarmAcked || ev.AckedBy != "u1" || ev.AckedAt == nil || !ev.AckedAt.Equal(now) {
+		t.Fatalf("确认后告警为 %+v", ev)
+	}
+
+	for _, state := range []string{AlarmAcked, AlarmCleared} {
+		ev := &AlarmEvent{State: state, AckedBy: "u0"}
+		if _, _, err := applyAck("u1")(ev, now); !errors.Is(err, ErrAlarmTransition) {
+			t.Errorf("确认 %s 的告警应返回 ErrAlarmTransition，实际为 %v", state, err)
+		}
+		if ev.State != state || ev.AckedBy != "u0" {
+			t.Errorf("确认失败时不应修改告警: %+v", ev)
+		}
+	}
+}
+
+func TestApplyShelve(t *testing.T) {
+	now := time.Now()
+	until := now.Add(time.Hour)
+	ev := &AlarmEvent{State: AlarmAcked}
+	if _, _, err := applyShelve("u1", until)(ev, now); err != nil {
+		t.Fatalf("搁置 acked 的告警失败: %v", err)
+	}
+	if !ev.Shelved(now) || ev.ShelvedBy != "u1" {
+		t.Fatalf("搁置后告警为 %+v", ev)
+	}
+	if _, _, err := applyShelve("u1", until)(&AlarmEvent{State: AlarmCleared}, now); !errors.Is(err, ErrAlarmTransition) {
+		t.Errorf("搁置已消除的告警应返回 ErrAlarmTransition，实际为 %v", err)
+	}
+
+	// 截止时间已过在读取告警之前拒绝
+	if _, err := ShelveAlarm(context.Background(), 1, "u1", now.Add(-time.Minute), ""); !errors.Is(err, ErrAlarmInvalid) {
+		t.Errorf("搁置截止时间已过应返回 ErrAlarmInvalid，实际为 %v", err)
+	}
+}
+
+func TestApplyUnshelve(t *testing.T) {
+	now := time.Now()
+	until := now.Add(time.Hour)
+	ev := &AlarmEvent{State: AlarmActive, ShelvedBy: "u1", ShelvedUntil: &until}
+	if _, _, err := applyUnshelve(ev, now); err != nil {
+		t.Fatalf("取消搁置失败: %v", err)
+	}
+	if ev.ShelvedUntil != nil || ev.ShelvedBy != "" {
+		t.Fatalf("取消搁置后告警为 %+v", ev)
+	}
+
+	expired := now.Add(-time.Minute)
+	for name, ev := range map[string]*AlarmEvent{
+		"没有搁置":  {State: AlarmActive},
+		"搁置已到期": {State: AlarmActive, ShelvedUntil: &expired},
+	} {
+		if _, _, err := applyUnshelve(ev, now); !errors.Is(err, ErrAlarmTransition) {
+			t.Errorf("%s: 取消搁置应返回 ErrAlarmTransition，实际为 %v", name, err)
+		}
+	}
+}
+
+func TestCheckAlarmAction(t *testing.T) {
+	cases := []struct {
+		name   string
+		action AlarmAction
+		ok     bool
+	}{
+		{"正常", AlarmAction{UserId: "u1", Comment: "已通知值班员"}, true},
+		{"没有操作人", AlarmAction{Comment: "x"}, false},
+		{"操作人64个字符", AlarmAction{UserId: strings.Repeat("用", 64)}, true},
+		{"操作人超长", AlarmAction{UserId: strings.Repeat("u", 65)}, false},
+		{"备注512个字符", AlarmAction{UserId: "u1", Comment: strings.Repeat("备", 512)}, true},
+		{"备注超长", AlarmAction{UserId: "u1", Comment: strings.Repeat("备", 513)}, false},
+	}
+	for _, c := range cases {
+		err := checkAlarmAction(c.action)
+		if c.ok && err != nil {
+			t.Errorf("%s: 不应返回错误，实际为 %v", c.name, err)
+		}
+		if !c.ok && !errors.Is(err, ErrAlarmInvalid) {
+			t.Errorf("%s: 应返回 ErrAlarmInvalid，实际为 %v", c.name, err)
+		}
+	}
+
+	// 参数不合法时在访问数据库之前返回
+	if _, err := AckAlarm(context.Background(), 1, "", ""); !errors.Is(err, ErrAlarmInvalid) {
+		t.Errorf("没有操作人时 AckAlarm 应返回 ErrAlarmInvalid，实际为 %v", err)
+	}
+}
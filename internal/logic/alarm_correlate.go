@@ -0,0 +1,172 @@
+package logic
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 告警的拓扑关联。
+// 台站供电或上级设备故障时，station_node 树上它下面的节点往往同时告警。每次评估后按节点路径（由 parent_node_id 构造）
+// 把子孙节点的告警归到祖先节点上最上层的活动告警（根因告警）下：
+//   - 子孙告警的 RootKey 记录根因告警的 AlarmKey，AlarmGroups 接口按它把一组告警显示为一个事件；
+//   - alarm.correlation.suppress=true（默认）时子孙告警标记为 suppressed，不再单独发通知；
+//     根因告警消除后仍然存在的子孙告警重新成为独立的告警，此时补发通知。
+//
+// 同一个节点上有多个告警时，级别最高、产生最早的一个作为该节点的代表，其余归到它所在的组。
+// alarm.correlation.enabled=false 时不做关联。
+
+// correlate 重新计算活动告警的根因，根因或抑制状态变化的告警追加到 changes 中（已在 changes 中的直接修改）
+func (e *AlarmEngine) correlate(ctx context.Context, changes []AlarmChange) []AlarmChange {
+	roots := map[string]string{}
+	if g.Cfg().MustGet(ctx, "alarm.correlation.enabled", true).Bool() {
+		roots = correlateAlarms(e.active)
+	}
+	suppress := g.Cfg().MustGet(ctx, "alarm.correlation.suppress", true).Bool()
+
+	index := make(map[string]int, len(changes))
+	for i, ch := range changes {
+		index[ch.Event.AlarmKey] = i
+	}
+	keys := make([]string, 0, len(e.active))
+	for key := range e.active {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ev := e.active[key]
+		root := roots[key]
+		suppressed := suppress && root != ""
+		if ev.RootKey == root && ev.Suppressed == suppressed {
+			continue
+		}
+		prevRoot := ev.RootKey
+		ev.RootKey, ev.Suppressed = root, suppressed
+		if i, ok := index[key]; ok {
+			changes[i].Event.RootKey, changes[i].Event.Suppressed = root, suppressed
+			changes[i].PrevRootKey = prevRoot
+			continue
+		}
+		copied := *ev
+		changes = append(changes, AlarmChange{Type: AlarmUpdated, Event: &copied, PrevSeverity: ev.Severity, PrevRootKey: prevRoot})
+	}
+	return changes
+}
+
+// correlateAlarms 计算每条告警的根因告警，返回 AlarmKey → 根因 AlarmKey，自身是根因的不在结果中
+func correlateAlarms(active map[string]*AlarmEvent) map[string]string {
+	// 台站 → 节点路径 → 该节点的代表告警
+	byNode := make(map[string]map[string]*AlarmEvent)
+	for _, ev := range active {
+		nodes := byNode[ev.StationId]
+		if nodes == nil {
+			nodes = make(map[string]*AlarmEvent)
+			byNode[ev.StationId] = nodes
+		}
+		if cur := nodes[ev.Path]; cur == nil || alarmOutranks(ev, cur) {
+			nodes[ev.Path] = ev
+		}
+	}
+
+	roots := make(map[string]string)
+	memo := make(map[string]string) // AlarmKey → 最上层的根因，自身是根因时为自身
+	var rootOf func(ev *AlarmEvent) string
+	rootOf = func(ev *AlarmEvent) string {
+		if r, ok := memo[ev.AlarmKey]; ok {
+			return r
+		}
+		r := ev.AlarmKey
+		if rep := byNode[ev.StationId][ev.Path]; rep != ev {
+			r = rootOf(rep)
+		} else if parent := nearestAncestorAlarm(byNode[ev.StationId], ev.Path); parent != nil {
+			r = rootOf(parent)
+		}
+		memo[ev.AlarmKey] = r
+		return r
+	}
+	for key, ev := range active {
+		if r := rootOf(ev); r != key {
+			roots[key] = r
+		}
+	}
+	return roots
+}
+
+// nearestAncestorAlarm 沿路径向上找最近的有告警的祖先节点，不包括节点自身；根节点的路径为空
+func nearestAncestorAlarm(nodes map[string]*AlarmEvent, path string) *AlarmEvent {
+	for path != "" {
+		i := strings.LastIndex(path, "/")
+		if i < 0 {
+			path = ""
+		} else {
+			path = path[:i]
+		}
+		if ev := nodes[path]; ev != nil {
+			return ev
+		}
+	}
+	return nil
+}
+
+// alarmOutranks a 是否比 b 更适合作为节点上的代表告警：级别高、产生早，最后按 AlarmKey 保证结果稳定
+func alarmOutranks(a, b *AlarmEvent) bool {
+	if ra, rb := SeverityRank(a.Severity), SeverityRank(b.Severity); ra != rb {
+		return ra > rb
+	}
+	if !a.RaisedAt.Equal(b.RaisedAt) {
+		return a.RaisedAt.Before(b.RaisedAt)
+	}
+	return a.AlarmKey < b.AlarmKey
+}
+
+// AlarmGroup 一个根因告警和归到它下面的告警
+type AlarmGroup struct {
+	RootKey   string       `json:"rootKey"`
+	StationId string       `json:"stationId"`
+	Severity  string       `json:"severity"` // 组内最高级别
+	Count     int          `json:"count"`    // 组内告警总数（包括根因）
+	Root      AlarmEvent   `json:"root"`
+	Children  []AlarmEvent `json:"children"`
+}
+
+// ActiveAlarmGroups 当前活动告警按根因分组，stationId 为空表示所有台站。
+// 根因告警被搁置而不在列表中时，它下面的告警各自成组。
+func ActiveAlarmGroups(stationId string, includeShelved bool) []AlarmGroup {
+	list := ActiveAlarms(includeShelved)
+	groups := make([]AlarmGroup, 0)
+	index := make(map[string]int)
+	for _, ev := range list {
+		if stationId != "" && ev.StationId != stationId || ev.RootKey != "" {
+			continue
+		}
+		index[ev.AlarmKey] = len(groups)
+		groups = append(groups, AlarmGroup{RootKey: ev.AlarmKey, StationId: ev.StationId, Severity: ev.Severity, Count: 1, Root: ev})
+	}
+	for _, ev := range list {
+		if stationId != "" && ev.StationId != stationId || ev.RootKey == "" {
+			continue
+		}
+		i, ok := index[ev.RootKey]
+		if !ok {
+			index[ev.AlarmKey] = len(groups)
+			groups = append(groups, AlarmGroup{RootKey: ev.AlarmKey, StationId: ev.StationId, Severity: ev.Severity, Count: 1, Root: ev})
+			continue
+		}
+		grp := &groups[i]
+		grp.Children = append(grp.Children, ev)
+		grp.Count++
+		if SeverityRank(ev.Severity) > SeverityRank(grp.Severity) {
+			grp.Severity = ev.Severity
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		ri, rj := SeverityRank(groups[i].Severity), SeverityRank(groups[j].Severity)
+		if ri != rj {
+			return ri > rj
+		}
+		return groups[i].Root.RaisedAt.After(groups[j].Root.RaisedAt)
+	})
+	return groups
+}
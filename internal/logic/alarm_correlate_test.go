@@ -0,0 +1,97 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCorrelateAlarms(t *testing.T) {
+	base := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	alarm := func(station, path, attr, severity string, raisedMinute int) *AlarmEvent {
+		return &AlarmEvent{AlarmKey: station + "/" + path + "/" + attr, StationId: station, Path: path, Attribute: attr,
+			Severity: severity, RaisedAt: base.Add(time.Duration(raisedMinute) * time.Minute)}
+	}
+	list := []*AlarmEvent{
+		alarm("0101", "发射机", "Status", SeverityCritical, 0),
+		alarm("0101", "发射机/1号机", "Power", SeverityMajor, 1),
+		alarm("0101", "发射机/1号机", "Temp", SeverityMinor, 0),
+		alarm("0101", "发射机/1号机/功放", "Current", SeverityCritical, 2),
+		alarm("0101", "天线", "VSWR", SeverityMajor, 3),
+		alarm("0101", "天线/馈线", "Loss", SeverityWarning, 4),
+		// 同一节点级别相同时先产生的是代表告警
+		alarm("0101", "电源", "A", SeverityMinor, 5),
+		alarm("0101", "电源", "B", SeverityMinor, 4),
+		// 其他台站相同路径互不影响
+		alarm("0102", "发射机/1号机", "Power", SeverityMajor, 0),
+		// 中间节点没有告警时归到更上层的祖先
+		alarm("0103", "发射机", "Status", SeverityMajor, 0),
+		alarm("0103", "发射机/1号机/功放", "Current", SeverityMajor, 1),
+	}
+	active := make(map[string]*AlarmEvent, len(list))
+	for _, ev := range list {
+		active[ev.AlarmKey] = ev
+	}
+
+	want := map[string]string{
+		"0101/发射机/1号机/Power":      "0101/发射机/Status",
+		"0101/发射机/1号机/Temp":       "0101/发射机/Status",
+		"0101/发射机/1号机/功放/Current": "0101/发射机/Status",
+		"0101/天线/馈线/Loss":         "0101/天线/VSWR",
+		"0101/电源/A":               "0101/电源/B",
+		"0103/发射机/1号机/功放/Current": "0103/发射机/Status",
+	}
+	if got := correlateAlarms(active); !reflect.DeepEqual(got, want) {
+		t.Errorf("correlateAlarms:\n got  %v\n want %v", got, want)
+	}
+	if got := correlateAlarms(map[string]*AlarmEvent{}); len(got) != 0 {
+		t.Errorf("没有告警时应为空，得到 %v", got)
+	}
+}
+
+func TestAlarmOutranks(t *testing.T) {
+	base := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		a, b AlarmEvent
+		want bool
+	}{
+		{"级别高", AlarmEvent{AlarmKey: "b", Severity: SeverityMajor, RaisedAt: base.Add(time.Minute)},
+			AlarmEvent{AlarmKey: "a", Severity: SeverityMinor, RaisedAt: base}, true},
+		{"级别低", AlarmEvent{AlarmKey: "a", Severity: SeverityWarning, RaisedAt: base},
+			AlarmEvent{AlarmKey: "b", Severity: SeverityMinor, RaisedAt: base}, false},
+		{"级别相同时产生早", AlarmEvent{AlarmKey: "b", Severity: SeverityMinor, RaisedAt: base},
+			AlarmEvent{AlarmKey: "a", Severity: SeverityMinor, RaisedAt: base.Add(time.Second)}, true},
+		{"都相同时按 AlarmKey", AlarmEvent{AlarmKey: "a", Severity: SeverityMinor, RaisedAt: base},
+			AlarmEvent{AlarmKey: "b", Severity: SeverityMinor, RaisedAt: base}, true},
+	}
+	for _, c := range cases {
+		if got := alarmOutranks(&c.a, &c.b); got != c.want {
+			t.Errorf("%s: alarmOutranks = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNearestAncestorAlarm(t *testing.T) {
+	root := &AlarmEvent{AlarmKey: "root"}
+	tx := &AlarmEvent{AlarmKey: "tx"}
+	nodes := map[string]*AlarmEvent{"": root, "发射机": tx}
+	cases := []struct {
+		path string
+		want *AlarmEvent
+	}{
+		{"发射机/1号机/功放", tx},
+		{"发射机/1号机", tx},
+		{"发射机", root},
+		{"天线", root},
+		{"", nil},
+	}
+	for _, c := range cases {
+		if got := nearestAncestorAlarm(nodes, c.path); got != c.want {
+			t.Errorf("nearestAncestorAlarm(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+	if got := nearestAncestorAlarm(map[string]*AlarmEvent{"发射机": tx}, "天线/馈线"); got != nil {
+		t.Errorf("没有祖先告警时应为 nil，得到 %v", got)
+	}
+}
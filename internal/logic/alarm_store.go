@@ -0,0 +1,225 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/container/gvar"
+	"github.com/gogf/gf/v2/database/gdb"
+)
+
+// 告警规则和告警记录在 PostgreSQL 中的存储，表结构见 manifest/sql 中的 0002_alarm.sql、0003_alarm_ack.sql、0005_alarm_correlation.sql
+
+// 表名
+const (
+	AlarmRuleTable   = "alarm_rule"
+	AlarmEventTable  = "alarm_event"
+	AlarmActionTable = "alarm_action" // 确认、备注、搁置等操作记录
+)
+
+const alarmEventColumns = `id, alarm_key, station_id, path, attribute, position_id, parno, rule_id, rule_source,
+	severity, value, message, state, raised_at, updated_at, cleared_at, acked_by, acked_at, shelved_by, shelved_until,
+	root_key, suppressed`
+
+func alarmEventFromRecord(row gdb.Record) *AlarmEvent {
+	ev := &AlarmEvent{
+		Id:         row["id"].Int64(),
+		AlarmKey:   row["alarm_key"].String(),
+		StationId:  row["station_id"].String(),
+		Path:       row["path"].String(),
+		Attribute:  row["attribute"].String(),
+		PositionId: row["position_id"].String(),
+		Parno:      row["parno"].String(),
+		RuleId:     row["rule_id"].Int64(),
+		RuleSource: row["rule_source"].String(),
+		Severity:   row["severity"].String(),
+		Value:      row["value"].String(),
+		Message:    row["message"].String(),
+		State:      row["state"].String(),
+		RaisedAt:   row["raised_at"].Time(),
+		UpdatedAt:  row["updated_at"].Time(),
+	}
+	ev.ClearedAt = recordTime(row["cleared_at"])
+	ev.AckedBy = row["acked_by"].String()
+	ev.AckedAt = recordTime(row["acked_at"])
+	ev.ShelvedBy = row["shelved_by"].String()
+	ev.ShelvedUntil = recordTime(row["shelved_until"])
+	ev.RootKey = row["root_key"].String()
+	ev.Suppressed = row["suppressed"].Bool()
+	return ev
+}
+
+// recordTime 可为空的时间字段
+func recordTime(v *gvar.Var) *time.Time {
+	if v.IsNil() {
+		return nil
+	}
+	t := v.Time()
+	return &t
+}
+
+// nullableTime 写入可为空的时间字段
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// loadActiveAlarms 读取所有未消除的告警，服务重启后接着之前的状态评估
+func loadActiveAlarms(ctx context.Context) (map[string]*AlarmEvent, error) {
+	res, err := db.PgDB.GetAll(ctx, `SELECT `+alarmEventColumns+` FROM `+AlarmEventTable+` WHERE state <> ? ORDER BY id`, AlarmCleared)
+	if err != nil {
+		return nil, fmt.Errorf("查询活动告警失败: %w", err)
+	}
+	active := make(map[string]*AlarmEvent, len(res))
+	for _, row := range res {
+		ev := alarmEventFromRecord(row)
+		active[ev.AlarmKey] = ev
+	}
+	return active, nil
+}
+
+// alarmColumns 按 alarm_event 的列宽截断来自模型和 svr_DATA 的文本，
+// 一个超长的值会让整个事务失败，之后每次评估都重新产生、再次失败，所有台站的告警都写不进去
+type alarmColumns struct {
+	path, attribute, positionId, parno, value, message string
+}
+
+func fitAlarmColumns(ev *AlarmEvent) alarmColumns {
+	return alarmColumns{
+		path:       truncateString(ev.Path, 256),
+		attribute:  truncateString(ev.Attribute, 128),
+		positionId: truncateString(ev.PositionId, 64),
+		parno:      truncateString(ev.Parno, 128),
+		value:      truncateString(ev.Value, 256),
+		message:    truncateString(ev.Message, 512),
+	}
+}
+
+// truncateString 按字符截断，不会切开多字节字符
+func truncateString(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// saveAlarmChanges 在一个事务中写入一次评估的所有变化，新产生的告警回填 Id
+func saveAlarmChanges(ctx context.Context, changes []AlarmChange) error {
+	return db.PgDB.Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		for _, ch := range changes {
+			ev := ch.Event
+			col := fitAlarmColumns(ev)
+			var err error
+			switch ch.Type {
+			case AlarmRaised:
+				var id *gvar.Var
+				id, err = tx.GetValue(`INSERT INTO `+AlarmEventTable+`
+					(alarm_key, station_id, path, attribute, position_id, parno, rule_id, rule_source, severity, value, message, state, raised_at, updated_at,
+					root_key, suppressed)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+					ev.AlarmKey, ev.StationId, col.path, col.attribute, col.positionId, col.parno, ev.RuleId, ev.RuleSource,
+					ev.Severity, col.value, col.message, ev.State, ev.RaisedAt, ev.UpdatedAt, ev.RootKey, ev.Suppressed)
+				if err == nil {
+					ev.Id = id.Int64()
+				}
+			case AlarmUpdated:
+				_, err = tx.Exec(`UPDATE `+AlarmEventTable+` SET severity = ?, value = ?, message = ?, rule_id = ?, rule_source = ?, updated_at = ?,
+					state = ?, acked_by = ?, acked_at = ?, root_key = ?, suppressed = ?
+					WHERE alarm_key = ? AND state <> ?`,
+					ev.Severity, col.value, col.message, ev.RuleId, ev.RuleSource, ev.UpdatedAt,
+					ev.State, ev.AckedBy, nullableTime(ev.AckedAt), ev.RootKey, ev.Suppressed, ev.AlarmKey, AlarmCleared)
+			case AlarmCleared:
+				_, err = tx.Exec(`UPDATE `+AlarmEventTable+` SET state = ?, value = ?, updated_at = ?, cleared_at = ?
+					WHERE alarm_key = ? AND state <> ?`,
+					AlarmCleared, col.value, ev.UpdatedAt, nullableTime(ev.ClearedAt), ev.AlarmKey, AlarmCleared)
+			}
+			if err != nil {
+				return fmt.Errorf("写入告警 %s 失败: %w", ev.AlarmKey, err)
+			}
+		}
+		return nil
+	})
+}
+
+// AlarmQuery 告警历史查询条件，空值表示不限
+type AlarmQuery struct {
+	PositionId string
+	StationId  string
+	RootKey    string // 根因告警的 AlarmKey，查询归到该告警下的告警
+	Severity   string
+	State      string
+	Begin      time.Time
+	End        time.Time
+	PageIndex  int
+	PageSize   int
+}
+
+// QueryAlarmHistory 按产生时间从新到旧分页查询告警记录
+func QueryAlarmHistory(ctx context.Context, q AlarmQuery) (list []*AlarmEvent, total int, err error) {
+	if err := checkDB(); err != nil {
+		return nil, 0, err
+	}
+	if q.PageIndex <= 0 {
+		q.PageIndex = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = 20
+	}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	addCond := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if q.PositionId != "" {
+		addCond("position_id = ?", q.PositionId)
+	}
+	if q.StationId != "" {
+		addCond("station_id = ?", q.StationId)
+	}
+	if q.RootKey != "" {
+		addCond("root_key = ?", q.RootKey)
+	}
+	if q.Severity != "" {
+		addCond("severity = ?", q.Severity)
+	}
+	if q.State != "" {
+		addCond("state = ?", q.State)
+	}
+	if !q.Begin.IsZero() {
+		addCond("raised_at >= ?", q.Begin)
+	}
+	if !q.End.IsZero() {
+		addCond("raised_at <= ?", q.End)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	count, err := db.PgDB.GetValue(ctx, `SELECT COUNT(*) FROM `+AlarmEventTable+where, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询告警记录失败: %w", err)
+	}
+	res, err := db.PgDB.GetAll(ctx, `SELECT `+alarmEventColumns+` FROM `+AlarmEventTable+where+
+		` ORDER BY raised_at DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, q.PageSize, (q.PageIndex-1)*q.PageSize)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询告警记录失败: %w", err)
+	}
+	list = make([]*AlarmEvent, 0, len(res))
+	for _, row := range res {
+		list = append(list, alarmEventFromRecord(row))
+	}
+	return list, count.Int(), nil
+}
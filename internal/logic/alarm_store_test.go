@@ -0,0 +1,40 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFitAlarmColumns(t *testing.T) {
+	long := strings.Repeat("发射机", 400)
+	ev := &AlarmEvent{Path: long, Attribute: long, PositionId: long, Parno: long, Value: long, Message: long}
+	col := fitAlarmColumns(ev)
+	for _, c := range []struct {
+		name  string
+		value string
+		width int
+	}{
+		{"path", col.path, 256},
+		{"attribute", col.attribute, 128},
+		{"position_id", col.positionId, 64},
+		{"parno", col.parno, 128},
+		{"value", col.value, 256},
+		{"message", col.message, 512},
+	} {
+		if n := utf8.RuneCountInString(c.value); n != c.width {
+			t.Errorf("%s 截断后 %d 个字符，应为 %d", c.name, n, c.width)
+		}
+		if !utf8.ValidString(c.value) {
+			t.Errorf("%s 截断后不是有效的 UTF-8", c.name)
+		}
+	}
+	if ev.Value != long {
+		t.Error("截断不应修改内存中的告警")
+	}
+
+	short := &AlarmEvent{Path: "发射机/1号机", Value: "12.5", Message: "功率过高"}
+	if col := fitAlarmColumns(short); col.path != short.Path || col.value != short.Value || col.message != short.Message {
+		t.Errorf("未超长的值不应改变: %+v", col)
+	}
+}
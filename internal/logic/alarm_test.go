@@ -0,0 +1,254 @@
+package logic
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gf_api/internal/model"
+)
+
+func TestClearStaleAlarms(t *testing.T) {
+	now := time.Now()
+	kept := AlarmKey("0101", "发射机/1号机", "Power")
+	gone := AlarmKey("0101", "发射机/2号机", "Power")
+	other := AlarmKey("0102", "发射机/1号机", "Power")
+	e := &AlarmEngine{active: map[string]*AlarmEvent{
+		kept:  {Id: 1, AlarmKey: kept, StationId: "0101", State: AlarmActive},
+		gone:  {Id: 2, AlarmKey: gone, StationId: "0101", State: AlarmAcked},
+		other: {Id: 3, AlarmKey: other, StationId: "0102", State: AlarmActive},
+	}}
+
+	changes := e.clearStale("0101", map[string]bool{kept: true}, now)
+	if len(changes) != 1 {
+		t.Fatalf("应消除 1 条告警，实际 %d 条: %+v", len(changes), changes)
+	}
+	ev := changes[0].Event
+	if changes[0].Type != AlarmCleared || ev.Id != 2 || ev.State != AlarmCleared || ev.ClearedAt == nil || !ev.ClearedAt.Equal(now) {
+		t.Errorf("消除的告警为 %+v", changes[0])
+	}
+	if _, ok := e.active[gone]; ok {
+		t.Errorf("消除的告警仍在活动告警中")
+	}
+	if _, ok := e.active[kept]; !ok {
+		t.Errorf("本次评估到的告警不应消除")
+	}
+	if _, ok := e.active[other]; !ok {
+		t.Errorf("其他台站的告警不应消除")
+	}
+}
+
+func TestEvaluateStationsKeepsMissingAttributes(t *testing.T) {
+	now := time.Now()
+	root := model.NewNode("", nil)
+	tx := root.Child("发射机")
+	tx.SetAttribute(&model.Attribute{Name: "Reflect", Kind: model.AttributeDynamic, ModelId: "tx", PositionId: "0101_01", Missing: true})
+	tx.SetAttribute(&model.Attribute{Name: "Power", Kind: model.AttributeDynamic, ModelId: "tx", PositionId: "0101_01", Raw: "12"})
+	results := []StationTreeResult{
+		{StationId: "0101", Tree: &model.StationTree{StationId: "0101", Root: root}},
+		{StationId: "0102", Err: errors.New("构造失败")},
+	}
+
+	missing := AlarmKey("0101", "发射机", "Reflect")
+	power := AlarmKey("0101", "发射机", "Power")
+	gone := AlarmKey("0101", "发射机", "Fan")
+	failed := AlarmKey("0102", "发射机", "Power")
+	e := &AlarmEngine{active: map[string]*AlarmEvent{
+		missing: {Id: 1, AlarmKey: missing, StationId: "0101", Severity: SeverityMajor, State: AlarmActive},
+		power:   {Id: 2, AlarmKey: power, StationId: "0101", Severity: SeverityMajor, State: AlarmActive},
+		gone:    {Id: 3, AlarmKey: gone, StationId: "0101", Severity: SeverityMajor, State: AlarmActive},
+		failed:  {Id: 4, AlarmKey: failed, StationId: "0102", Severity: SeverityMajor, State: AlarmActive},
+	}}
+	above := 10.0
+	rules := &AlarmRuleSet{
+		byPosition: map[string][]*AlarmRule{},
+		byModel: map[string][]*AlarmRule{"tx": {{Id: 9, Source: AlarmRuleSourceModel, ModelId: "tx", Attribute: "Power",
+			Kind: AlarmRuleThreshold, Thresholds: []AlarmThreshold{{Severity: SeverityMajor, Above: &above}}}}},
+		limits: map[string]*AlarmRule{},
+	}
+
+	changes := e.evaluateStations(results, rules, now)
+	if len(changes) != 1 || changes[0].Type != AlarmCleared || changes[0].Event.AlarmKey != gone {
+		t.Fatalf("只应消除属性已不在树上的告警，得到 %+v", changes)
+	}
+	for _, key := range []string{missing, power, failed} {
+		if _, ok := e.active[key]; !ok {
+			t.Errorf("告警 %s 不应消除", key)
+		}
+	}
+}
+
+func TestAlarmRuleEvaluate(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	threshold := &AlarmRule{
+		Kind:     AlarmRuleThreshold,
+		Deadband: 2,
+		Thresholds: []AlarmThreshold{
+			{Severity: SeverityMajor, Above: f(80), Below: f(10)},
+			{Severity: SeverityCritical, Above: f(90)},
+		},
+	}
+	state := &AlarmRule{Kind: AlarmRuleState, States: map[string]string{" Fault ": SeverityCritical, "warn": SeverityWarning}}
+
+	cases := []struct {
+		name    string
+		rule    *AlarmRule
+		raw     interface{}
+		current string
+		want    string
+	}{
+		{"正常", threshold, "50", "", ""},
+		{"越上限", threshold, "85", "", SeverityMajor},
+		{"越下限", threshold, "5", "", SeverityMajor},
+		{"同时越两级取最高", threshold, "95", "", SeverityCritical},
+		{"从主要升级到严重", threshold, "91", SeverityMajor, SeverityCritical},
+		{"回差内保持主要", threshold, "79", SeverityMajor, SeverityMajor},
+		{"越过回差后恢复", threshold, "77", SeverityMajor, ""},
+		{"下限回差内保持", threshold, "11", SeverityMajor, SeverityMajor},
+		{"下限越过回差后恢复", threshold, "13", SeverityMajor, ""},
+		{"严重在回差内保持", threshold, "89", SeverityCritical, SeverityCritical},
+		{"严重降级为主要", threshold, "85", SeverityCritical, SeverityMajor},
+		{"没有告警时不用回差", threshold, "79", "", ""},
+		{"低级别告警不放宽高级别限值", threshold, "89", SeverityMajor, SeverityMajor},
+		{"非数字", threshold, "abc", SeverityMajor, ""},
+		{"空值", threshold, "", "", ""},
+		{"状态匹配忽略大小写和空格", state, "FAULT", "", SeverityCritical},
+		{"状态匹配", state, "warn", "", SeverityWarning},
+		{"状态不匹配", state, "ok", SeverityCritical, ""},
+	}
+	for _, c := range cases {
+		if got := c.rule.Evaluate(c.raw, c.current); got != c.want {
+			t.Errorf("%s: Evaluate(%v, %q) = %q，期望 %q", c.name, c.raw, c.current, got, c.want)
+		}
+	}
+}
+
+func TestAlarmRuleSetMatch(t *testing.T) {
+	byPosition := &AlarmRule{Id: 1, Source: AlarmRuleSourcePosition, PositionId: "0101_01", Attribute: "power"}
+	byParno := &AlarmRule{Id: 2, Source: AlarmRuleSourcePosition, PositionId: "0101_02", Attribute: "RPower"}
+	byModel := &AlarmRule{Id: 3, Source: AlarmRuleSourceModel, ModelId: "tx", Attribute: "Power"}
+	cache := &ModelCache{
+		Dynamic: map[string]map[string]map[string]interface{}{
+			"tx":  {"Power": {"upper_limit": "100"}, "Temp": {"upper_limit": 60, "lower_limit": "-10"}, "Fan": {"parno": "Fan"}},
+			"ups": {"Voltage": {"lower_limit": 180}},
+		},
+		SetItem: map[string]map[string]map[string]interface{}{
+			"set": {"Target": {"upper_limit": 20}},
+		},
+	}
+	rules := &AlarmRuleSet{
+		byPosition: map[string][]*AlarmRule{"0101_01": {byPosition}, "0101_02": {byParno}},
+		byModel:    map[string][]*AlarmRule{"tx": {byModel}},
+		limits:     map[string]*AlarmRule{},
+		cache:      cache,
+		upperField: "upper_limit",
+		lowerField: "lower_limit",
+		severity:   SeverityMinor,
+	}
+	attr := func(kind model.AttributeKind, modelId, positionId, name, parno string) *model.Attribute {
+		return &model.Attribute{Name: name, Kind: kind, ModelId: modelId, PositionId: positionId, Parno: parno}
+	}
+
+	cases := []struct {
+		name string
+		attr *model.Attribute
+		want *AlarmRule
+	}{
+		{"工位号规则优先", attr(model.AttributeDynamic, "tx", "0101_01", "Power", "Power"), byPosition},
+		{"工位号规则按 parno 匹配", attr(model.AttributeDynamic, "tx", "0101_02", "Power", "RPower"), byParno},
+		{"其他工位用模型规则", attr(model.AttributeDynamic, "tx", "0101_03", "Power", "Power"), byModel},
+		{"静态属性不告警", attr(model.AttributeStatic, "tx", "0101_01", "Power", ""), nil},
+		{"没有规则和上下限", attr(model.AttributeDynamic, "tx", "0101_03", "Fan", "Fan"), nil},
+		{"没有定义的属性", attr(model.AttributeDynamic, "tx", "0101_03", "Unknown", "Unknown"), nil},
+	}
+	for _, c := range cases {
+		if got := rules.Match(c.attr); got != c.want {
+			t.Errorf("%s: Match = %+v，期望 %+v", c.name, got, c.want)
+		}
+	}
+
+	limit := rules.Match(attr(model.AttributeDynamic, "tx", "0101_03", "temp", "Temp"))
+	if limit == nil || limit.Source != AlarmRuleSourceLimit || len(limit.Thresholds) != 1 {
+		t.Fatalf("应从模型上下限生成规则，得到 %+v", limit)
+	}
+	th := limit.Thresholds[0]
+	if th.Severity != SeverityMinor || th.Above == nil || *th.Above != 60 || th.Below == nil || *th.Below != -10 {
+		t.Errorf("上下限规则为 %+v", th)
+	}
+	if again := rules.Match(attr(model.AttributeDynamic, "tx", "0101_04", "Temp", "Temp")); again != limit {
+		t.Errorf("同一模型属性的上下限规则应复用")
+	}
+	if r := rules.Match(attr(model.AttributeSetItem, "set", "0101_03", "target", "Target")); r == nil || *r.Thresholds[0].Above != 20 {
+		t.Errorf("设置项属性应从设置项模型取上下限，得到 %+v", r)
+	}
+	if r := rules.Match(attr(model.AttributeDynamic, "ups", "0101_05", "Voltage", "Voltage")); r == nil ||
+		r.Thresholds[0].Above != nil || *r.Thresholds[0].Below != 180 {
+		t.Errorf("只有下限时只判断下限，得到 %+v", r)
+	}
+}
+
+func TestAlarmEngineEvaluate(t *testing.T) {
+	above, critical := 80.0, 90.0
+	rule := &AlarmRule{Id: 7, Source: AlarmRuleSourceModel, ModelId: "tx", Attribute: "Power", Kind: AlarmRuleThreshold, Deadband: 2,
+		Thresholds: []AlarmThreshold{{Severity: SeverityMajor, Above: &above}, {Severity: SeverityCritical, Above: &critical}}}
+	rules := &AlarmRuleSet{
+		byPosition: map[string][]*AlarmRule{},
+		byModel:    map[string][]*AlarmRule{"tx": {rule}},
+		limits:     map[string]*AlarmRule{},
+	}
+	e := &AlarmEngine{active: map[string]*AlarmEvent{}}
+	key := AlarmKey("0101", "发射机", "Power")
+	now := time.Now()
+	step := func(raw string) *AlarmChange {
+		now = now.Add(time.Second)
+		a := &model.Attribute{Name: "Power", Kind: model.AttributeDynamic, ModelId: "tx", PositionId: "0101_01", Parno: "Power", Raw: raw}
+		return e.evaluate("0101", "发射机", a, rules, now)
+	}
+
+	steps := []struct {
+		raw      string
+		typ      string // 空表示没有变化
+		severity string
+		state    string
+	}{
+		{"50", "", "", ""},
+		{"85", AlarmRaised, SeverityMajor, AlarmActive},
+		{"86", "", SeverityMajor, AlarmActive},
+		{"95", AlarmUpdated, SeverityCritical, AlarmActive},
+		{"89", "", SeverityCritical, AlarmActive},
+		{"85", AlarmUpdated, SeverityMajor, AlarmActive},
+		{"79", "", SeverityMajor, AlarmActive},
+		{"70", AlarmCleared, SeverityMajor, AlarmCleared},
+		{"70", "", "", ""},
+	}
+	for i, s := range steps {
+		ch := step(s.raw)
+		switch {
+		case s.typ == "" && ch != nil:
+			t.Fatalf("第 %d 步 %s 不应有变化，得到 %+v", i, s.raw, ch)
+		case s.typ != "" && (ch == nil || ch.Type != s.typ || ch.Event.Severity != s.severity || ch.Event.State != s.state):
+			t.Fatalf("第 %d 步 %s 应为 %s/%s/%s，得到 %+v", i, s.raw, s.typ, s.severity, s.state, ch)
+		}
+		cur, active := e.active[key]
+		if s.state == "" || s.state == AlarmCleared {
+			if active {
+				t.Fatalf("第 %d 步 %s 后不应有活动告警", i, s.raw)
+			}
+			continue
+		}
+		if !active || cur.Severity != s.severity || cur.Value != s.raw {
+			t.Fatalf("第 %d 步 %s 后活动告警为 %+v", i, s.raw, cur)
+		}
+	}
+
+	// 已确认的告警升级后需要重新确认，降级时保持确认
+	step("85")
+	e.active[key].State, e.active[key].AckedBy = AlarmAcked, "u1"
+	if ch := step("95"); ch == nil || ch.Event.State != AlarmActive || ch.Event.AckedBy != "" || ch.PrevSeverity != SeverityMajor {
+		t.Errorf("升级后应回到 active，得到 %+v", ch)
+	}
+	e.active[key].State, e.active[key].AckedBy = AlarmAcked, "u1"
+	if ch := step("85"); ch == nil || ch.Event.State != AlarmAcked || ch.Event.AckedBy != "u1" {
+		t.Errorf("降级后应保持已确认，得到 %+v", ch)
+	}
+}
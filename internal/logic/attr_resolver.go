@@ -0,0 +1,195 @@
+package logic
+
+import (
+	"context"
+	"strings"
+
+	"gf_api/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// 动态属性和设置项属性的取值规则，所有构造总览的地方都通过 AttributeResolver 取值：
+//  1. 每个节点属性下面都有属性名parno和关联属性名relation_parno；
+//  2. 设变量Num：当关联工位号rPositionId和关联属性relation_parno都有值，则Num=rPositionId；否则Num=positionId；
+//  3. 当is_enable=1时，表示有设备，则Num=positionId；
+//  4. 使用rPositionId时取relation_parno作为key，使用positionId时取parno作为key，在svr_DATA_Num中查值。
+// 每种模型可以在配置 overview.resolve.dynamic / overview.resolve.setitem 中调整，未配置的项保持默认。
+
+// ResolveRule 一种模型的取值规则
+type ResolveRule struct {
+	UseRelation       bool    `json:"useRelation"`       // rPositionId 和 relation_parno 都有值时使用它们（规则2）
+	EnableOverride    bool    `json:"enableOverride"`    // is_enable=1 时强制使用 positionId 和 parno（规则3）
+	IgnoreCase        bool    `json:"ignoreCase"`        // 在 svr_DATA 中查 parno 时不区分大小写
+	LowerName         bool    `json:"lowerName"`         // 输出的属性名转小写
+	FallbackParaValue bool    `json:"fallbackParaValue"` // svr_DATA 中没有值时使用模型里的 para_value
+	Default           *string `json:"default"`           // 仍然没有值时的默认值；不配置时 svr_DATA 不存在则不输出该属性，字段不存在则为空字符串
+}
+
+// ResolveRules 各模型的取值规则
+type ResolveRules struct {
+	Dynamic ResolveRule `json:"dynamic"`
+	SetItem ResolveRule `json:"setitem"`
+}
+
+// DefaultResolveRules 默认规则，和原来各处复制的逻辑一致：
+// 动态属性按原名输出、parno 区分大小写；设置项属性名转小写、parno 不区分大小写。
+func DefaultResolveRules() ResolveRules {
+	return ResolveRules{
+		Dynamic: ResolveRule{UseRelation: true, EnableOverride: true},
+		SetItem: ResolveRule{UseRelation: true, EnableOverride: true, IgnoreCase: true, LowerName: true},
+	}
+}
+
+// LoadResolveRules 读取 overview.resolve 配置，覆盖默认规则中配置了的项
+func LoadResolveRules(ctx context.Context) ResolveRules {
+	rules := DefaultResolveRules()
+	for key, rule := range map[string]*ResolveRule{
+		"overview.resolve.dynamic": &rules.Dynamic,
+		"overview.resolve.setitem": &rules.SetItem,
+	} {
+		v, err := g.Cfg().Get(ctx, key)
+		if err != nil || v.IsNil() {
+			continue
+		}
+		if err := v.Scan(rule); err != nil {
+			g.Log().Warningf(ctx, "解析取值规则 %s 失败，使用默认规则: %v", key, err)
+		}
+	}
+	return rules
+}
+
+// AttributeRef 属性从哪个工位号的哪个字段取值
+type AttributeRef struct {
+	PositionId  string // 实际取值的工位号 Num
+	Parno       string // 实际使用的 parno 或 relation_parno
+	UseRelation bool   // 是否使用了 rPositionId / relation_parno
+}
+
+// AttributeResolver 按规则确定属性的取值位置并取值
+type AttributeResolver struct {
+	Rules ResolveRules
+}
+
+// NewAttributeResolver 创建取值器
+func NewAttributeResolver(rules ResolveRules) *AttributeResolver {
+	return &AttributeResolver{Rules: rules}
+}
+
+var defaultResolver = NewAttributeResolver(DefaultResolveRules())
+
+// CurrentResolver 当前模型缓存使用的取值器，模型缓存不可用时使用默认规则（返回 nil 也按默认规则取值）
+func CurrentResolver(ctx context.Context) *AttributeResolver {
+	if cache, err := GetModelCache(ctx); err == nil {
+		return cache.Resolver
+	}
+	return defaultResolver
+}
+
+// Rule 取某种模型的规则，静态属性不从 svr_DATA 取值，返回零值。
+// r 为 nil（手工构造的模型缓存没有取值器）时使用默认规则。
+func (r *AttributeResolver) Rule(kind model.AttributeKind) ResolveRule {
+	if r == nil {
+		r = defaultResolver
+	}
+	switch kind {
+	case model.AttributeDynamic:
+		return r.Rules.Dynamic
+	case model.AttributeSetItem:
+		return r.Rules.SetItem
+	}
+	return ResolveRule{}
+}
+
+// Name 输出的属性名
+func (r *AttributeResolver) Name(kind model.AttributeKind, attrName string) string {
+	if r.Rule(kind).LowerName {
+		return strings.ToLower(attrName)
+	}
+	return attrName
+}
+
+// Locate 确定属性从哪个 svr_DATA_Num 的哪个字段取值
+func (r *AttributeResolver) Locate(kind model.AttributeKind, attrDef map[string]interface{}, positionId, rPositionId string) AttributeRef {
+	rule := r.Rule(kind)
+	relationParno, _ := attrDef["relation_parno"].(string)
+	parno, _ := attrDef["parno"].(string)
+
+	ref := AttributeRef{PositionId: positionId, Parno: parno}
+	if rule.UseRelation && rPositionId != "" && relationParno != "" {
+		ref = AttributeRef{PositionId: rPositionId, Parno: relationParno, UseRelation: true}
+	}
+	if rule.EnableOverride && isEnabled(attrDef["is_enable"]) {
+		ref = AttributeRef{PositionId: positionId, Parno: parno}
+	}
+	return ref
+}
+
+// isEnabled 和旧版一致，只有 JSON 数字 1 算启用；字符串 "1" 不算，这个字段不一定存在
+func isEnabled(v interface{}) bool {
+	f, ok := v.(float64)
+	return ok && f == 1
+}
+
+// Resolve 从 svr_DATA_Num 的数据中取值，ok=false 表示没有取到（旧版输出中不出现该属性）。
+// 取值顺序：svr_DATA 中的字段 → para_value（FallbackParaValue）→ 默认值（Default）；
+// 都没有时，svr_DATA 存在则为空字符串，不存在则 ok=false。
+func (r *AttributeResolver) Resolve(kind model.AttributeKind, ref AttributeRef, attrDef map[string]interface{}, rec *DataRecord) (raw interface{}, ok bool) {
+	rule := r.Rule(kind)
+	exists := !rec.Empty()
+	if exists && ref.Parno != "" {
+		if v, found := rec.Get(ref.Parno, rule.IgnoreCase); found {
+			return v, true
+		}
+	}
+	if rule.FallbackParaValue {
+		if v, found := attrDef["para_value"]; found && v != nil {
+			return gconv.String(v), true
+		}
+	}
+	if rule.Default != nil {
+		return *rule.Default, true
+	}
+	if exists {
+		return "", true
+	}
+	return nil, false
+}
+
+// DataRecord 一个 svr_DATA_Num 的数据，不区分大小写查找时才建小写索引
+type DataRecord struct {
+	Fields map[string]string
+	lower  map[string]string
+}
+
+// NewDataRecord 包装 HGETALL 的结果，fields 为空表示 key 不存在
+func NewDataRecord(fields map[string]string) *DataRecord {
+	return &DataRecord{Fields: fields}
+}
+
+// Empty key 不存在或没有字段
+func (d *DataRecord) Empty() bool {
+	return d == nil || len(d.Fields) == 0
+}
+
+// Get 查字段，ignoreCase 时先精确匹配再不区分大小写匹配
+func (d *DataRecord) Get(field string, ignoreCase bool) (string, bool) {
+	if d.Empty() {
+		return "", false
+	}
+	if v, ok := d.Fields[field]; ok {
+		return v, true
+	}
+	if !ignoreCase {
+		return "", false
+	}
+	if d.lower == nil {
+		d.lower = make(map[string]string, len(d.Fields))
+		for k, v := range d.Fields {
+			d.lower[strings.ToLower(k)] = v
+		}
+	}
+	v, ok := d.lower[strings.ToLower(field)]
+	return v, ok
+}
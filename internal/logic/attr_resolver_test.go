@@ -0,0 +1,212 @@
+package logic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gf_api/internal/model"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestAttributeResolverLocate(t *testing.T) {
+	def := func(parno, relation string, isEnable interface{}) map[string]interface{} {
+		m := map[string]interface{}{"parno": parno, "relation_parno": relation}
+		if isEnable != nil {
+			m["is_enable"] = isEnable
+		}
+		return m
+	}
+	cases := []struct {
+		name        string
+		rule        ResolveRule
+		attrDef     map[string]interface{}
+		rPositionId string
+		want        AttributeRef
+	}{
+		{"关联工位号和关联属性都有值时使用关联", ResolveRule{UseRelation: true},
+			def("Power", "RPower", nil), "0102", AttributeRef{PositionId: "0102", Parno: "RPower", UseRelation: true}},
+		{"没有关联工位号", ResolveRule{UseRelation: true},
+			def("Power", "RPower", nil), "", AttributeRef{PositionId: "0101", Parno: "Power"}},
+		{"没有关联属性", ResolveRule{UseRelation: true},
+			def("Power", "", nil), "0102", AttributeRef{PositionId: "0101", Parno: "Power"}},
+		{"UseRelation 关闭", ResolveRule{},
+			def("Power", "RPower", nil), "0102", AttributeRef{PositionId: "0101", Parno: "Power"}},
+		{"is_enable 数字 1 覆盖关联", ResolveRule{UseRelation: true, EnableOverride: true},
+			def("Power", "RPower", float64(1)), "0102", AttributeRef{PositionId: "0101", Parno: "Power"}},
+		{"is_enable 字符串 1 不覆盖（和旧版一致）", ResolveRule{UseRelation: true, EnableOverride: true},
+			def("Power", "RPower", "1"), "0102", AttributeRef{PositionId: "0102", Parno: "RPower", UseRelation: true}},
+		{"is_enable 数字 0 不覆盖", ResolveRule{UseRelation: true, EnableOverride: true},
+			def("Power", "RPower", float64(0)), "0102", AttributeRef{PositionId: "0102", Parno: "RPower", UseRelation: true}},
+		{"is_enable 字符串 0 不覆盖", ResolveRule{UseRelation: true, EnableOverride: true},
+			def("Power", "RPower", "0"), "0102", AttributeRef{PositionId: "0102", Parno: "RPower", UseRelation: true}},
+		{"is_enable 其他类型不覆盖", ResolveRule{UseRelation: true, EnableOverride: true},
+			def("Power", "RPower", true), "0102", AttributeRef{PositionId: "0102", Parno: "RPower", UseRelation: true}},
+		{"EnableOverride 关闭时 is_enable 不起作用", ResolveRule{UseRelation: true},
+			def("Power", "RPower", float64(1)), "0102", AttributeRef{PositionId: "0102", Parno: "RPower", UseRelation: true}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := NewAttributeResolver(ResolveRules{Dynamic: c.rule})
+			got := r.Locate(model.AttributeDynamic, c.attrDef, "0101", c.rPositionId)
+			if got != c.want {
+				t.Errorf("Locate = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAttributeResolverResolve(t *testing.T) {
+	rec := map[string]string{"Power": "10", "Status": ""}
+	cases := []struct {
+		name    string
+		rule    ResolveRule
+		parno   string
+		attrDef map[string]interface{}
+		data    map[string]string
+		want    interface{}
+		wantOk  bool
+	}{
+		{"精确匹配", ResolveRule{}, "Power", nil, rec, "10", true},
+		{"区分大小写时查不到，svr_DATA 存在则为空字符串", ResolveRule{}, "power", nil, rec, "", true},
+		{"IgnoreCase 不区分大小写匹配", ResolveRule{IgnoreCase: true}, "POWER", nil, rec, "10", true},
+		{"字段存在但为空", ResolveRule{}, "Status", nil, rec, "", true},
+		{"svr_DATA 不存在", ResolveRule{}, "Power", nil, nil, nil, false},
+		{"parno 为空", ResolveRule{}, "", nil, rec, "", true},
+		{"FallbackParaValue 使用 para_value", ResolveRule{FallbackParaValue: true}, "Missing",
+			map[string]interface{}{"para_value": float64(5)}, rec, "5", true},
+		{"FallbackParaValue svr_DATA 不存在时也使用 para_value", ResolveRule{FallbackParaValue: true}, "Power",
+			map[string]interface{}{"para_value": "x"}, nil, "x", true},
+		{"FallbackParaValue 没有 para_value", ResolveRule{FallbackParaValue: true}, "Missing",
+			map[string]interface{}{}, nil, nil, false},
+		{"FallbackParaValue 不覆盖 svr_DATA 中的值", ResolveRule{FallbackParaValue: true}, "Power",
+			map[string]interface{}{"para_value": "x"}, rec, "10", true},
+		{"Default 在 svr_DATA 不存在时使用", ResolveRule{Default: strPtr("--")}, "Power", nil, nil, "--", true},
+		{"Default 在字段不存在时使用", ResolveRule{Default: strPtr("--")}, "Missing", nil, rec, "--", true},
+		{"para_value 优先于 Default", ResolveRule{FallbackParaValue: true, Default: strPtr("--")}, "Missing",
+			map[string]interface{}{"para_value": "p"}, rec, "p", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := NewAttributeResolver(ResolveRules{SetItem: c.rule})
+			got, ok := r.Resolve(model.AttributeSetItem, AttributeRef{PositionId: "0101", Parno: c.parno}, c.attrDef, NewDataRecord(c.data))
+			if ok != c.wantOk || got != c.want {
+				t.Errorf("Resolve = (%v, %v), want (%v, %v)", got, ok, c.want, c.wantOk)
+			}
+		})
+	}
+}
+
+func TestAttributeResolverPerModelRules(t *testing.T) {
+	r := NewAttributeResolver(ResolveRules{
+		Dynamic: ResolveRule{Default: strPtr("d")},
+		SetItem: ResolveRule{Default: strPtr("s"), LowerName: true},
+	})
+	ref := AttributeRef{PositionId: "0101", Parno: "Power"}
+	if v, _ := r.Resolve(model.AttributeDynamic, ref, nil, nil); v != "d" {
+		t.Errorf("dynamic default = %v, want d", v)
+	}
+	if v, _ := r.Resolve(model.AttributeSetItem, ref, nil, nil); v != "s" {
+		t.Errorf("setitem default = %v, want s", v)
+	}
+	if _, ok := r.Resolve(model.AttributeStatic, ref, nil, nil); ok {
+		t.Error("static 属性不应从 svr_DATA 取值")
+	}
+	if got := r.Name(model.AttributeDynamic, "PowerA"); got != "PowerA" {
+		t.Errorf("dynamic name = %s", got)
+	}
+	if got := r.Name(model.AttributeSetItem, "PowerA"); got != "powera" {
+		t.Errorf("setitem LowerName = %s", got)
+	}
+	var nilResolver *AttributeResolver
+	if got := nilResolver.Rule(model.AttributeSetItem); !reflect.DeepEqual(got, DefaultResolveRules().SetItem) {
+		t.Errorf("nil 取值器应使用默认规则，得到 %+v", got)
+	}
+}
+
+// legacyResolve 原 processDynamicModelCached / processSetitemModelCached 的取值逻辑
+func legacyResolve(setitem bool, modelDef map[string]map[string]interface{}, positionId, rPositionId string,
+	data map[string]map[string]string) map[string]interface{} {
+	node := map[string]interface{}{}
+	for attrName, attrDef := range modelDef {
+		if setitem {
+			attrName = strings.ToLower(attrName)
+		}
+		relationParno, _ := attrDef["relation_parno"].(string)
+		parno, _ := attrDef["parno"].(string)
+		isEnable, _ := attrDef["is_enable"].(float64)
+		num, useR := positionId, false
+		if rPositionId != "" && relationParno != "" {
+			num, useR = rPositionId, true
+		}
+		if isEnable == 1 {
+			num, useR = positionId, false
+		}
+		dataVal := data[DataKey(num)]
+		if len(dataVal) == 0 {
+			continue
+		}
+		if !setitem {
+			if useR {
+				node[attrName] = dataVal[relationParno]
+			} else {
+				node[attrName] = dataVal[parno]
+			}
+			continue
+		}
+		lowerMap := make(map[string]string)
+		for k, v := range dataVal {
+			lowerMap[strings.ToLower(k)] = v
+		}
+		var val string
+		if useR && relationParno != "" {
+			val = lowerMap[strings.ToLower(relationParno)]
+		} else if parno != "" {
+			val = lowerMap[strings.ToLower(parno)]
+		}
+		node[attrName] = val
+	}
+	return node
+}
+
+func TestDefaultResolveRulesMatchLegacy(t *testing.T) {
+	modelDef := map[string]map[string]interface{}{
+		"Power":      {"parno": "Power", "relation_parno": "RPower"},
+		"FwdPower":   {"parno": "fwdpower", "relation_parno": ""},
+		"Enabled":    {"parno": "Enabled", "relation_parno": "REnabled", "is_enable": float64(1)},
+		"Disabled":   {"parno": "Disabled", "relation_parno": "RDisabled", "is_enable": float64(0)},
+		"StrEnabled": {"parno": "StrEnabled", "relation_parno": "RStrEnabled", "is_enable": "1"},
+		"NoParno":    {"parno": "", "relation_parno": ""},
+		"Missing":    {"parno": "Missing", "relation_parno": "RMissing"},
+		"MixedCase":  {"parno": "MIXEDcase", "relation_parno": "rMixed"},
+		"OnlyRemote": {"parno": "", "relation_parno": "Remote"},
+	}
+	dataSets := []map[string]map[string]string{
+		{
+			DataKey("0101"): {"Power": "1", "FwdPower": "2", "Enabled": "3", "Disabled": "4", "MixedCase": "5", "StrEnabled": "6"},
+			DataKey("0102"): {"RPower": "11", "RDisabled": "14", "RStrEnabled": "17", "RMIXED": "15", "Remote": "16"},
+		},
+		{DataKey("0101"): {"power": "1", "fwdpower": "2"}},
+		{DataKey("0102"): {"RPower": "11"}},
+		{},
+	}
+	resolver := NewAttributeResolver(DefaultResolveRules())
+	for i, data := range dataSets {
+		for _, rPositionId := range []string{"", "0102"} {
+			for _, kind := range []model.AttributeKind{model.AttributeDynamic, model.AttributeSetItem} {
+				want := legacyResolve(kind == model.AttributeSetItem, modelDef, "0101", rPositionId, data)
+				got := map[string]interface{}{}
+				for attrName, attrDef := range modelDef {
+					ref := resolver.Locate(kind, attrDef, "0101", rPositionId)
+					if raw, ok := resolver.Resolve(kind, ref, attrDef, NewDataRecord(data[DataKey(ref.PositionId)])); ok {
+						got[resolver.Name(kind, attrName)] = raw
+					}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("data#%d rPositionId=%q %s:\n got  %v\n want %v", i, rPositionId, kind, got, want)
+				}
+			}
+		}
+	}
+}
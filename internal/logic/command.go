@@ -0,0 +1,674 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// 控制命令的异步下发和状态跟踪。
+// IssueOperateNew 校验通过后只把命令写入 control_command（queued）并立即返回命令ID，由下发协程转发到下发服务；
+// 同一工位号的命令按受理顺序逐条转发，不同工位号之间最多 command.forwardConcurrency（默认4）个同时转发，
+// 转发在每个工位号各自的协程中进行，不阻塞下发协程：
+//
+//	queued → sent → acknowledged → verified
+//	pending_approval → queued（审批通过）/ rejected / expired（见 command_approval.go）
+//	queued → timeout（排队超时）
+//	sent → failed（转发失败）/ timeout（转发中断）
+//	acknowledged → failed（回读超时）
+//
+// 下发服务返回成功为 acknowledged，返回失败或请求出错为 failed；acknowledged 之后由回读确认设备是否真的执行了（见 command_verify.go）。
+// 需要审批的关键操作先停在 pending_approval，审批通过后才进入队列。
+// 排队超过 command.queueTimeout（默认30s）的命令不再下发，直接记为 timeout，避免服务重启后补发过时的命令；
+// 停在 sent 超过 command.ackTimeout（默认30s）的命令（转发过程中服务退出）也记为 timeout。
+// 每次状态变化都写一条 control_command_event，failed 和 timeout 按 notify.routes 发 command 类型的通知。
+
+// 控制命令表名，表结构见 manifest/sql 中的 0007_control_command.sql 及 0008~0010
+const (
+	ControlCommandTable      = "control_command"
+	ControlCommandEventTable = "control_command_event"
+)
+
+// 命令状态
+const (
+	CommandQueued       = "queued"
+	CommandSent         = "sent"
+	CommandAcknowledged = "acknowledged"
+	CommandVerified     = "verified"
+	CommandFailed       = "failed"
+	CommandTimedOut     = "timeout"
+
+	CommandPendingApproval = "pending_approval"
+	CommandRejected        = "rejected"
+	CommandExpired         = "expired"
+)
+
+// DefaultCommandForwardURL 下发服务的地址，command.forwardURL 没有配置时使用
+const DefaultCommandForwardURL = "http://111.111.8.242:8005/api/Resource/IssueOperateNew"
+
+// ErrCommandNotFound 命令不存在
+var ErrCommandNotFound = errors.New("命令不存在")
+
+// CommandFinished 是否为终止状态
+func CommandFinished(status string) bool {
+	switch status {
+	case CommandVerified, CommandFailed, CommandTimedOut, CommandRejected, CommandExpired:
+		return true
+	}
+	return false
+}
+
+// Command 一条控制命令
+type Command struct {
+	Id int64 `json:"id"`
+	CommandRequest
+	StationId      string     `json:"stationId"`
+	Path           string     `json:"path"`
+	OperateModelId string     `json:"operateModelId"`
+	ReadbackParno  string     `json:"readbackParno"` // 回读确认时在 svr_DATA_<positionId> 中读取的字段，为空时不回读
+	ReadbackValue  string     `json:"readbackValue"` // 最近一次回读到的值
+	RequestedBy    string     `json:"requestedBy"`   // 鉴权上下文中的申请人
+	ApprovedBy     string     `json:"approvedBy"`    // 审批（通过或驳回）人
+	ApprovedAt     *time.Time `json:"approvedAt,omitempty"`
+	ScheduleId     int64      `json:"scheduleId,omitempty"` // 由定时任务触发时为任务ID
+	// ApprovalDeadline 需要审批的命令必须在此之前审批，不需要审批时为空
+	ApprovalDeadline *time.Time      `json:"approvalDeadline,omitempty"`
+	QueuedAt         *time.Time      `json:"queuedAt,omitempty"`
+	Status           string          `json:"status"`
+	Message          string          `json:"message"`            // 最近一次状态变化的说明
+	Response         interface{}     `json:"response,omitempty"` // 下发服务的返回内容
+	CreatedAt        time.Time       `json:"createdAt"`
+	SentAt           *time.Time      `json:"sentAt,omitempty"`
+	AckedAt          *time.Time      `json:"ackedAt,omitempty"`
+	FinishedAt       *time.Time      `json:"finishedAt,omitempty"`
+	UpdatedAt        time.Time       `json:"updatedAt"`
+	Events           []*CommandEvent `json:"events,omitempty"` // 只在查询单条命令时返回
+}
+
+// CommandEvent 命令的一次状态变化
+type CommandEvent struct {
+	Id        int64     `json:"id"`
+	CommandId int64     `json:"commandId"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	UserId    string    `json:"userId"` // 引起变化的用户，后台处理时为空
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CommandQuery 命令列表的查询条件
+type CommandQuery struct {
+	PositionId string
+	StationId  string
+	Status     string
+	UserCode   string
+	// NeedApproval 只查需要审批的命令
+	NeedApproval bool
+	// ScheduleId 只查该定时任务触发的命令
+	ScheduleId int64
+	Begin      time.Time
+	End        time.Time
+	PageIndex  int
+	PageSize   int
+}
+
+var (
+	commandStarted atomic.Bool
+	commandKick    = make(chan struct{}, 1)
+)
+
+// SubmitCommand 把校验通过的命令写入队列（queued）并通知下发协程，返回写入的命令；
+// 关键操作写成 pending_approval，等待另一个用户审批。requestedBy 为鉴权上下文中的用户，关键操作必须有。
+// target 为 nil（没有校验）时台站取工位号的台站部分。
+func SubmitCommand(ctx context.Context, req *CommandRequest, target *CommandTarget, requestedBy string) (*Command, error) {
+	return submitCommand(ctx, req, target, requestedBy, 0)
+}
+
+// submitCommand 同 SubmitCommand，scheduleId 为触发命令的定时任务，不是定时任务时为0
+func submitCommand(ctx context.Context, req *CommandRequest, target *CommandTarget, requestedBy string, scheduleId int64) (*Command, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cmd := &Command{
+		CommandRequest: *req,
+		StationId:      stationOfPosition(req.PositionId),
+		RequestedBy:    requestedBy,
+		ScheduleId:     scheduleId,
+		Status:         CommandQueued,
+		Message:        "已受理，等待下发",
+		CreatedAt:      now,
+		QueuedAt:       &now,
+		UpdatedAt:      now,
+	}
+	if target != nil {
+		cmd.StationId, cmd.Path, cmd.OperateModelId = target.StationId, target.Path, target.OperateModelId
+	}
+	cmd.ReadbackParno = readbackParno(req, target)
+
+	if CommandNeedsApproval(ctx, req, target) {
+		if requestedBy == "" {
+			return nil, &CommandRejection{Code: RejectLoginRequired, PositionId: req.PositionId, OperateModelId: cmd.OperateModelId,
+				Message: fmt.Sprintf("操作 %s 需要审批，必须登录后下发", req.Name)}
+		}
+		deadline := now.Add(g.Cfg().MustGet(ctx, "command.approval.window", "10m").Duration())
+		cmd.Status, cmd.QueuedAt, cmd.ApprovalDeadline = CommandPendingApproval, nil, &deadline
+		cmd.Message = fmt.Sprintf("关键操作，等待审批（%s 前）", deadline.Format("2006-01-02 15:04:05"))
+	}
+
+	err := db.PgDB.Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		id, err := tx.GetValue(`INSERT INTO `+ControlCommandTable+` (station_id, position_id, path, operate_model_id, readback_parno, name, para, paranew,
+			frequency, client_ip, user_code, user_name, real_name, agent_type, requested_by, approval_deadline, queued_at,
+			schedule_id, status, message, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+			cmd.StationId, cmd.PositionId, cmd.Path, cmd.OperateModelId, cmd.ReadbackParno, cmd.Name, cmd.Para, cmd.Paranew,
+			cmd.Frequency, cmd.ClientIp, cmd.UserCode, cmd.UserName, cmd.RealName, cmd.AgentType,
+			cmd.RequestedBy, nullableTime(cmd.ApprovalDeadline), nullableTime(cmd.QueuedAt),
+			cmd.ScheduleId, cmd.Status, cmd.Message, now, now)
+		if err != nil {
+			return err
+		}
+		cmd.Id = id.Int64()
+		_, err = tx.Exec(`INSERT INTO `+ControlCommandEventTable+` (command_id, status, message, user_id, created_at) VALUES (?, ?, ?, ?, ?)`,
+			cmd.Id, cmd.Status, cmd.Message, requestedBy, now)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("写入控制命令失败: %w", err)
+	}
+
+	if cmd.Status == CommandPendingApproval {
+		if err := writeCommandOpLog(ctx, cmd, requestedBy, cmd.RealName, fmt.Sprintf("申请下发关键操作 %s", cmd.Name),
+			fmt.Sprintf("命令ID %d 等待审批", cmd.Id)); err != nil {
+			g.Log().Warningf(ctx, "命令 %d 的审批申请写入 %s 失败: %v", cmd.Id, OperationLogTable, err)
+		}
+		return cmd, nil
+	}
+	kickCommandDispatcher()
+	return cmd, nil
+}
+
+// kickCommandDispatcher 通知下发协程立即检查队列
+func kickCommandDispatcher() {
+	select {
+	case commandKick <- struct{}{}:
+	default:
+	}
+}
+
+// StartCommandDispatcher 启动下发协程：有新命令时立即下发，另外每 command.interval（默认1s）检查一次队列；
+// 超时和回读由单独的协程按同样的间隔检查，下发服务卡住时不受影响
+func StartCommandDispatcher(ctx context.Context) {
+	if !commandStarted.CompareAndSwap(false, true) {
+		return
+	}
+	interval := g.Cfg().MustGet(ctx, "command.interval", "1s").Duration()
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-commandKick:
+			}
+			if _, err := DispatchCommands(ctx); err != nil {
+				g.Log().Warningf(ctx, "下发控制命令失败: %v", err)
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := ExpireCommands(ctx); err != nil {
+				g.Log().Warningf(ctx, "检查控制命令超时失败: %v", err)
+			}
+			if _, err := VerifyCommands(ctx); err != nil {
+				g.Log().Warningf(ctx, "回读确认控制命令失败: %v", err)
+			}
+		}
+	}()
+}
+
+// DispatchCommands 把排队中的命令按工位号交给转发协程，返回交出的命令条数，不等转发结束。
+// 每个工位号同时只有一个转发协程，按受理顺序逐条转发；正在转发的工位号本次跳过，它的协程结束后会再次通知下发协程。
+// 一个设备的下发服务卡住时只占用它自己的协程和一个并发名额，不影响其他工位号的命令。
+func DispatchCommands(ctx context.Context) (int, error) {
+	if err := checkDB(); err != nil {
+		return 0, err
+	}
+	limit := g.Cfg().MustGet(ctx, "command.forwardConcurrency", 4).Int()
+	if limit <= 0 {
+		limit = 1
+	}
+	busy := commandWorkers.positions()
+	if len(busy) >= limit {
+		return 0, nil
+	}
+
+	queueTimeout := g.Cfg().MustGet(ctx, "command.queueTimeout", "30s").Duration()
+	query := `SELECT ` + commandColumns + ` FROM ` + ControlCommandTable + `
+		WHERE status = ? AND COALESCE(queued_at, created_at) > ?`
+	args := []interface{}{CommandQueued, time.Now().Add(-queueTimeout)}
+	if len(busy) > 0 {
+		query += ` AND position_id NOT IN (?)`
+		args = append(args, busy)
+	}
+	query += ` ORDER BY id LIMIT ?`
+	args = append(args, g.Cfg().MustGet(ctx, "command.batchSize", 20).Int())
+	res, err := db.PgDB.GetAll(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("查询排队中的命令失败: %w", err)
+	}
+	commands := make([]*Command, 0, len(res))
+	for _, row := range res {
+		commands = append(commands, commandFromRecord(row))
+	}
+
+	started := 0
+	for _, group := range groupCommandsByPosition(commands) {
+		positionId := group[0].PositionId
+		if !commandWorkers.start(positionId, limit) {
+			continue
+		}
+		started += len(group)
+		go func(group []*Command) {
+			defer kickCommandDispatcher()
+			defer commandWorkers.done(positionId)
+			forwardCommands(ctx, group)
+		}(group)
+	}
+	return started, nil
+}
+
+// forwardCommands 逐条认领（queued → sent）并转发同一工位号的命令，已经不在 queued 的命令跳过
+func forwardCommands(ctx context.Context, group []*Command) {
+	for _, cmd := range group {
+		ok, err := SetCommandStatus(ctx, cmd.Id, []string{CommandQueued}, CommandSent, "正在转发到下发服务", nil)
+		if err != nil {
+			g.Log().Warningf(ctx, "认领命令 %d 失败: %v", cmd.Id, err)
+			return
+		}
+		if ok {
+			forwardCommand(ctx, cmd)
+		}
+	}
+}
+
+// positionWorkers 记录正在转发的工位号
+type positionWorkers struct {
+	mu   sync.Mutex
+	busy map[string]struct{}
+}
+
+var commandWorkers = &positionWorkers{busy: make(map[string]struct{})}
+
+// start 工位号没有在转发、并且正在转发的工位号少于 limit 时标记为正在转发，返回 true
+func (w *positionWorkers) start(positionId string, limit int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.busy[positionId]; ok || len(w.busy) >= limit {
+		return false
+	}
+	w.busy[positionId] = struct{}{}
+	return true
+}
+
+// done 工位号转发结束
+func (w *positionWorkers) done(positionId string) {
+	w.mu.Lock()
+	delete(w.busy, positionId)
+	w.mu.Unlock()
+}
+
+// positions 正在转发的工位号
+func (w *positionWorkers) positions() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]string, 0, len(w.busy))
+	for id := range w.busy {
+		out = append(out, id)
+	}
+	return out
+}
+
+// groupCommandsByPosition 按工位号分组，组的顺序和组内命令的顺序都保持受理顺序
+func groupCommandsByPosition(commands []*Command) [][]*Command {
+	var (
+		groups [][]*Command
+		index  = make(map[string]int)
+	)
+	for _, cmd := range commands {
+		i, ok := index[cmd.PositionId]
+		if !ok {
+			i = len(groups)
+			index[cmd.PositionId] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], cmd)
+	}
+	return groups
+}
+
+// forwardCommand 转发到下发服务，按返回结果记为 acknowledged 或 failed
+func forwardCommand(ctx context.Context, cmd *Command) {
+	url := g.Cfg().MustGet(ctx, "command.forwardURL", DefaultCommandForwardURL).String()
+	timeout := g.Cfg().MustGet(ctx, "command.forwardTimeout", "10s").Duration()
+
+	status, message, response := CommandFailed, "", ""
+	resp, err := g.Client().Timeout(timeout).Post(ctx, url, cmd.FormData())
+	if err != nil {
+		message = fmt.Sprintf("转发接口请求失败: %v", err)
+	} else {
+		body := resp.ReadAll()
+		resp.Close()
+		response = string(body)
+		var data interface{}
+		switch {
+		case resp.StatusCode >= 300:
+			message = fmt.Sprintf("下发服务返回 HTTP %d", resp.StatusCode)
+		case json.Unmarshal(body, &data) != nil:
+			message = "解析返回 JSON 失败"
+		default:
+			var accepted bool
+			if accepted, message = commandResponseAccepted(data); accepted {
+				status = CommandAcknowledged
+			}
+		}
+	}
+
+	if _, err := SetCommandStatus(ctx, cmd.Id, []string{CommandSent}, status, message, g.Map{"response": response}); err != nil {
+		g.Log().Warningf(ctx, "更新命令 %d 状态失败: %v", cmd.Id, err)
+	}
+}
+
+// commandResponseAccepted 判断下发服务是否接受了命令：
+// result 为 success/ok、success 为 true、code 为 0 或 200 时接受；这些字段都没有时按接受处理。
+func commandResponseAccepted(data interface{}) (bool, string) {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return true, "下发服务已接收"
+	}
+	message := firstModelString(m, "message", "msg", "Message")
+	reject := func(reason string) (bool, string) {
+		if message != "" {
+			reason += "：" + message
+		}
+		return false, reason
+	}
+	if v, ok := m["result"]; ok && v != nil {
+		switch strings.ToLower(gconv.String(v)) {
+		case "success", "ok", "true":
+		default:
+			return reject("下发服务返回失败")
+		}
+	}
+	if v, ok := m["success"].(bool); ok && !v {
+		return reject("下发服务返回失败")
+	}
+	if v, ok := m["code"]; ok && v != nil {
+		if code := gconv.Int(v); code != 0 && code != 200 {
+			return reject(fmt.Sprintf("下发服务返回错误码 %v", v))
+		}
+	}
+	if message == "" {
+		message = "下发服务已接收"
+	}
+	return true, message
+}
+
+// ExpireCommands 排队超时和停在 sent 的命令记为 timeout，超过审批期限的命令记为 expired
+func ExpireCommands(ctx context.Context) error {
+	if err := checkDB(); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, c := range []struct {
+		status, field, to, message string
+		timeout                    time.Duration
+	}{
+		{CommandQueued, "COALESCE(queued_at, created_at)", CommandTimedOut, "排队超时，没有下发", g.Cfg().MustGet(ctx, "command.queueTimeout", "30s").Duration()},
+		{CommandSent, "sent_at", CommandTimedOut, "转发过程中断，没有收到下发服务的结果", g.Cfg().MustGet(ctx, "command.ackTimeout", "30s").Duration()},
+		{CommandPendingApproval, "approval_deadline", CommandExpired, "审批期限内没有审批，不再下发", 0},
+	} {
+		res, err := db.PgDB.GetAll(ctx, `SELECT id FROM `+ControlCommandTable+` WHERE status = ? AND `+c.field+` <= ? ORDER BY id`,
+			c.status, now.Add(-c.timeout))
+		if err != nil {
+			return fmt.Errorf("查询超时的命令失败: %w", err)
+		}
+		for _, row := range res {
+			if _, err := SetCommandStatus(ctx, row["id"].Int64(), []string{c.status}, c.to, c.message, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetCommandStatus 命令处于 from 中的某个状态时改为 to，同时写一条状态记录；extra 为要一起更新的其他字段。
+// 命令已经不在 from 中（被其他过程改过）时返回 false。进入 failed 或 timeout 时发通知。
+func SetCommandStatus(ctx context.Context, id int64, from []string, to, message string, extra g.Map) (bool, error) {
+	return setCommandStatusBy(ctx, id, from, to, message, "", extra)
+}
+
+// setCommandStatusBy 同 SetCommandStatus，状态记录中写上引起变化的用户
+func setCommandStatusBy(ctx context.Context, id int64, from []string, to, message, userId string, extra g.Map) (bool, error) {
+	if err := checkDB(); err != nil {
+		return false, err
+	}
+	message = truncateString(message, 512)
+	now := time.Now()
+	set := []string{"status = ?", "message = ?", "updated_at = ?"}
+	args := []interface{}{to, message, now}
+	switch to {
+	case CommandQueued:
+		set, args = append(set, "queued_at = ?"), append(args, now)
+	case CommandSent:
+		set, args = append(set, "sent_at = ?"), append(args, now)
+	case CommandAcknowledged:
+		set, args = append(set, "acked_at = ?"), append(args, now)
+	}
+	if CommandFinished(to) {
+		set, args = append(set, "finished_at = ?"), append(args, now)
+	}
+	for field, v := range extra {
+		set, args = append(set, field+" = ?"), append(args, v)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(from)), ", ")
+	args = append(append(args, id), gconv.Interfaces(from)...)
+
+	changed := false
+	err := db.PgDB.Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		res, err := tx.Exec(`UPDATE `+ControlCommandTable+` SET `+strings.Join(set, ", ")+
+			` WHERE id = ? AND status IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		changed = true
+		_, err = tx.Exec(`INSERT INTO `+ControlCommandEventTable+` (command_id, status, message, user_id, created_at) VALUES (?, ?, ?, ?, ?)`,
+			id, to, message, userId, now)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("更新命令 %d 状态失败: %w", id, err)
+	}
+	if changed && (to == CommandFailed || to == CommandTimedOut) {
+		if cmd, err := GetCommand(ctx, id); err == nil {
+			NotifyCommandFailure(ctx, cmd.PositionId, cmd.Name, fmt.Sprintf("命令 %d %s：%s", id, to, message))
+		}
+	}
+	return changed, nil
+}
+
+const commandColumns = `id, station_id, position_id, path, operate_model_id, readback_parno, readback_value, name, para, paranew, frequency, client_ip, user_code,
+	user_name, real_name, agent_type, requested_by, approved_by, approved_at, approval_deadline, queued_at,
+	schedule_id, status, message, response, created_at, sent_at, acked_at, finished_at, updated_at`
+
+func commandFromRecord(row gdb.Record) *Command {
+	cmd := &Command{
+		Id: row["id"].Int64(),
+		CommandRequest: CommandRequest{
+			PositionId: row["position_id"].String(),
+			Name:       row["name"].String(),
+			Para:       row["para"].String(),
+			Paranew:    row["paranew"].String(),
+			Frequency:  row["frequency"].String(),
+			ClientIp:   row["client_ip"].String(),
+			UserCode:   row["user_code"].String(),
+			UserName:   row["user_name"].String(),
+			RealName:   row["real_name"].String(),
+			AgentType:  row["agent_type"].String(),
+		},
+		StationId:        row["station_id"].String(),
+		Path:             row["path"].String(),
+		OperateModelId:   row["operate_model_id"].String(),
+		ReadbackParno:    row["readback_parno"].String(),
+		ReadbackValue:    row["readback_value"].String(),
+		RequestedBy:      row["requested_by"].String(),
+		ApprovedBy:       row["approved_by"].String(),
+		ScheduleId:       row["schedule_id"].Int64(),
+		ApprovedAt:       recordTime(row["approved_at"]),
+		ApprovalDeadline: recordTime(row["approval_deadline"]),
+		QueuedAt:         recordTime(row["queued_at"]),
+		Status:           row["status"].String(),
+		Message:          row["message"].String(),
+		CreatedAt:        row["created_at"].Time(),
+		SentAt:           recordTime(row["sent_at"]),
+		AckedAt:          recordTime(row["acked_at"]),
+		FinishedAt:       recordTime(row["finished_at"]),
+		UpdatedAt:        row["updated_at"].Time(),
+	}
+	// 下发服务返回 JSON 时按结构输出，否则输出原始字符串
+	if raw := row["response"].String(); raw != "" {
+		var data interface{}
+		if json.Unmarshal([]byte(raw), &data) == nil {
+			cmd.Response = data
+		} else {
+			cmd.Response = raw
+		}
+	}
+	return cmd
+}
+
+// GetCommand 查询一条命令及其状态变化记录
+func GetCommand(ctx context.Context, id int64) (*Command, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	row, err := db.PgDB.GetOne(ctx, `SELECT `+commandColumns+` FROM `+ControlCommandTable+` WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("查询命令失败: %w", err)
+	}
+	if row.IsEmpty() {
+		return nil, ErrCommandNotFound
+	}
+	cmd := commandFromRecord(row)
+	res, err := db.PgDB.GetAll(ctx, `SELECT id, command_id, status, message, user_id, created_at FROM `+ControlCommandEventTable+`
+		WHERE command_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("查询命令状态记录失败: %w", err)
+	}
+	cmd.Events = make([]*CommandEvent, 0, len(res))
+	for _, r := range res {
+		cmd.Events = append(cmd.Events, &CommandEvent{
+			Id:        r["id"].Int64(),
+			CommandId: r["command_id"].Int64(),
+			Status:    r["status"].String(),
+			Message:   r["message"].String(),
+			UserId:    r["user_id"].String(),
+			CreatedAt: r["created_at"].Time(),
+		})
+	}
+	return cmd, nil
+}
+
+// QueryCommands 分页查询命令，按受理时间倒序
+func QueryCommands(ctx context.Context, q CommandQuery) (list []*Command, total int, err error) {
+	if err := checkDB(); err != nil {
+		return nil, 0, err
+	}
+	if q.PageIndex <= 0 {
+		q.PageIndex = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = 20
+	}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	addCond := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if q.PositionId != "" {
+		addCond("position_id = ?", q.PositionId)
+	}
+	if q.StationId != "" {
+		addCond("station_id = ?", q.StationId)
+	}
+	if q.Status != "" {
+		addCond("status = ?", q.Status)
+	}
+	if q.UserCode != "" {
+		addCond("user_code = ?", q.UserCode)
+	}
+	if q.ScheduleId > 0 {
+		addCond("schedule_id = ?", q.ScheduleId)
+	}
+	if q.NeedApproval {
+		conds = append(conds, "approval_deadline IS NOT NULL")
+	}
+	if !q.Begin.IsZero() {
+		addCond("created_at >= ?", q.Begin)
+	}
+	if !q.End.IsZero() {
+		addCond("created_at <= ?", q.End)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	count, err := db.PgDB.GetValue(ctx, `SELECT COUNT(*) FROM `+ControlCommandTable+where, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询命令失败: %w", err)
+	}
+	res, err := db.PgDB.GetAll(ctx, `SELECT `+commandColumns+` FROM `+ControlCommandTable+where+
+		` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, q.PageSize, (q.PageIndex-1)*q.PageSize)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询命令失败: %w", err)
+	}
+	list = make([]*Command, 0, len(res))
+	for _, row := range res {
+		list = append(list, commandFromRecord(row))
+	}
+	return list, count.Int(), nil
+}
@@ -0,0 +1,194 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 关键控制操作的双人审批。
+// 开关机、主备切换、功率调整等关键操作由申请人下发后停在 pending_approval，必须由另一个有审批权限的用户
+// 在 command.approval.window（默认10m）内审批通过才进入下发队列；驳回为 rejected，过期为 expired，都不会下发。
+// 关键操作由操作模型的 critical 字段或 command.approval.critical 规则确定，例如：
+//
+//	command:
+//	  approval:
+//	    window: 10m
+//	    approvers: ["zhangsan", "lisi"]   # 有审批权限的用户，为空时除申请人以外的任何登录用户都可以审批
+//	    critical:
+//	      - names: ["开机", "关机", "主备切换"]   # 任何操作模型中的这些操作
+//	      - models: ["tx_10kw"]                  # 这个操作模型中的所有操作
+//	      - models: ["tx_3kw"]
+//	        names: ["功率"]                       # 这个操作模型中的这些操作
+//
+// 申请人和审批人都取鉴权上下文中的用户，写入命令的状态记录和 operation_log。
+// 审批通过时按当前的操作模型重新校验一次，模型已经变化而不再合法的命令记为 failed。
+// command.approval.enabled=false 时所有操作都不需要审批。
+
+var (
+	// ErrCommandTransition 命令当前状态不允许该操作
+	ErrCommandTransition = errors.New("命令当前状态不允许该操作")
+	// ErrCommandApprover 当前用户不能审批该命令
+	ErrCommandApprover = errors.New("当前用户不能审批该命令")
+)
+
+// CommandApprovalRule 关键操作规则，names 和 models 都配置时两者同时满足才匹配，都为空的规则不匹配任何操作
+type CommandApprovalRule struct {
+	Names  []string `json:"names"`
+	Models []string `json:"models"`
+}
+
+// Match 操作是否匹配规则
+func (r *CommandApprovalRule) Match(name, modelId string) bool {
+	if len(r.Names) == 0 && len(r.Models) == 0 {
+		return false
+	}
+	return matchAny(r.Names, name) && matchAny(r.Models, modelId)
+}
+
+// LoadCommandApprovalRules 读取 command.approval.critical
+func LoadCommandApprovalRules(ctx context.Context) []CommandApprovalRule {
+	var rules []CommandApprovalRule
+	if v, err := g.Cfg().Get(ctx, "command.approval.critical"); err == nil && !v.IsNil() {
+		if err := v.Scan(&rules); err != nil {
+			g.Log().Warningf(ctx, "解析 command.approval.critical 失败: %v", err)
+		}
+	}
+	return rules
+}
+
+// CommandNeedsApproval 命令是否为需要审批的关键操作
+func CommandNeedsApproval(ctx context.Context, req *CommandRequest, target *CommandTarget) bool {
+	if !g.Cfg().MustGet(ctx, "command.approval.enabled", true).Bool() {
+		return false
+	}
+	name, modelId := req.Name, ""
+	if target != nil {
+		modelId = target.OperateModelId
+		if target.Operation != nil {
+			if target.Operation.Critical {
+				return true
+			}
+			name = target.Operation.Name
+		}
+	}
+	for _, rule := range LoadCommandApprovalRules(ctx) {
+		if rule.Match(name, modelId) || (name != req.Name && rule.Match(req.Name, modelId)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCommandApprover 审批人必须已登录、不是申请人，配置了 command.approval.approvers 时必须在列表中
+func checkCommandApprover(ctx context.Context, cmd *Command, approver string) error {
+	if approver == "" {
+		return fmt.Errorf("%w：审批需要登录", ErrCommandApprover)
+	}
+	if strings.EqualFold(approver, cmd.RequestedBy) {
+		return fmt.Errorf("%w：不能审批自己申请的命令", ErrCommandApprover)
+	}
+	approvers := g.Cfg().MustGet(ctx, "command.approval.approvers").Strings()
+	if len(approvers) > 0 && !matchAny(approvers, approver) {
+		return fmt.Errorf("%w：用户 %s 没有审批权限", ErrCommandApprover, approver)
+	}
+	return nil
+}
+
+// pendingCommand 取等待审批的命令，已过期的顺便记为 expired
+func pendingCommand(ctx context.Context, id int64) (*Command, error) {
+	cmd, err := GetCommand(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Status != CommandPendingApproval {
+		return nil, fmt.Errorf("%w：命令状态为 %s，不是等待审批", ErrCommandTransition, cmd.Status)
+	}
+	if cmd.ApprovalDeadline != nil && !time.Now().Before(*cmd.ApprovalDeadline) {
+		if _, err := SetCommandStatus(ctx, id, []string{CommandPendingApproval}, CommandExpired, "审批期限内没有审批，不再下发", nil); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w：命令已超过审批期限", ErrCommandTransition)
+	}
+	return cmd, nil
+}
+
+// ApproveCommand 审批通过：重新校验后进入下发队列。校验不通过时命令记为 failed，返回 *CommandRejection。
+func ApproveCommand(ctx context.Context, id int64, approver, comment string) (*Command, error) {
+	cmd, err := pendingCommand(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCommandApprover(ctx, cmd, approver); err != nil {
+		return nil, err
+	}
+
+	if _, err := ValidateCommand(ctx, &cmd.CommandRequest); err != nil {
+		var rej *CommandRejection
+		if !errors.As(err, &rej) {
+			return nil, err
+		}
+		if _, err := setCommandStatusBy(ctx, id, []string{CommandPendingApproval}, CommandFailed,
+			"审批时校验不通过："+rej.Message, approver, nil); err != nil {
+			return nil, err
+		}
+		return nil, rej
+	}
+
+	message := fmt.Sprintf("%s 审批通过", approver)
+	if comment != "" {
+		message += "：" + comment
+	}
+	changed, err := setCommandStatusBy(ctx, id, []string{CommandPendingApproval}, CommandQueued, message, approver,
+		g.Map{"approved_by": approver, "approved_at": time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, fmt.Errorf("%w：命令已被其他人处理", ErrCommandTransition)
+	}
+	kickCommandDispatcher()
+	if err := writeCommandOpLog(ctx, cmd, approver, "", fmt.Sprintf("审批通过关键操作 %s", cmd.Name),
+		fmt.Sprintf("命令ID %d 申请人 %s 审批人 %s %s", id, cmd.RequestedBy, approver, comment)); err != nil {
+		g.Log().Warningf(ctx, "命令 %d 的审批结果写入 %s 失败: %v", id, OperationLogTable, err)
+	}
+	return GetCommand(ctx, id)
+}
+
+// RejectCommand 驳回等待审批的命令。申请人自己可以撤回，其他人需要审批权限。
+func RejectCommand(ctx context.Context, id int64, approver, reason string) (*Command, error) {
+	cmd, err := pendingCommand(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if approver == "" || !strings.EqualFold(approver, cmd.RequestedBy) {
+		if err := checkCommandApprover(ctx, cmd, approver); err != nil {
+			return nil, err
+		}
+	}
+
+	message := fmt.Sprintf("%s 驳回", approver)
+	if strings.EqualFold(approver, cmd.RequestedBy) {
+		message = fmt.Sprintf("%s 撤回申请", approver)
+	}
+	if reason != "" {
+		message += "：" + reason
+	}
+	changed, err := setCommandStatusBy(ctx, id, []string{CommandPendingApproval}, CommandRejected, message, approver,
+		g.Map{"approved_by": approver, "approved_at": time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, fmt.Errorf("%w：命令已被其他人处理", ErrCommandTransition)
+	}
+	if err := writeCommandOpLog(ctx, cmd, approver, "", fmt.Sprintf("驳回关键操作 %s", cmd.Name),
+		fmt.Sprintf("命令ID %d 申请人 %s 审批人 %s %s", id, cmd.RequestedBy, approver, reason)); err != nil {
+		g.Log().Warningf(ctx, "命令 %d 的审批结果写入 %s 失败: %v", id, OperationLogTable, err)
+	}
+	return GetCommand(ctx, id)
+}
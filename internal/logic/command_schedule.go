@@ -0,0 +1,450 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 定时和周期控制命令。
+// 定时任务保存在 control_command_schedule，指定一次性的执行时间（runAt）或 cron 表达式（见 cron.go），
+// 后台每 command.schedule.interval（默认10s）检查到期的任务，按 IssueOperateNew 相同的流程校验并写入命令队列，
+// 命令的 schedule_id 为任务ID，可以通过 /Resource/Commands?scheduleId= 查询每次执行的结果。
+// 关键操作每次执行都要审批，申请人为创建任务的用户。
+//
+//	active → paused → active（暂停/恢复，恢复后周期任务从当前时间算下一次）
+//	active/paused → cancelled
+//	active → finished（一次性任务执行后，或 cron 表达式以后不再有执行时间）
+//
+// 错过的执行（服务停止或重启）：到期不超过 command.schedule.misfireGrace（默认1m）的照常执行；
+// 超过的按任务的 misfire 处理，skip（默认）跳过并记入 missedCount，runOnce 补执行一次（错过多次也只补一次）。
+// 周期任务之后从当前时间算下一次执行时间。command.schedule.enabled=false 时不执行任何任务。
+
+// ControlCommandScheduleTable 定时控制命令表，表结构见 manifest/sql/0010_command_schedule.sql
+const ControlCommandScheduleTable = "control_command_schedule"
+
+// 定时任务状态
+const (
+	ScheduleActive    = "active"
+	SchedulePaused    = "paused"
+	ScheduleCancelled = "cancelled"
+	ScheduleFinished  = "finished"
+)
+
+// 错过执行时间的处理方式
+const (
+	MisfireSkip    = "skip"
+	MisfireRunOnce = "runOnce"
+)
+
+var (
+	// ErrScheduleNotFound 定时任务不存在
+	ErrScheduleNotFound = errors.New("定时任务不存在")
+	// ErrScheduleInvalid 定时任务参数错误
+	ErrScheduleInvalid = errors.New("定时任务参数错误")
+	// ErrScheduleTransition 定时任务当前状态不允许该操作
+	ErrScheduleTransition = errors.New("定时任务当前状态不允许该操作")
+)
+
+// CommandSchedule 一个定时控制命令
+type CommandSchedule struct {
+	Id int64 `json:"id"`
+	CommandRequest
+	StationId     string     `json:"stationId"`
+	Remark        string     `json:"remark"`          // 任务说明，如“夜间维护降功率”
+	Cron          string     `json:"cron,omitempty"`  // 周期任务的 cron 表达式
+	RunAt         *time.Time `json:"runAt,omitempty"` // 一次性任务的执行时间
+	Misfire       string     `json:"misfire"`         // 错过执行时间的处理：skip / runOnce
+	Status        string     `json:"status"`
+	NextRunAt     *time.Time `json:"nextRunAt,omitempty"`
+	LastRunAt     *time.Time `json:"lastRunAt,omitempty"`
+	LastCommandId int64      `json:"lastCommandId,omitempty"` // 最近一次执行写入的命令
+	LastResult    string     `json:"lastResult"`              // 最近一次执行或跳过的说明
+	RunCount      int        `json:"runCount"`
+	MissedCount   int        `json:"missedCount"`
+	CreatedBy     string     `json:"createdBy"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// CommandScheduleQuery 定时任务查询条件
+type CommandScheduleQuery struct {
+	PositionId string
+	StationId  string
+	Status     string
+	PageIndex  int
+	PageSize   int
+}
+
+var scheduleStarted atomic.Bool
+
+// CreateCommandSchedule 创建定时任务：runAt 和 cron 必须且只能有一个，命令先按操作模型校验一次。
+// 校验不通过时返回 *CommandRejection，参数错误时返回包装 ErrScheduleInvalid 的错误。
+func CreateCommandSchedule(ctx context.Context, s *CommandSchedule) (*CommandSchedule, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s.Cron = strings.TrimSpace(s.Cron)
+	switch s.Misfire {
+	case "":
+		s.Misfire = MisfireSkip
+	case MisfireSkip, MisfireRunOnce:
+	default:
+		return nil, fmt.Errorf("%w：misfire 应为 %s 或 %s", ErrScheduleInvalid, MisfireSkip, MisfireRunOnce)
+	}
+	switch {
+	case s.Cron == "" && s.RunAt == nil:
+		return nil, fmt.Errorf("%w：需要 runAt 或 cron", ErrScheduleInvalid)
+	case s.Cron != "" && s.RunAt != nil:
+		return nil, fmt.Errorf("%w：runAt 和 cron 只能指定一个", ErrScheduleInvalid)
+	case s.RunAt != nil:
+		if !s.RunAt.After(now) {
+			return nil, fmt.Errorf("%w：runAt 必须晚于当前时间", ErrScheduleInvalid)
+		}
+		next := *s.RunAt
+		s.NextRunAt = &next
+	default:
+		cron, err := ParseCron(s.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("%w：%v", ErrScheduleInvalid, err)
+		}
+		next := cron.Next(now)
+		if next.IsZero() {
+			return nil, fmt.Errorf("%w：cron 表达式 %q 没有执行时间", ErrScheduleInvalid, s.Cron)
+		}
+		s.NextRunAt = &next
+	}
+
+	target, err := ValidateCommand(ctx, &s.CommandRequest)
+	if err != nil {
+		return nil, err
+	}
+	// 关键操作每次执行都以创建人为申请人提交审批，没有创建人的任务每次都会被拒绝
+	if CommandNeedsApproval(ctx, &s.CommandRequest, target) && s.CreatedBy == "" {
+		rej := &CommandRejection{Code: RejectLoginRequired, PositionId: s.PositionId,
+			Message: fmt.Sprintf("操作 %s 需要审批，必须登录后创建定时任务", s.Name)}
+		if target != nil {
+			rej.OperateModelId = target.OperateModelId
+		}
+		return nil, rej
+	}
+	s.StationId = stationOfPosition(s.PositionId)
+	if target != nil {
+		s.StationId = target.StationId
+	}
+	s.Status = ScheduleActive
+	s.CreatedAt, s.UpdatedAt = now, now
+
+	id, err := db.PgDB.GetValue(ctx, `INSERT INTO `+ControlCommandScheduleTable+` (station_id, position_id, name, para, paranew, frequency,
+		client_ip, user_code, user_name, real_name, agent_type, remark, cron, run_at, misfire, status, next_run_at, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		s.StationId, s.PositionId, s.Name, s.Para, s.Paranew, s.Frequency,
+		s.ClientIp, s.UserCode, s.UserName, s.RealName, s.AgentType, truncateString(s.Remark, 256), s.Cron,
+		nullableTime(s.RunAt), s.Misfire, s.Status, nullableTime(s.NextRunAt), s.CreatedBy, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("写入定时任务失败: %w", err)
+	}
+	s.Id = id.Int64()
+	return s, nil
+}
+
+// StartCommandScheduler 启动定时任务协程，每 command.schedule.interval（默认10s）执行一次到期的任务。
+// 启动时立即检查一次，处理服务停止期间错过的执行。
+func StartCommandScheduler(ctx context.Context) {
+	if !g.Cfg().MustGet(ctx, "command.schedule.enabled", true).Bool() {
+		return
+	}
+	if !scheduleStarted.CompareAndSwap(false, true) {
+		return
+	}
+	interval := g.Cfg().MustGet(ctx, "command.schedule.interval", "10s").Duration()
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := RunDueSchedules(ctx); err != nil {
+				g.Log().Warningf(ctx, "执行定时控制命令失败: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunDueSchedules 执行到期的定时任务，返回写入命令队列的条数
+func RunDueSchedules(ctx context.Context) (int, error) {
+	if err := checkDB(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	res, err := db.PgDB.GetAll(ctx, `SELECT `+scheduleColumns+` FROM `+ControlCommandScheduleTable+`
+		WHERE status = ? AND next_run_at <= ? ORDER BY next_run_at, id`, ScheduleActive, now)
+	if err != nil {
+		return 0, fmt.Errorf("查询到期的定时任务失败: %w", err)
+	}
+	grace := g.Cfg().MustGet(ctx, "command.schedule.misfireGrace", "1m").Duration()
+	submitted := 0
+	for _, row := range res {
+		s := scheduleFromRecord(row)
+		ok, err := runSchedule(ctx, s, now, grace)
+		if err != nil {
+			g.Log().Warningf(ctx, "执行定时任务 %d 失败: %v", s.Id, err)
+			continue
+		}
+		if ok {
+			submitted++
+		}
+	}
+	return submitted, nil
+}
+
+// runSchedule 执行一个到期的任务：先改写下一次执行时间占住这次执行（多实例时只有一个执行），再写入命令队列
+func runSchedule(ctx context.Context, s *CommandSchedule, now time.Time, grace time.Duration) (bool, error) {
+	due := *s.NextRunAt
+	missed := now.Sub(due) > grace && s.Misfire != MisfireRunOnce
+
+	status, next := s.Status, (*time.Time)(nil)
+	if s.Cron != "" {
+		cron, err := ParseCron(s.Cron)
+		if err != nil {
+			return false, err
+		}
+		if n := cron.Next(now); !n.IsZero() {
+			next = &n
+		} else {
+			status = ScheduleFinished
+		}
+	} else {
+		status = ScheduleFinished
+	}
+
+	set := []string{"status = ?", "next_run_at = ?", "updated_at = ?"}
+	args := []interface{}{status, nullableTime(next), now}
+	if missed {
+		set = append(set, "missed_count = missed_count + 1", "last_result = ?")
+		args = append(args, fmt.Sprintf("错过 %s 的执行（超过 %s），已跳过", due.Format("2006-01-02 15:04:05"), grace))
+	}
+	r, err := db.PgDB.Exec(ctx, `UPDATE `+ControlCommandScheduleTable+` SET `+strings.Join(set, ", ")+`
+		WHERE id = ? AND status = ? AND next_run_at = ?`, append(args, s.Id, ScheduleActive, due)...)
+	if err != nil {
+		return false, fmt.Errorf("更新定时任务失败: %w", err)
+	}
+	if n, _ := r.RowsAffected(); n == 0 || missed {
+		return false, nil
+	}
+
+	// 与 IssueOperateNew 相同：按当前操作模型校验后写入命令队列
+	req := s.CommandRequest
+	var (
+		cmd    *Command
+		result string
+	)
+	target, err := ValidateCommand(ctx, &req)
+	if err == nil {
+		cmd, err = submitCommand(ctx, &req, target, s.CreatedBy, s.Id)
+	}
+	var rej *CommandRejection
+	switch {
+	case errors.As(err, &rej):
+		result = "命令被拒绝：" + rej.Message
+	case err != nil:
+		result = fmt.Sprintf("命令受理失败: %v", err)
+	case now.Sub(due) > grace:
+		result = fmt.Sprintf("补执行错过的 %s，命令ID %d %s", due.Format("2006-01-02 15:04:05"), cmd.Id, cmd.Status)
+	default:
+		result = fmt.Sprintf("命令ID %d %s", cmd.Id, cmd.Status)
+	}
+	var commandId int64
+	if cmd != nil {
+		commandId = cmd.Id
+	}
+	if _, uerr := db.PgDB.Exec(ctx, `UPDATE `+ControlCommandScheduleTable+` SET last_run_at = ?, last_command_id = ?,
+		last_result = ?, run_count = run_count + 1, updated_at = ? WHERE id = ?`,
+		now, commandId, truncateString(result, 512), time.Now(), s.Id); uerr != nil {
+		g.Log().Warningf(ctx, "记录定时任务 %d 的执行结果失败: %v", s.Id, uerr)
+	}
+	if err != nil {
+		g.Log().Warningf(ctx, "定时任务 %d（%s %s）执行失败: %s", s.Id, s.PositionId, s.Name, result)
+		return false, nil
+	}
+	g.Log().Infof(ctx, "定时任务 %d（%s %s）已执行: %s", s.Id, s.PositionId, s.Name, result)
+	return true, nil
+}
+
+// PauseCommandSchedule 暂停 active 的任务
+func PauseCommandSchedule(ctx context.Context, id int64) (*CommandSchedule, error) {
+	return setScheduleStatus(ctx, id, []string{ScheduleActive}, SchedulePaused, nil)
+}
+
+// ResumeCommandSchedule 恢复 paused 的任务：周期任务从当前时间算下一次，一次性任务的执行时间已过时按 misfire 处理
+func ResumeCommandSchedule(ctx context.Context, id int64) (*CommandSchedule, error) {
+	s, err := GetCommandSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	extra := g.Map{}
+	if s.Cron != "" {
+		cron, err := ParseCron(s.Cron)
+		if err != nil {
+			return nil, err
+		}
+		next := cron.Next(time.Now())
+		if next.IsZero() {
+			return nil, fmt.Errorf("%w：cron 表达式 %q 没有执行时间", ErrScheduleInvalid, s.Cron)
+		}
+		extra["next_run_at"] = next
+	}
+	return setScheduleStatus(ctx, id, []string{SchedulePaused}, ScheduleActive, extra)
+}
+
+// CancelCommandSchedule 取消 active 或 paused 的任务，已经写入队列的命令不受影响
+func CancelCommandSchedule(ctx context.Context, id int64) (*CommandSchedule, error) {
+	return setScheduleStatus(ctx, id, []string{ScheduleActive, SchedulePaused}, ScheduleCancelled, g.Map{"next_run_at": nil})
+}
+
+// setScheduleStatus 任务处于 from 中的某个状态时改为 to，否则返回包装 ErrScheduleTransition 的错误
+func setScheduleStatus(ctx context.Context, id int64, from []string, to string, extra g.Map) (*CommandSchedule, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	set := []string{"status = ?", "updated_at = ?"}
+	args := []interface{}{to, time.Now()}
+	for k, v := range extra {
+		set = append(set, k+" = ?")
+		args = append(args, v)
+	}
+	args = append(args, id)
+	placeholders := make([]string, len(from))
+	for i, s := range from {
+		placeholders[i] = "?"
+		args = append(args, s)
+	}
+	r, err := db.PgDB.Exec(ctx, `UPDATE `+ControlCommandScheduleTable+` SET `+strings.Join(set, ", ")+`
+		WHERE id = ? AND status IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("更新定时任务失败: %w", err)
+	}
+	s, err := GetCommandSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("%w：定时任务状态为 %s", ErrScheduleTransition, s.Status)
+	}
+	return s, nil
+}
+
+const scheduleColumns = `id, station_id, position_id, name, para, paranew, frequency, client_ip, user_code, user_name, real_name, agent_type,
+	remark, cron, run_at, misfire, status, next_run_at, last_run_at, last_command_id, last_result, run_count, missed_count,
+	created_by, created_at, updated_at`
+
+func scheduleFromRecord(row gdb.Record) *CommandSchedule {
+	return &CommandSchedule{
+		Id: row["id"].Int64(),
+		CommandRequest: CommandRequest{
+			PositionId: row["position_id"].String(),
+			Name:       row["name"].String(),
+			Para:       row["para"].String(),
+			Paranew:    row["paranew"].String(),
+			Frequency:  row["frequency"].String(),
+			ClientIp:   row["client_ip"].String(),
+			UserCode:   row["user_code"].String(),
+			UserName:   row["user_name"].String(),
+			RealName:   row["real_name"].String(),
+			AgentType:  row["agent_type"].String(),
+		},
+		StationId:     row["station_id"].String(),
+		Remark:        row["remark"].String(),
+		Cron:          row["cron"].String(),
+		RunAt:         recordTime(row["run_at"]),
+		Misfire:       row["misfire"].String(),
+		Status:        row["status"].String(),
+		NextRunAt:     recordTime(row["next_run_at"]),
+		LastRunAt:     recordTime(row["last_run_at"]),
+		LastCommandId: row["last_command_id"].Int64(),
+		LastResult:    row["last_result"].String(),
+		RunCount:      row["run_count"].Int(),
+		MissedCount:   row["missed_count"].Int(),
+		CreatedBy:     row["created_by"].String(),
+		CreatedAt:     row["created_at"].Time(),
+		UpdatedAt:     row["updated_at"].Time(),
+	}
+}
+
+// GetCommandSchedule 查询一个定时任务
+func GetCommandSchedule(ctx context.Context, id int64) (*CommandSchedule, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	row, err := db.PgDB.GetOne(ctx, `SELECT `+scheduleColumns+` FROM `+ControlCommandScheduleTable+` WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("查询定时任务失败: %w", err)
+	}
+	if row.IsEmpty() {
+		return nil, ErrScheduleNotFound
+	}
+	return scheduleFromRecord(row), nil
+}
+
+// QueryCommandSchedules 分页查询定时任务，按创建时间倒序
+func QueryCommandSchedules(ctx context.Context, q CommandScheduleQuery) (list []*CommandSchedule, total int, err error) {
+	if err = checkDB(); err != nil {
+		return nil, 0, err
+	}
+	if q.PageIndex <= 0 {
+		q.PageIndex = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = 20
+	}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if q.PositionId != "" {
+		conds, args = append(conds, "position_id = ?"), append(args, q.PositionId)
+	}
+	if q.StationId != "" {
+		conds, args = append(conds, "station_id = ?"), append(args, q.StationId)
+	}
+	if q.Status != "" {
+		conds, args = append(conds, "status = ?"), append(args, q.Status)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	count, err := db.PgDB.GetValue(ctx, `SELECT COUNT(*) FROM `+ControlCommandScheduleTable+where, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询定时任务失败: %w", err)
+	}
+	res, err := db.PgDB.GetAll(ctx, `SELECT `+scheduleColumns+` FROM `+ControlCommandScheduleTable+where+
+		` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, q.PageSize, (q.PageIndex-1)*q.PageSize)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询定时任务失败: %w", err)
+	}
+	list = make([]*CommandSchedule, 0, len(res))
+	for _, row := range res {
+		list = append(list, scheduleFromRecord(row))
+	}
+	return list, count.Int(), nil
+}
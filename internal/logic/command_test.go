@@ -0,0 +1,95 @@
+package logic
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCommandResponseAccepted(t *testing.T) {
+	cases := []struct {
+		body        string
+		wantOk      bool
+		wantMessage string
+	}{
+		{`{"result":"success","message":"已下发"}`, true, "已下发"},
+		{`{"result":"OK"}`, true, "下发服务已接收"},
+		{`{"result":"error","message":"设备离线"}`, false, "下发服务返回失败：设备离线"},
+		{`{"result":"fail"}`, false, "下发服务返回失败"},
+		{`{"success":true,"msg":"done"}`, true, "done"},
+		{`{"success":false,"msg":"busy"}`, false, "下发服务返回失败：busy"},
+		{`{"code":0}`, true, "下发服务已接收"},
+		{`{"code":200,"Message":"ok"}`, true, "ok"},
+		{`{"code":"200"}`, true, "下发服务已接收"},
+		{`{"code":500,"message":"内部错误"}`, false, "下发服务返回错误码 500：内部错误"},
+		{`{"result":null,"code":null}`, true, "下发服务已接收"},
+		{`{}`, true, "下发服务已接收"},
+		{`[1,2]`, true, "下发服务已接收"},
+		{`"success"`, true, "下发服务已接收"},
+	}
+	for _, c := range cases {
+		var data interface{}
+		if err := json.Unmarshal([]byte(c.body), &data); err != nil {
+			t.Fatalf("%s: %v", c.body, err)
+		}
+		ok, message := commandResponseAccepted(data)
+		if ok != c.wantOk || message != c.wantMessage {
+			t.Errorf("%s = (%v, %q), want (%v, %q)", c.body, ok, message, c.wantOk, c.wantMessage)
+		}
+	}
+}
+
+func TestGroupCommandsByPosition(t *testing.T) {
+	cmd := func(id int64, positionId string) *Command {
+		c := &Command{Id: id}
+		c.PositionId = positionId
+		return c
+	}
+	commands := []*Command{cmd(1, "0101"), cmd(2, "0102"), cmd(3, "0101"), cmd(4, "0103"), cmd(5, "0102")}
+	var got [][]int64
+	for _, group := range groupCommandsByPosition(commands) {
+		var ids []int64
+		for _, c := range group {
+			ids = append(ids, c.Id)
+		}
+		got = append(got, ids)
+	}
+	want := [][]int64{{1, 3}, {2, 5}, {4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupCommandsByPosition = %v, want %v", got, want)
+	}
+	if groups := groupCommandsByPosition(nil); len(groups) != 0 {
+		t.Errorf("空队列应没有分组，得到 %v", groups)
+	}
+}
+
+func TestPositionWorkers(t *testing.T) {
+	w := &positionWorkers{busy: make(map[string]struct{})}
+	if !w.start("0101", 2) || !w.start("0102", 2) {
+		t.Fatal("没有达到并发上限时应能开始转发")
+	}
+	if w.start("0101", 2) {
+		t.Error("同一工位号同时只能有一个转发协程")
+	}
+	if w.start("0103", 2) {
+		t.Error("达到并发上限时不应开始转发")
+	}
+	got := w.positions()
+	sort.Strings(got)
+	if want := []string{"0101", "0102"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("正在转发的工位号为 %v，期望 %v", got, want)
+	}
+
+	w.done("0101")
+	if !w.start("0103", 2) {
+		t.Error("工位号转发结束后应空出并发名额")
+	}
+	if w.start("0101", 2) {
+		t.Error("并发名额被占满后不应开始转发")
+	}
+	w.done("0102")
+	if !w.start("0101", 2) {
+		t.Error("工位号转发结束后应能再次开始转发")
+	}
+}
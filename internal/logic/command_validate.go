@@ -0,0 +1,385 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/redis/go-redis/v9"
+)
+
+// 控制命令下发前的校验。
+// 台站节点上的 operate_model_id 指向 svr_operations_model 中的操作模型，模型是 操作 → 操作定义 的对象，
+// 操作定义中识别以下字段（都可以省略）：
+//   - name / operate_name：操作名，省略时为操作的 key；
+//   - para / parno：操作写入的参数，省略时不限制命令的 para；
+//   - readback_parno / readback：下发后回读确认时在 svr_DATA 中读取的字段，省略时为 para/parno；
+//   - min / max：paranew 的数值范围（包含边界）；
+//   - options / values：paranew 的候选值，数组或逗号分隔的字符串；
+//   - type / data_type：paranew 的类型，int、float/number、bool 或 string；
+//   - is_enable：为 0 时该操作停用；
+//   - critical：为 1/true 时是关键操作，下发前需要审批（见 command_approval.go）。
+//
+// 命令的 positionId 必须是台站模型中某个节点的工位号，name 和 para 必须匹配该节点操作模型中的一个操作，
+// paranew 必须满足操作定义的类型、范围和候选值。不满足时返回 *CommandRejection，命令不会转发到发射机。
+// command.validate.enabled=false 时不校验；command.validate.allowUnmodeled=true 时节点没有操作模型的命令直接放行。
+
+// 命令被拒绝的原因
+const (
+	RejectMissingField     = "missing_field"      // 缺少必填字段
+	RejectUnknownPosition  = "unknown_position"   // 工位号不在台站模型中
+	RejectNoOperateModel   = "no_operate_model"   // 节点没有操作模型，或模型在 svr_operations_model 中不存在
+	RejectUnknownOperation = "unknown_operation"  // 操作模型中没有这个操作
+	RejectParaMismatch     = "para_mismatch"      // 操作存在，但 para 不匹配
+	RejectOperationOff     = "operation_disabled" // 操作已停用
+	RejectInvalidValue     = "invalid_value"      // paranew 类型不对
+	RejectOutOfRange       = "value_out_of_range" // paranew 超出范围
+	RejectNotAllowed       = "value_not_allowed"  // paranew 不在候选值中
+	RejectLoginRequired    = "login_required"     // 需要审批的关键操作，鉴权上下文中没有用户
+)
+
+// CommandRequest 台站客户端下发的控制命令，字段名和 IssueOperateNew 接口一致
+type CommandRequest struct {
+	PositionId string `json:"positionId"`
+	Name       string `json:"name"`
+	Para       string `json:"para"`
+	Paranew    string `json:"paranew"`
+	Frequency  string `json:"frequency"`
+	ClientIp   string `json:"clientIp"`
+	UserCode   string `json:"userCode"`
+	UserName   string `json:"UserName"`
+	RealName   string `json:"realName"`
+	AgentType  string `json:"AgentType"`
+}
+
+// FormData 转发给下发服务的参数
+func (c *CommandRequest) FormData() g.Map {
+	return g.Map{
+		"positionId": c.PositionId,
+		"name":       c.Name,
+		"para":       c.Para,
+		"paranew":    c.Paranew,
+		"frequency":  c.Frequency,
+		"clientIp":   c.ClientIp,
+		"userCode":   c.UserCode,
+		"UserName":   c.UserName,
+		"realName":   c.RealName,
+		"AgentType":  c.AgentType,
+	}
+}
+
+// CommandRejection 命令校验不通过的原因
+type CommandRejection struct {
+	Code           string      `json:"code"`
+	Field          string      `json:"field,omitempty"` // 出错的命令字段
+	Message        string      `json:"message"`
+	PositionId     string      `json:"positionId,omitempty"`
+	OperateModelId string      `json:"operateModelId,omitempty"`
+	Allowed        interface{} `json:"allowed,omitempty"` // 允许的取值：操作列表、para、范围或候选值
+}
+
+func (e *CommandRejection) Error() string {
+	return e.Message
+}
+
+// OperationDef 操作模型中的一个操作
+type OperationDef struct {
+	Key      string   `json:"key"`
+	Name     string   `json:"name"`
+	Para     string   `json:"para,omitempty"`
+	Readback string   `json:"readback,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Options  []string `json:"options,omitempty"`
+	Disabled bool     `json:"disabled,omitempty"`
+	Critical bool     `json:"critical,omitempty"`
+}
+
+// CommandTarget 校验通过的命令对应的节点和操作
+type CommandTarget struct {
+	StationId      string        `json:"stationId"`
+	Path           string        `json:"path"`
+	OperateModelId string        `json:"operateModelId,omitempty"`
+	Operation      *OperationDef `json:"operation,omitempty"` // allowUnmodeled 放行时为 nil
+}
+
+// ValidateCommand 校验控制命令。校验不通过返回 *CommandRejection；读取模型失败返回其他错误，此时也不应下发。
+// 校验关闭时返回的 CommandTarget 为 nil。
+func ValidateCommand(ctx context.Context, req *CommandRequest) (*CommandTarget, error) {
+	if !g.Cfg().MustGet(ctx, "command.validate.enabled", true).Bool() {
+		return nil, nil
+	}
+	req.PositionId, req.Name, req.Para, req.Paranew = strings.TrimSpace(req.PositionId), strings.TrimSpace(req.Name), strings.TrimSpace(req.Para), strings.TrimSpace(req.Paranew)
+	for _, f := range []struct{ field, value string }{{"positionId", req.PositionId}, {"name", req.Name}} {
+		if f.value == "" {
+			return nil, &CommandRejection{Code: RejectMissingField, Field: f.field, Message: fmt.Sprintf("缺少参数 %s", f.field)}
+		}
+	}
+
+	target, found, err := LocateCommandNode(ctx, req.PositionId)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &CommandRejection{Code: RejectUnknownPosition, Field: "positionId", PositionId: req.PositionId,
+			Message: fmt.Sprintf("工位号 %s 不在台站模型中", req.PositionId)}
+	}
+
+	cache, err := GetModelCache(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("读取操作模型失败: %w", err)
+	}
+	raw, ok := cache.Operations[target.OperateModelId]
+	if target.OperateModelId == "" || !ok {
+		if g.Cfg().MustGet(ctx, "command.validate.allowUnmodeled", false).Bool() {
+			g.Log().Warningf(ctx, "工位号 %s 没有操作模型，命令 %s 未经校验放行", req.PositionId, req.Name)
+			return target, nil
+		}
+		msg := fmt.Sprintf("工位号 %s 的节点没有操作模型", req.PositionId)
+		if target.OperateModelId != "" {
+			msg = fmt.Sprintf("操作模型 %s 在 %s 中不存在", target.OperateModelId, OperationsModelKey)
+		}
+		return nil, &CommandRejection{Code: RejectNoOperateModel, Field: "positionId", PositionId: req.PositionId,
+			OperateModelId: target.OperateModelId, Message: msg}
+	}
+
+	op, rej := matchOperation(ParseOperationDefs(raw), req)
+	if rej == nil && op != nil {
+		rej = checkOperationValue(op, req.Paranew)
+	}
+	if rej != nil {
+		rej.PositionId, rej.OperateModelId = req.PositionId, target.OperateModelId
+		return nil, rej
+	}
+	target.Operation = op
+	return target, nil
+}
+
+// LocateCommandNode 在台站模型中找工位号所在的节点，台站取工位号的台站部分。
+// redis 中没有该台站的模型时和总览一样回退到 station_node 表（overview.fallback.stationNode）。
+func LocateCommandNode(ctx context.Context, positionId string) (target *CommandTarget, found bool, err error) {
+	stationId := stationOfPosition(positionId)
+	_, idx, err := LoadStationModelFromRedis(ctx, stationId)
+	if errors.Is(err, redis.Nil) {
+		if !g.Cfg().MustGet(ctx, "overview.fallback.stationNode", true).Bool() {
+			return nil, false, nil
+		}
+		rows, dbErr := LoadStationNodes(ctx, stationId)
+		if dbErr != nil {
+			return nil, false, dbErr
+		}
+		idx, _ = BuildIdxFromStationNodes(rows)
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	target = &CommandTarget{StationId: stationId}
+	found = findCommandNode(idx, nil, positionId, target)
+	return target, found, nil
+}
+
+// findCommandNode 深度优先查找 positionId 等于工位号的节点，同一工位号出现在多个节点上时优先取有操作模型的节点。
+// rConfig 下的内容属于所在节点，不计入路径。
+func findCommandNode(idx map[string]interface{}, path []string, positionId string, target *CommandTarget) bool {
+	found := false
+	if gconv.String(idx["positionId"]) == positionId {
+		found = true
+		target.Path = strings.Join(path, "/")
+		target.OperateModelId = gconv.String(idx["operate_model_id"])
+		if target.OperateModelId != "" {
+			return true
+		}
+	}
+	keys := make([]string, 0, len(idx))
+	for k, v := range idx {
+		if _, ok := v.(map[string]interface{}); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sub := idx[k].(map[string]interface{})
+		subPath := path
+		if k != "rConfig" {
+			subPath = append(append([]string{}, path...), k)
+		}
+		var t CommandTarget
+		if findCommandNode(sub, subPath, positionId, &t) {
+			if !found || t.OperateModelId != "" {
+				target.Path, target.OperateModelId = t.Path, t.OperateModelId
+				found = true
+			}
+			if t.OperateModelId != "" {
+				return true
+			}
+		}
+	}
+	return found
+}
+
+// ParseOperationDefs 解析一个操作模型，按 key 排序
+func ParseOperationDefs(raw map[string]map[string]interface{}) []*OperationDef {
+	defs := make([]*OperationDef, 0, len(raw))
+	for key, def := range raw {
+		op := &OperationDef{
+			Key:      key,
+			Name:     firstModelString(def, "name", "operate_name"),
+			Para:     firstModelString(def, "para", "parno"),
+			Readback: firstModelString(def, "readback_parno", "readback"),
+			Type:     strings.ToLower(firstModelString(def, "type", "data_type")),
+		}
+		if op.Name == "" {
+			op.Name = key
+		}
+		if v, ok := limitValue(def, "min"); ok {
+			op.Min = &v
+		}
+		if v, ok := limitValue(def, "max"); ok {
+			op.Max = &v
+		}
+		for _, field := range []string{"options", "values"} {
+			if v, ok := def[field]; ok && v != nil {
+				op.Options = parseOperationOptions(v)
+				break
+			}
+		}
+		if v, ok := def["is_enable"]; ok && v != nil && gconv.String(v) == "0" {
+			op.Disabled = true
+		}
+		if v, ok := def["critical"]; ok && v != nil {
+			op.Critical = gconv.Bool(v)
+		}
+		defs = append(defs, op)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Key < defs[j].Key })
+	return defs
+}
+
+func firstModelString(def map[string]interface{}, fields ...string) string {
+	for _, f := range fields {
+		if s := strings.TrimSpace(gconv.String(def[f])); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func parseOperationOptions(v interface{}) []string {
+	var items []string
+	if list, ok := v.([]interface{}); ok {
+		for _, item := range list {
+			items = append(items, gconv.String(item))
+		}
+	} else {
+		items = strings.Split(gconv.String(v), ",")
+	}
+	options := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			options = append(options, item)
+		}
+	}
+	return options
+}
+
+// matchOperation 按 name 和 para 找操作，都不区分大小写；操作没有限定 para 时任何 para 都匹配
+func matchOperation(defs []*OperationDef, req *CommandRequest) (*OperationDef, *CommandRejection) {
+	var named []*OperationDef
+	for _, op := range defs {
+		if strings.EqualFold(op.Name, req.Name) || strings.EqualFold(op.Key, req.Name) {
+			named = append(named, op)
+		}
+	}
+	if len(named) == 0 {
+		names := make([]string, 0, len(defs))
+		for _, op := range defs {
+			names = append(names, op.Name)
+		}
+		return nil, &CommandRejection{Code: RejectUnknownOperation, Field: "name", Allowed: names,
+			Message: fmt.Sprintf("设备不支持操作 %s", req.Name)}
+	}
+
+	var paras []string
+	for _, op := range named {
+		if op.Para == "" || strings.EqualFold(op.Para, req.Para) {
+			if op.Disabled {
+				return nil, &CommandRejection{Code: RejectOperationOff, Field: "name", Message: fmt.Sprintf("操作 %s 已停用", req.Name)}
+			}
+			return op, nil
+		}
+		paras = append(paras, op.Para)
+	}
+	return nil, &CommandRejection{Code: RejectParaMismatch, Field: "para", Allowed: paras,
+		Message: fmt.Sprintf("操作 %s 不支持参数 %s", req.Name, req.Para)}
+}
+
+// checkOperationValue 按操作定义检查 paranew。定义中没有类型、范围和候选值时不检查。
+// 候选值、类型和范围都要满足：候选值中的值同样要符合类型和范围，模型配置错误时不会放过越界的值。
+func checkOperationValue(op *OperationDef, value string) *CommandRejection {
+	constrained := op.Type != "" && op.Type != "string" || op.Min != nil || op.Max != nil || len(op.Options) > 0
+	if !constrained {
+		return nil
+	}
+	if value == "" {
+		return &CommandRejection{Code: RejectMissingField, Field: "paranew", Message: fmt.Sprintf("操作 %s 缺少参数 paranew", op.Name)}
+	}
+
+	if len(op.Options) > 0 {
+		allowed := false
+		for _, o := range op.Options {
+			if strings.EqualFold(o, value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &CommandRejection{Code: RejectNotAllowed, Field: "paranew", Allowed: op.Options,
+				Message: fmt.Sprintf("paranew=%s 不是操作 %s 的可选值", value, op.Name)}
+		}
+	}
+
+	switch op.Type {
+	case "bool", "boolean":
+		if v := strings.ToLower(value); v != "0" && v != "1" && v != "true" && v != "false" {
+			return &CommandRejection{Code: RejectInvalidValue, Field: "paranew", Message: fmt.Sprintf("paranew=%s 不是布尔值", value)}
+		}
+		return nil
+	case "string":
+		return nil
+	case "":
+		// 只配置了候选值时不要求是数值
+		if op.Min == nil && op.Max == nil {
+			return nil
+		}
+	}
+
+	num, ok := numericValue(value)
+	if !ok || math.IsNaN(num) || math.IsInf(num, 0) {
+		return &CommandRejection{Code: RejectInvalidValue, Field: "paranew", Message: fmt.Sprintf("paranew=%s 不是数值", value)}
+	}
+	if (op.Type == "int" || op.Type == "integer") && num != math.Trunc(num) {
+		return &CommandRejection{Code: RejectInvalidValue, Field: "paranew", Message: fmt.Sprintf("paranew=%s 不是整数", value)}
+	}
+	if op.Min != nil && num < *op.Min || op.Max != nil && num > *op.Max {
+		return &CommandRejection{Code: RejectOutOfRange, Field: "paranew", Allowed: g.Map{"min": op.Min, "max": op.Max},
+			Message: fmt.Sprintf("paranew=%s 超出操作 %s 的范围%s", value, op.Name, formatRange(op.Min, op.Max))}
+	}
+	return nil
+}
+
+func formatRange(lower, upper *float64) string {
+	lo, hi := "-∞", "+∞"
+	if lower != nil {
+		lo = gconv.String(*lower)
+	}
+	if upper != nil {
+		hi = gconv.String(*upper)
+	}
+	return fmt.Sprintf(" [%s, %s]", lo, hi)
+}
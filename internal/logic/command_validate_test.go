@@ -0,0 +1,90 @@
+package logic
+
+import (
+	"testing"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestMatchOperation(t *testing.T) {
+	defs := ParseOperationDefs(map[string]map[string]interface{}{
+		"power_on":  {"name": "开机"},
+		"power_off": {"name": "关机", "is_enable": "0"},
+		"set_a":     {"name": "功率", "para": "PowerA"},
+		"set_b":     {"name": "功率", "para": "PowerB"},
+	})
+	cases := []struct {
+		name     string
+		req      CommandRequest
+		wantKey  string
+		wantCode string
+	}{
+		{"按名称匹配", CommandRequest{Name: "开机", Para: "x"}, "power_on", ""},
+		{"按 key 匹配且不区分大小写", CommandRequest{Name: "POWER_ON"}, "power_on", ""},
+		{"para 不区分大小写", CommandRequest{Name: "功率", Para: "powerb"}, "set_b", ""},
+		{"未知操作", CommandRequest{Name: "复位"}, "", RejectUnknownOperation},
+		{"para 不匹配", CommandRequest{Name: "功率", Para: "PowerC"}, "", RejectParaMismatch},
+		{"操作已停用", CommandRequest{Name: "关机"}, "", RejectOperationOff},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := c.req
+			op, rej := matchOperation(defs, &req)
+			if c.wantCode != "" {
+				if rej == nil || rej.Code != c.wantCode {
+					t.Fatalf("rejection = %+v, want code %s", rej, c.wantCode)
+				}
+				return
+			}
+			if rej != nil {
+				t.Fatalf("不应拒绝: %+v", rej)
+			}
+			if op.Key != c.wantKey {
+				t.Errorf("匹配到 %s, want %s", op.Key, c.wantKey)
+			}
+		})
+	}
+}
+
+func TestCheckOperationValue(t *testing.T) {
+	cases := []struct {
+		name     string
+		op       OperationDef
+		value    string
+		wantCode string
+	}{
+		{"没有约束", OperationDef{}, "", ""},
+		{"string 类型不检查", OperationDef{Type: "string"}, "anything", ""},
+		{"有约束时必填", OperationDef{Type: "int"}, "", RejectMissingField},
+		{"整数", OperationDef{Type: "int"}, "12", ""},
+		{"整数带小数", OperationDef{Type: "int"}, "1.5", RejectInvalidValue},
+		{"非数值", OperationDef{Type: "float"}, "abc", RejectInvalidValue},
+		{"NaN", OperationDef{Type: "float"}, "NaN", RejectInvalidValue},
+		{"布尔", OperationDef{Type: "bool"}, "TRUE", ""},
+		{"布尔非法", OperationDef{Type: "bool"}, "2", RejectInvalidValue},
+		{"范围内", OperationDef{Min: floatPtr(0), Max: floatPtr(10)}, "10", ""},
+		{"低于下限", OperationDef{Min: floatPtr(0)}, "-1", RejectOutOfRange},
+		{"高于上限", OperationDef{Max: floatPtr(10)}, "10.1", RejectOutOfRange},
+		{"候选值不区分大小写", OperationDef{Options: []string{"AUTO", "MANUAL"}}, "auto", ""},
+		{"不在候选值中", OperationDef{Options: []string{"AUTO", "MANUAL"}}, "off", RejectNotAllowed},
+		// 候选值和类型、范围同时配置时都要满足
+		{"候选值在范围内", OperationDef{Type: "int", Max: floatPtr(10), Options: []string{"5", "20"}}, "5", ""},
+		{"候选值超出范围", OperationDef{Type: "int", Max: floatPtr(10), Options: []string{"5", "20"}}, "20", RejectOutOfRange},
+		{"候选值类型不对", OperationDef{Type: "int", Options: []string{"1", "on"}}, "on", RejectInvalidValue},
+		{"候选值不是布尔值", OperationDef{Type: "bool", Options: []string{"0", "1", "2"}}, "2", RejectInvalidValue},
+		{"不在候选值中先报候选值", OperationDef{Type: "int", Max: floatPtr(10), Options: []string{"5"}}, "50", RejectNotAllowed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			op := c.op
+			op.Name = "测试"
+			rej := checkOperationValue(&op, c.value)
+			switch {
+			case c.wantCode == "" && rej != nil:
+				t.Errorf("不应拒绝: %+v", rej)
+			case c.wantCode != "" && (rej == nil || rej.Code != c.wantCode):
+				t.Errorf("rejection = %+v, want code %s", rej, c.wantCode)
+			}
+		})
+	}
+}
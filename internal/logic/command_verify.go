@@ -0,0 +1,153 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 控制命令的回读确认。
+// 下发服务接收命令（acknowledged）之后，每次检查读取 svr_DATA_<positionId> 中的回读字段（操作模型的 readback_parno，
+// 没有时为 para/parno）：和 paranew 一致时记为 verified，超过 command.verify.timeout（默认30s）仍不一致时记为 failed。
+// 数值按 command.verify.tolerance（默认0）比较，其他值不区分大小写比较。
+// 每个结果写一条 operation_log（log_type 为 command.verify.logType，默认“操作”），通过 /Resource/GetOpLog 可以查到。
+// 没有回读字段或 paranew 为空的命令无法回读，停在 acknowledged。command.verify.enabled=false 时不回读。
+
+// OperationLogTable 用户操作日志表，GetOpLog 从这里查询
+const OperationLogTable = "operation_log"
+
+// readbackParno 命令回读的字段：操作模型的 readback_parno，其次是操作的 para/parno，最后是命令的 para
+func readbackParno(req *CommandRequest, target *CommandTarget) string {
+	if target != nil && target.Operation != nil {
+		if target.Operation.Readback != "" {
+			return target.Operation.Readback
+		}
+		if target.Operation.Para != "" {
+			return target.Operation.Para
+		}
+	}
+	return req.Para
+}
+
+// VerifyCommands 回读 acknowledged 的命令，返回得出结果（verified 或 failed）的条数
+func VerifyCommands(ctx context.Context) (int, error) {
+	if !g.Cfg().MustGet(ctx, "command.verify.enabled", true).Bool() {
+		return 0, nil
+	}
+	if err := checkDB(); err != nil {
+		return 0, err
+	}
+	res, err := db.PgDB.GetAll(ctx, `SELECT `+commandColumns+` FROM `+ControlCommandTable+`
+		WHERE status = ? AND readback_parno <> '' AND paranew <> '' ORDER BY id LIMIT ?`,
+		CommandAcknowledged, g.Cfg().MustGet(ctx, "command.batchSize", 20).Int())
+	if err != nil {
+		return 0, fmt.Errorf("查询待回读的命令失败: %w", err)
+	}
+	if len(res) == 0 {
+		return 0, nil
+	}
+
+	cmds := make([]*Command, 0, len(res))
+	nums := make([]string, 0, len(res))
+	for _, row := range res {
+		cmd := commandFromRecord(row)
+		cmds = append(cmds, cmd)
+		nums = append(nums, cmd.PositionId)
+	}
+	// 部分 key 读取失败时按没有数据处理，超时前下次再读
+	data, err := PreloadDataByNums(ctx, nums)
+	var preloadErr *PreloadError
+	if err != nil && !errors.As(err, &preloadErr) {
+		return 0, err
+	}
+
+	timeout := g.Cfg().MustGet(ctx, "command.verify.timeout", "30s").Duration()
+	tolerance := g.Cfg().MustGet(ctx, "command.verify.tolerance", 0).Float64()
+	now := time.Now()
+	done := 0
+	for _, cmd := range cmds {
+		value, found := readbackField(data[DataKey(cmd.PositionId)], cmd.ReadbackParno)
+		var status, message string
+		switch {
+		case found && readbackMatches(value, cmd.Paranew, tolerance):
+			status, message = CommandVerified, fmt.Sprintf("回读 %s=%s，与设定值一致", cmd.ReadbackParno, value)
+		case cmd.AckedAt != nil && now.Sub(*cmd.AckedAt) >= timeout:
+			status = CommandFailed
+			if found {
+				message = fmt.Sprintf("回读超时：%s 当前为 %s，设定值为 %s", cmd.ReadbackParno, value, cmd.Paranew)
+			} else {
+				message = fmt.Sprintf("回读超时：%s 中没有 %s", DataKey(cmd.PositionId), cmd.ReadbackParno)
+			}
+		default:
+			continue
+		}
+
+		changed, err := SetCommandStatus(ctx, cmd.Id, []string{CommandAcknowledged}, status, message, g.Map{"readback_value": value})
+		if err != nil {
+			return done, err
+		}
+		if !changed {
+			continue
+		}
+		done++
+		cmd.ReadbackValue = value
+		detail := fmt.Sprintf("控制命令 %s 回读确认成功", cmd.Name)
+		if status != CommandVerified {
+			detail = fmt.Sprintf("控制命令 %s 回读确认失败", cmd.Name)
+		}
+		if err := writeCommandOpLog(ctx, cmd, commandOperator(cmd), cmd.RealName, detail, fmt.Sprintf("命令ID %d %s：%s", cmd.Id, status, message)); err != nil {
+			g.Log().Warningf(ctx, "命令 %d 的回读结果写入 %s 失败: %v", cmd.Id, OperationLogTable, err)
+		}
+	}
+	return done, nil
+}
+
+// readbackField 在 svr_DATA 中取回读字段，先精确匹配，再不区分大小写匹配
+func readbackField(data map[string]string, parno string) (string, bool) {
+	if v, ok := data[parno]; ok {
+		return v, true
+	}
+	for k, v := range data {
+		if strings.EqualFold(k, parno) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// readbackMatches 回读值是否等于设定值：两边都是数值时按容差比较，否则去掉空白后不区分大小写比较
+func readbackMatches(value, expected string, tolerance float64) bool {
+	v, okV := numericValue(value)
+	e, okE := numericValue(expected)
+	if okV && okE {
+		return math.Abs(v-e) <= tolerance
+	}
+	return strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(expected))
+}
+
+// commandOperator 命令的操作人：有鉴权上下文中的申请人时用申请人，否则用客户端上报的 userName
+func commandOperator(cmd *Command) string {
+	if cmd.RequestedBy != "" {
+		return cmd.RequestedBy
+	}
+	return cmd.UserName
+}
+
+// writeCommandOpLog 把命令的回读结果、审批申请和审批结果写入 operation_log，userName/realName 为操作人
+func writeCommandOpLog(ctx context.Context, cmd *Command, userName, realName, detail, remarks string) error {
+	_, err := db.PgDB.Exec(ctx, `INSERT INTO `+OperationLogTable+` (user_name, ip_addr, station_id, postion_id, operate_detail,
+		operate_time, real_name, frequency, para_data, remarks, log_type) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userName, cmd.ClientIp, cmd.StationId, cmd.PositionId, detail,
+		time.Now().Format("2006-01-02 15:04:05"), realName, cmd.Frequency,
+		fmt.Sprintf("para=%s paranew=%s %s=%s", cmd.Para, cmd.Paranew, cmd.ReadbackParno, cmd.ReadbackValue),
+		truncateString(remarks, 512),
+		g.Cfg().MustGet(ctx, "command.verify.logType", "操作").String())
+	return err
+}
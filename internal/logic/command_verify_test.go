@@ -0,0 +1,78 @@
+package logic
+
+import "testing"
+
+func TestReadbackMatches(t *testing.T) {
+	cases := []struct {
+		value, expected string
+		tolerance       float64
+		want            bool
+	}{
+		{"10", "10", 0, true},
+		{"10.0", "10", 0, true},
+		{"10.2", "10", 0, false},
+		{"10.2", "10", 0.5, true},
+		{"9.5", "10", 0.5, true},
+		{"9.4", "10", 0.5, false},
+		{" ON ", "on", 0, true},
+		{"on", "off", 0, false},
+		{"", "0", 0, false},
+		{"1", "true", 0, false},
+	}
+	for _, c := range cases {
+		if got := readbackMatches(c.value, c.expected, c.tolerance); got != c.want {
+			t.Errorf("readbackMatches(%q, %q, %v) = %v, want %v", c.value, c.expected, c.tolerance, got, c.want)
+		}
+	}
+}
+
+func TestReadbackField(t *testing.T) {
+	data := map[string]string{"Power": "10", "status": "1"}
+	cases := []struct {
+		parno  string
+		want   string
+		wantOk bool
+	}{
+		{"Power", "10", true},
+		{"power", "10", true},
+		{"STATUS", "1", true},
+		{"Missing", "", false},
+	}
+	for _, c := range cases {
+		got, ok := readbackField(data, c.parno)
+		if got != c.want || ok != c.wantOk {
+			t.Errorf("readbackField(%q) = (%q, %v), want (%q, %v)", c.parno, got, ok, c.want, c.wantOk)
+		}
+	}
+}
+
+func TestReadbackParno(t *testing.T) {
+	req := &CommandRequest{Para: "ReqPara"}
+	cases := []struct {
+		name   string
+		target *CommandTarget
+		want   string
+	}{
+		{"没有操作模型", nil, "ReqPara"},
+		{"操作没有 para", &CommandTarget{Operation: &OperationDef{}}, "ReqPara"},
+		{"操作的 para", &CommandTarget{Operation: &OperationDef{Para: "OpPara"}}, "OpPara"},
+		{"readback_parno 优先", &CommandTarget{Operation: &OperationDef{Para: "OpPara", Readback: "Rb"}}, "Rb"},
+	}
+	for _, c := range cases {
+		if got := readbackParno(req, c.target); got != c.want {
+			t.Errorf("%s: readbackParno = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCommandOperator(t *testing.T) {
+	cmd := &Command{RequestedBy: "zhangsan"}
+	cmd.UserName = "客户端上报"
+	if got := commandOperator(cmd); got != "zhangsan" {
+		t.Errorf("有申请人时应记在申请人名下，得到 %s", got)
+	}
+	cmd.RequestedBy = ""
+	if got := commandOperator(cmd); got != "客户端上报" {
+		t.Errorf("没有申请人时应使用 userName，得到 %s", got)
+	}
+}
@@ -0,0 +1,99 @@
+package logic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * FOO *",
+		"@every",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) 应返回错误", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	// 2026-10-18 是周日
+	cases := []struct {
+		expr  string
+		after string
+		want  string
+	}{
+		{"* * * * *", "2026-10-18 10:00", "2026-10-18 10:01"},
+		{"30 8 * * *", "2026-10-18 10:00", "2026-10-19 08:30"},
+		{"30 8 * * *", "2026-10-18 08:29", "2026-10-18 08:30"},
+		{"30 8 * * *", "2026-10-18 08:30", "2026-10-19 08:30"},
+		{"*/15 * * * *", "2026-10-18 10:01", "2026-10-18 10:15"},
+		{"10/20 * * * *", "2026-10-18 10:31", "2026-10-18 10:50"},
+		{"0 9-17/4 * * *", "2026-10-18 13:00", "2026-10-18 17:00"},
+		{"0,30 6 * * *", "2026-10-18 06:10", "2026-10-18 06:30"},
+		{"0 0 * * MON-FRI", "2026-10-17 12:00", "2026-10-19 00:00"},
+		{"0 0 * * 7", "2026-10-12 00:00", "2026-10-18 00:00"},
+		{"0 0 * * 0", "2026-10-12 00:00", "2026-10-18 00:00"},
+		{"0 0 1 JAN *", "2026-10-18 00:00", "2027-01-01 00:00"},
+		{"0 0 31 * *", "2026-11-01 00:00", "2026-12-31 00:00"},
+		{"0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		// 日和周都有限制时满足其一即可
+		{"0 0 20 * 1", "2026-10-18 00:00", "2026-10-19 00:00"},
+		{"0 0 19 * 6", "2026-10-18 00:00", "2026-10-19 00:00"},
+		{"@daily", "2026-10-18 10:00", "2026-10-19 00:00"},
+		{"@hourly", "2026-10-18 10:59", "2026-10-18 11:00"},
+		{"@weekly", "2026-10-18 10:00", "2026-10-25 00:00"},
+		{"@monthly", "2026-10-18 10:00", "2026-11-01 00:00"},
+		{"@yearly", "2026-10-18 10:00", "2027-01-01 00:00"},
+	}
+	for _, c := range cases {
+		cron, err := ParseCron(c.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", c.expr, err)
+			continue
+		}
+		if got := cron.Next(at(c.after)); !got.Equal(at(c.want)) {
+			t.Errorf("%q Next(%s) = %s, want %s", c.expr, c.after, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+}
+
+func TestCronNextSecondsTruncated(t *testing.T) {
+	cron, err := ParseCron("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Date(2026, 10, 18, 10, 0, 59, 999, time.UTC)
+	if got, want := cron.Next(after), time.Date(2026, 10, 18, 10, 1, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestCronNextNever(t *testing.T) {
+	cron, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cron.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("2月30日不应有执行时间，得到 %s", got)
+	}
+}
@@ -0,0 +1,353 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 本地历史库，表结构见 manifest/sql/0006_historian.sql。
+// 外部历史服务（external.hisDataService）是单点，它不可用时 DevHis 就没有数据。采样协程每 historian.interval
+// 读取 historian.positions 中配置的工位号的 svr_DATA_*，写入 PostgreSQL 的 his_sample 表：
+//   - historian.onChange=true（默认）时只在值变化（数值变化超过 historian.deadband）或距上次写入超过 historian.maxGap 时写入；
+//   - 每 historian.rollup.interval 把最近两个小时的数值汇总到 his_rollup_hour（avg/min/max/last/count）；
+//   - 原始采样保留 historian.retainDays（默认30）天，小时汇总保留 historian.rollup.retainDays（默认365）天。
+//
+// historian.positions 的每一项可以是工位号字符串（记录所有字段），也可以是 {positionId, parnos} 只记录部分字段。
+
+// 本地历史表名
+const (
+	HistorianSampleTable = "his_sample"
+	HistorianRollupTable = "his_rollup_hour"
+)
+
+// HistorianPosition 一个采样的工位号，Parnos 为空表示所有字段
+type HistorianPosition struct {
+	PositionId string   `json:"positionId"`
+	Parnos     []string `json:"parnos"`
+}
+
+// historianLast 每个字段上一次写入的值
+type historianLast struct {
+	raw string
+	at  time.Time
+}
+
+var historianStarted atomic.Bool
+
+// LoadHistorianPositions 读取 historian.positions
+func LoadHistorianPositions(ctx context.Context) ([]HistorianPosition, error) {
+	v, err := g.Cfg().Get(ctx, "historian.positions")
+	if err != nil || v.IsNil() {
+		return nil, err
+	}
+	positions := make([]HistorianPosition, 0)
+	for _, item := range v.Slice() {
+		if s, ok := item.(string); ok {
+			positions = append(positions, HistorianPosition{PositionId: s})
+			continue
+		}
+		var p HistorianPosition
+		if err := g.NewVar(item).Scan(&p); err != nil || p.PositionId == "" {
+			return nil, fmt.Errorf("historian.positions 中的 %v 格式错误", item)
+		}
+		positions = append(positions, p)
+	}
+	return positions, nil
+}
+
+// StartHistorian 启动本地历史采样；historian.enabled=false 或没有配置 historian.positions 时不启动
+func StartHistorian(ctx context.Context) {
+	if !g.Cfg().MustGet(ctx, "historian.enabled", true).Bool() {
+		return
+	}
+	positions, err := LoadHistorianPositions(ctx)
+	if err != nil {
+		g.Log().Warningf(ctx, "读取本地历史采样配置失败: %v", err)
+		return
+	}
+	if len(positions) == 0 {
+		return
+	}
+	if !historianStarted.CompareAndSwap(false, true) {
+		return
+	}
+
+	interval := g.Cfg().MustGet(ctx, "historian.interval", "10s").Duration()
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	rollupInterval := g.Cfg().MustGet(ctx, "historian.rollup.interval", "10m").Duration()
+	if rollupInterval <= 0 {
+		rollupInterval = 10 * time.Minute
+	}
+	retainDays := g.Cfg().MustGet(ctx, "historian.retainDays", 30).Int()
+	rollupRetainDays := g.Cfg().MustGet(ctx, "historian.rollup.retainDays", 365).Int()
+
+	go func() {
+		last := make(map[string]historianLast)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastRollup, lastPurge time.Time
+		for {
+			if err := sampleHistorian(ctx, positions, last); err != nil {
+				g.Log().Warningf(ctx, "本地历史采样失败: %v", err)
+			}
+			if time.Since(lastRollup) >= rollupInterval {
+				if err := rollupHistorian(ctx, time.Now()); err != nil {
+					g.Log().Warningf(ctx, "本地历史小时汇总失败: %v", err)
+				} else {
+					lastRollup = time.Now()
+				}
+			}
+			if time.Since(lastPurge) >= 24*time.Hour {
+				if err := purgeHistorian(ctx, retainDays, rollupRetainDays); err != nil {
+					g.Log().Warningf(ctx, "清理本地历史失败: %v", err)
+				} else {
+					lastPurge = time.Now()
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sampleHistorian 读取一次所有工位号的 svr_DATA_*，需要记录的写入 his_sample
+func sampleHistorian(ctx context.Context, positions []HistorianPosition, last map[string]historianLast) error {
+	if err := checkDB(); err != nil {
+		return err
+	}
+	nums := make([]string, len(positions))
+	for i, p := range positions {
+		nums[i] = p.PositionId
+	}
+	dataCache, err := PreloadDataByNums(ctx, nums)
+	if err != nil {
+		g.Log().Warningf(ctx, "本地历史采样读取 svr_DATA 出错: %v", err)
+	}
+
+	onChange := g.Cfg().MustGet(ctx, "historian.onChange", true).Bool()
+	deadband := g.Cfg().MustGet(ctx, "historian.deadband", 0).Float64()
+	maxGap := g.Cfg().MustGet(ctx, "historian.maxGap", "10m").Duration()
+
+	now := time.Now()
+	rows := make([]g.Map, 0)
+	for _, p := range positions {
+		data := dataCache[DataKey(p.PositionId)]
+		if len(data) == 0 {
+			continue
+		}
+		fields := p.Parnos
+		if len(fields) == 0 {
+			fields = make([]string, 0, len(data))
+			for k := range data {
+				fields = append(fields, k)
+			}
+		}
+		for _, parno := range fields {
+			raw, ok := data[parno]
+			if !ok {
+				continue
+			}
+			key := p.PositionId + "\x00" + parno
+			prev, seen := last[key]
+			if onChange && seen && !historianChanged(prev.raw, raw, deadband) && (maxGap <= 0 || now.Sub(prev.at) < maxGap) {
+				continue
+			}
+			row := g.Map{"position_id": p.PositionId, "parno": parno, "ts": now, "value": nil, "text": ""}
+			if v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+				row["value"] = v
+			} else {
+				row["text"] = truncateString(raw, 256)
+			}
+			rows = append(rows, row)
+			last[key] = historianLast{raw: raw, at: now}
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if _, err := db.PgDB.Model(HistorianSampleTable).Ctx(ctx).Data(rows).Insert(); err != nil {
+		// 写入失败时下次全部重写，避免漏掉变化
+		for k := range last {
+			delete(last, k)
+		}
+		return fmt.Errorf("写入本地历史失败: %w", err)
+	}
+	return nil
+}
+
+// historianChanged 值是否变化；两个都是数值时变化量不超过 deadband 算没变
+func historianChanged(prev, cur string, deadband float64) bool {
+	if prev == cur {
+		return false
+	}
+	a, errA := strconv.ParseFloat(strings.TrimSpace(prev), 64)
+	b, errB := strconv.ParseFloat(strings.TrimSpace(cur), 64)
+	if errA == nil && errB == nil {
+		return math.Abs(a-b) > deadband
+	}
+	return true
+}
+
+// rollupHistorian 重新汇总 now 所在小时和前两个小时的数值，已有的汇总覆盖
+func rollupHistorian(ctx context.Context, now time.Time) error {
+	if err := checkDB(); err != nil {
+		return err
+	}
+	from := now.Truncate(time.Hour).Add(-2 * time.Hour)
+	_, err := db.PgDB.Exec(ctx, `INSERT INTO `+HistorianRollupTable+` (position_id, parno, bucket, avg, min, max, last, count)
+		SELECT position_id, parno, date_trunc('hour', ts), AVG(value), MIN(value), MAX(value),
+			(ARRAY_AGG(value ORDER BY ts DESC))[1], COUNT(*)
+		FROM `+HistorianSampleTable+`
+		WHERE ts >= ? AND value IS NOT NULL
+		GROUP BY position_id, parno, date_trunc('hour', ts)
+		ON CONFLICT (position_id, parno, bucket) DO UPDATE SET
+			avg = EXCLUDED.avg, min = EXCLUDED.min, max = EXCLUDED.max, last = EXCLUDED.last, count = EXCLUDED.count`, from)
+	return err
+}
+
+func purgeHistorian(ctx context.Context, retainDays, rollupRetainDays int) error {
+	if err := checkDB(); err != nil {
+		return err
+	}
+	if retainDays > 0 {
+		if _, err := db.PgDB.Exec(ctx, `DELETE FROM `+HistorianSampleTable+` WHERE ts < ?`, time.Now().AddDate(0, 0, -retainDays)); err != nil {
+			return err
+		}
+	}
+	if rollupRetainDays > 0 {
+		if _, err := db.PgDB.Exec(ctx, `DELETE FROM `+HistorianRollupTable+` WHERE bucket < ?`, time.Now().AddDate(0, 0, -rollupRetainDays)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryHistorianRaw 分页查询一个工位号的原始采样，按时间从旧到新。
+// 每条记录为 {position_id, parno, time, value}，value 为数值或文本，和外部 DevHis 的单值记录格式一致。
+func QueryHistorianRaw(ctx context.Context, positionId string, begin, end time.Time, pageIndex, pageSize int) (list []g.Map, total int, err error) {
+	if err := checkDB(); err != nil {
+		return nil, 0, err
+	}
+	if pageIndex <= 0 {
+		pageIndex = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	count, err := db.PgDB.GetValue(ctx, `SELECT COUNT(*) FROM `+HistorianSampleTable+`
+		WHERE position_id = ? AND ts >= ? AND ts <= ?`, positionId, begin, end)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询本地历史失败: %w", err)
+	}
+	res, err := db.PgDB.GetAll(ctx, `SELECT position_id, parno, ts, value, text FROM `+HistorianSampleTable+`
+		WHERE position_id = ? AND ts >= ? AND ts <= ? ORDER BY ts, id LIMIT ? OFFSET ?`,
+		positionId, begin, end, pageSize, (pageIndex-1)*pageSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询本地历史失败: %w", err)
+	}
+	list = make([]g.Map, 0, len(res))
+	for _, row := range res {
+		var value interface{} = row["text"].String()
+		if !row["value"].IsNil() {
+			value = row["value"].Float64()
+		}
+		list = append(list, g.Map{
+			"position_id": row["position_id"].String(),
+			"parno":       row["parno"].String(),
+			"time":        row["ts"].Time().Format("2006-01-02 15:04:05"),
+			"value":       value,
+		})
+	}
+	return list, count.Int(), nil
+}
+
+// HistorianBucket 一个参数在一个时间桶内的汇总
+type HistorianBucket struct {
+	PositionId string
+	Parno      string
+	Bucket     time.Time
+	Avg        float64
+	Min        float64
+	Max        float64
+	Last       float64
+	Count      int
+}
+
+// historianUseRollup 是否从小时汇总表取数：interval 是整小时，并且 begin 早于原始采样的保留期（now 往前 retainDays 天），
+// 此时原始采样已经被清理了一部分；retainDays<=0 表示原始采样不清理，总是用原始采样
+func historianUseRollup(interval time.Duration, begin, now time.Time, retainDays int) bool {
+	return interval > 0 && interval%time.Hour == 0 && retainDays > 0 && begin.Before(now.AddDate(0, 0, -retainDays))
+}
+
+// QueryHistorianBuckets 按 interval 汇总数值采样，按工位号、参数、桶排序。
+// interval 是整小时且开始时间早于原始采样的保留期时用小时汇总表，否则用原始采样。
+// 桶按本地时区对齐，和外部数据的聚合一致。
+func QueryHistorianBuckets(ctx context.Context, positionIds []string, begin, end time.Time, interval time.Duration) ([]HistorianBucket, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	if len(positionIds) == 0 {
+		return nil, nil
+	}
+	_, offset := begin.Zone()
+	seconds := int64(interval / time.Second)
+	// 按本地时区对齐：先加上时区偏移取整，再减回去
+	bucketExpr := func(col string) string {
+		return fmt.Sprintf("to_timestamp(floor((extract(epoch from %s) + %d) / %d) * %d - %d)", col, offset, seconds, seconds, offset)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(positionIds)), ",")
+	args := make([]interface{}, 0, len(positionIds)+2)
+	for _, id := range positionIds {
+		args = append(args, id)
+	}
+	args = append(args, begin, end)
+
+	retainDays := g.Cfg().MustGet(ctx, "historian.retainDays", 30).Int()
+	var sql string
+	if historianUseRollup(interval, begin, time.Now(), retainDays) {
+		b := bucketExpr("bucket")
+		sql = `SELECT position_id, parno, ` + b + ` AS b, SUM(avg * count) / SUM(count) AS avg, MIN(min) AS min, MAX(max) AS max,
+			(ARRAY_AGG(last ORDER BY bucket DESC))[1] AS last, SUM(count) AS count
+			FROM ` + HistorianRollupTable + ` WHERE position_id IN (` + placeholders + `) AND bucket >= ? AND bucket <= ?
+			GROUP BY position_id, parno, b ORDER BY position_id, parno, b`
+	} else {
+		b := bucketExpr("ts")
+		sql = `SELECT position_id, parno, ` + b + ` AS b, AVG(value) AS avg, MIN(value) AS min, MAX(value) AS max,
+			(ARRAY_AGG(value ORDER BY ts DESC))[1] AS last, COUNT(*) AS count
+			FROM ` + HistorianSampleTable + ` WHERE position_id IN (` + placeholders + `) AND ts >= ? AND ts <= ? AND value IS NOT NULL
+			GROUP BY position_id, parno, b ORDER BY position_id, parno, b`
+	}
+	res, err := db.PgDB.GetAll(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("汇总本地历史失败: %w", err)
+	}
+	buckets := make([]HistorianBucket, 0, len(res))
+	for _, row := range res {
+		buckets = append(buckets, HistorianBucket{
+			PositionId: row["position_id"].String(),
+			Parno:      row["parno"].String(),
+			Bucket:     row["b"].Time(),
+			Avg:        row["avg"].Float64(),
+			Min:        row["min"].Float64(),
+			Max:        row["max"].Float64(),
+			Last:       row["last"].Float64(),
+			Count:      row["count"].Int(),
+		})
+	}
+	return buckets, nil
+}
@@ -0,0 +1,57 @@
+package logic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistorianChanged(t *testing.T) {
+	cases := []struct {
+		prev, cur string
+		deadband  float64
+		want      bool
+	}{
+		{"10", "10", 0, false},
+		{"10", "10.0", 0, false},
+		{"10", "10.4", 0.5, false},
+		{"10", "10.5", 0.5, false},
+		{"10", "10.6", 0.5, true},
+		{"10", "9", 0.5, true},
+		{" 10 ", "10", 0, false},
+		{"on", "off", 0, true},
+		{"on", "ON", 0, true},
+		{"", "1", 0, true},
+		{"1", "", 0, true},
+	}
+	for _, c := range cases {
+		if got := historianChanged(c.prev, c.cur, c.deadband); got != c.want {
+			t.Errorf("historianChanged(%q, %q, %v) = %v, want %v", c.prev, c.cur, c.deadband, got, c.want)
+		}
+	}
+}
+
+func TestHistorianUseRollup(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	cutoff := now.AddDate(0, 0, -30)
+	cases := []struct {
+		name       string
+		interval   time.Duration
+		begin      time.Time
+		retainDays int
+		want       bool
+	}{
+		{"整小时且早于保留期", time.Hour, cutoff.Add(-time.Second), 30, true},
+		{"多个小时", 6 * time.Hour, cutoff.AddDate(0, 0, -10), 30, true},
+		{"正好在保留期边界", time.Hour, cutoff, 30, false},
+		{"在保留期内", time.Hour, cutoff.Add(time.Second), 30, false},
+		{"不是整小时", 90 * time.Minute, cutoff.Add(-time.Hour), 30, false},
+		{"小于一小时", 5 * time.Minute, cutoff.Add(-time.Hour), 30, false},
+		{"原始采样不清理", time.Hour, cutoff.Add(-time.Hour), 0, false},
+		{"没有间隔", 0, cutoff.Add(-time.Hour), 30, false},
+	}
+	for _, c := range cases {
+		if got := historianUseRollup(c.interval, c.begin, now, c.retainDays); got != c.want {
+			t.Errorf("%s: historianUseRollup = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// 数据库迁移。
+// 本服务使用的表结构放在 manifest/sql 下，文件名为 “编号_说明.sql”（如 0001_overview_snapshot.sql），按编号顺序执行，
+// 每个文件在一个事务中执行，执行过的编号记在 schema_migrations 表中，不会重复执行。
+// 服务启动时不建表也不改表：部署或升级后先执行 `gf_api migrate`，也可以用 psql 按编号顺序执行这些文件（文件都可以重复执行）。
+// 目录由 database.migrations 配置，默认 manifest/sql。
+
+// SchemaMigrationsTable 已执行的迁移
+const SchemaMigrationsTable = "schema_migrations"
+
+// DefaultMigrationsDir 迁移文件的默认目录
+const DefaultMigrationsDir = "manifest/sql"
+
+// Migration 一个迁移文件
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"` // 文件名
+	SQL     string `json:"-"`
+}
+
+// MigrationsDir 迁移文件目录
+func MigrationsDir(ctx context.Context) string {
+	return g.Cfg().MustGet(ctx, "database.migrations", DefaultMigrationsDir).String()
+}
+
+// LoadMigrations 读取目录下的迁移文件，按编号排序；文件名不符合格式或编号重复时返回错误
+func LoadMigrations(dir string) ([]Migration, error) {
+	if !gfile.IsDir(dir) {
+		return nil, fmt.Errorf("迁移目录 %s 不存在", dir)
+	}
+	files, err := gfile.ScanDirFile(dir, "*.sql", false)
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移目录 %s 失败: %w", dir, err)
+	}
+	migrations := make([]Migration, 0, len(files))
+	seen := make(map[int]string)
+	for _, file := range files {
+		name := filepath.Base(file)
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("迁移文件 %s 的文件名应为 编号_说明.sql", name)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("迁移文件 %s 和 %s 的编号重复", other, name)
+		}
+		seen[version] = name
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: gfile.GetContents(file)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensureMigrationsTable 创建 schema_migrations 表，只在 gf_api migrate 中调用
+func ensureMigrationsTable(ctx context.Context) error {
+	if _, err := db.PgDB.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+SchemaMigrationsTable+` (
+		version    INT          PRIMARY KEY,
+		name       VARCHAR(256) NOT NULL,
+		applied_at TIMESTAMPTZ  NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("创建 %s 表失败: %w", SchemaMigrationsTable, err)
+	}
+	return nil
+}
+
+// appliedMigrations 已执行的编号。只读：schema_migrations 表不存在时表示一个迁移都没执行过
+func appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	exists, err := db.PgDB.GetValue(ctx, `SELECT to_regclass(?) IS NOT NULL`, SchemaMigrationsTable)
+	if err != nil {
+		return nil, fmt.Errorf("检查 %s 表失败: %w", SchemaMigrationsTable, err)
+	}
+	if !exists.Bool() {
+		return map[int]bool{}, nil
+	}
+	res, err := db.PgDB.GetAll(ctx, `SELECT version FROM `+SchemaMigrationsTable)
+	if err != nil {
+		return nil, fmt.Errorf("查询 %s 失败: %w", SchemaMigrationsTable, err)
+	}
+	applied := make(map[int]bool, len(res))
+	for _, row := range res {
+		applied[row["version"].Int()] = true
+	}
+	return applied, nil
+}
+
+// PendingMigrations 还没有执行的迁移，只读取数据库，不建表
+func PendingMigrations(ctx context.Context, dir string) ([]Migration, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate 按编号顺序执行没有执行过的迁移，返回本次执行的迁移；某个文件失败时停在该文件，之前的已经提交
+func Migrate(ctx context.Context, dir string) ([]Migration, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	pending, err := PendingMigrations(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	done := make([]Migration, 0, len(pending))
+	for _, m := range pending {
+		err := db.PgDB.Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+			if _, err := tx.Exec(m.SQL); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO `+SchemaMigrationsTable+` (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("执行迁移 %s 失败: %w", m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// WarnPendingMigrations 启动时检查迁移，有没执行的迁移时打警告日志，不阻止启动
+func WarnPendingMigrations(ctx context.Context) {
+	pending, err := PendingMigrations(ctx, MigrationsDir(ctx))
+	if err != nil {
+		g.Log().Warningf(ctx, "检查数据库迁移失败: %v", err)
+		return
+	}
+	if len(pending) > 0 {
+		names := make([]string, 0, len(pending))
+		for _, m := range pending {
+			names = append(names, m.Name)
+		}
+		g.Log().Warningf(ctx, "有 %d 个数据库迁移没有执行（%s），请先执行 gf_api migrate", len(pending), strings.Join(names, ", "))
+	}
+}
+
+// checkDB 使用数据库之前检查连接是否已初始化；表结构由迁移创建，见 Migrate
+func checkDB() error {
+	if db.PgDB == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	return nil
+}
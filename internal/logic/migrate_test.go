@@ -0,0 +1,73 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	write := func(dir, name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	write(dir, "0010_b.sql", "SELECT 10;")
+	write(dir, "0002_a.sql", "SELECT 2;")
+	write(dir, "README.md", "不是迁移文件")
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 2 || migrations[1].Version != 10 ||
+		migrations[0].Name != "0002_a.sql" || migrations[1].SQL != "SELECT 10;" {
+		t.Errorf("migrations = %+v", migrations)
+	}
+
+	for name, files := range map[string][]string{
+		"编号重复": {"0001_a.sql", "1_b.sql"},
+		"没有编号": {"init.sql"},
+		"编号为0": {"0000_init.sql"},
+	} {
+		dir := t.TempDir()
+		for _, f := range files {
+			write(dir, f, "SELECT 1;")
+		}
+		if _, err := LoadMigrations(dir); err == nil {
+			t.Errorf("%s时应返回错误", name)
+		}
+	}
+	if _, err := LoadMigrations(filepath.Join(dir, "missing")); err == nil {
+		t.Error("目录不存在时应返回错误")
+	}
+}
+
+// 仓库中的迁移文件：编号连续，建表、建索引和加列都可以重复执行，
+// 不使用 ? （pgsql 驱动会把它当成占位符）
+func TestRepositoryMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(filepath.Join("..", "..", DefaultMigrationsDir))
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("没有迁移文件")
+	}
+	create := regexp.MustCompile(`(?i)\b(CREATE\s+(TABLE|INDEX|UNIQUE\s+INDEX)|ADD\s+COLUMN)\s+`)
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("%s 的编号应为 %d", m.Name, i+1)
+		}
+		if strings.Contains(m.SQL, "?") {
+			t.Errorf("%s 中不能有 ?", m.Name)
+		}
+		for _, loc := range create.FindAllStringIndex(m.SQL, -1) {
+			if rest := strings.ToUpper(m.SQL[loc[1]:]); !strings.HasPrefix(rest, "IF NOT EXISTS") {
+				t.Errorf("%s 中的 %q 应带 IF NOT EXISTS", m.Name, strings.TrimSpace(m.SQL[loc[0]:loc[1]]))
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 台站模型在 redis 中的 hash key
+const (
+	DynamicModelKey    = "svr_dynamic_model"
+	StaticModelKey     = "svr_static_model"
+	SetItemModelKey    = "svr_setitem_model"
+	OperationsModelKey = "svr_operations_model"
+)
+
+// ModelCache 动态、静态、设置项和操作模型的内存缓存。
+// 一旦发布就只读，刷新时整体替换成新的实例，所以多个请求可以放心共享同一份。
+type ModelCache struct {
+	Dynamic map[string]map[string]map[string]interface{}
+	Static  map[string]map[string]interface{}
+	SetItem map[string]map[string]map[string]interface{}
+	// Operations 操作模型：operate_model_id → 操作 → 操作定义，控制命令下发前按它校验
+	Operations map[string]map[string]map[string]interface{}
+
+	// Resolver 动态属性和设置项属性的取值规则，加载时按 overview.resolve 配置生成，为 nil 时使用默认规则
+	Resolver *AttributeResolver
+
+	Version     int64     // 代数，每次内容变化并替换后加1
+	Fingerprint uint64    // 各模型 hash 原始内容的指纹，内容不变就不替换
+	LoadedAt    time.Time // 本次内容的加载时间
+}
+
+var (
+	currentModelCache atomic.Pointer[ModelCache]
+	modelCacheLoadMu  sync.Mutex // 保证同一时刻只有一个加载过程
+	modelCacheStarted atomic.Bool
+)
+
+// GetModelCache 取当前的模型缓存。
+// 正常情况下启动时已经加载好；如果还没有（比如刷新任务没启动），就同步加载一次。
+func GetModelCache(ctx context.Context) (*ModelCache, error) {
+	if cache := currentModelCache.Load(); cache != nil {
+		return cache, nil
+	}
+	return RefreshModelCache(ctx)
+}
+
+// RefreshModelCache 立即从 redis 重新加载模型，内容有变化时原子替换并把版本号加1。
+// 返回替换后（或未变化时原有）的缓存。
+func RefreshModelCache(ctx context.Context) (*ModelCache, error) {
+	modelCacheLoadMu.Lock()
+	defer modelCacheLoadMu.Unlock()
+
+	old := currentModelCache.Load()
+	cache, err := LoadModelCache(ctx)
+	if err != nil {
+		if old != nil {
+			// 刷新失败时继续使用旧缓存，不影响接口
+			return old, err
+		}
+		return nil, err
+	}
+
+	if old != nil && old.Fingerprint == cache.Fingerprint {
+		return old, nil
+	}
+	if old != nil {
+		cache.Version = old.Version + 1
+	} else {
+		cache.Version = 1
+	}
+	currentModelCache.Store(cache)
+	return cache, nil
+}
+
+// LoadModelCache 加载redis模型缓存,以便减少访问redis的次数。
+// 这里只负责读取和解析，不会替换全局缓存，请求里应使用 GetModelCache。
+func LoadModelCache(ctx context.Context) (*ModelCache, error) {
+	cache := &ModelCache{
+		Dynamic:    make(map[string]map[string]map[string]interface{}),
+		Static:     make(map[string]map[string]interface{}),
+		SetItem:    make(map[string]map[string]map[string]interface{}),
+		Operations: make(map[string]map[string]map[string]interface{}),
+		LoadedAt:   time.Now(),
+	}
+
+	// 所有模型 hash 放到一个 pipeline 里，一次往返
+	pipe := db.Redis.Pipeline()
+	dynCmd := pipe.HGetAll(ctx, DynamicModelKey)
+	sticCmd := pipe.HGetAll(ctx, StaticModelKey)
+	setCmd := pipe.HGetAll(ctx, SetItemModelKey)
+	opCmd := pipe.HGetAll(ctx, OperationsModelKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("读取模型 hash 失败: %w", err)
+	}
+
+	h := fnv.New64a()
+
+	// 取值规则也计入指纹，配置修改后下次刷新就会换成新缓存
+	rules := LoadResolveRules(ctx)
+	cache.Resolver = NewAttributeResolver(rules)
+	rulesJson, _ := json.Marshal(rules)
+	_, _ = h.Write(rulesJson)
+
+	// 动态模型的结果集
+	all := dynCmd.Val()
+	hashModelFields(h, DynamicModelKey, all)
+	for id, jsonStr := range all {
+		var obj map[string]map[string]interface{}
+		if err := json.Unmarshal([]byte(jsonStr), &obj); err == nil {
+			cache.Dynamic[id] = obj
+		}
+	}
+
+	// 静态模型的结果集
+	all = sticCmd.Val()
+	hashModelFields(h, StaticModelKey, all)
+	for id, jsonStr := range all {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(jsonStr), &obj); err == nil {
+			cache.Static[id] = obj
+		}
+	}
+
+	// 设置模型的结果集
+	all = setCmd.Val()
+	hashModelFields(h, SetItemModelKey, all)
+	for id, jsonStr := range all {
+		var obj map[string]map[string]interface{}
+		if err := json.Unmarshal([]byte(jsonStr), &obj); err == nil {
+			cache.SetItem[id] = obj
+		}
+	}
+
+	// 操作模型的结果集
+	all = opCmd.Val()
+	hashModelFields(h, OperationsModelKey, all)
+	for id, jsonStr := range all {
+		var obj map[string]map[string]interface{}
+		if err := json.Unmarshal([]byte(jsonStr), &obj); err == nil {
+			cache.Operations[id] = obj
+		}
+	}
+
+	cache.Fingerprint = h.Sum64()
+	return cache, nil
+}
+
+// hashModelFields 按字段名排序后写入指纹，保证同样的内容得到同样的指纹
+func hashModelFields(h interface{ Write([]byte) (int, error) }, key string, all map[string]string) {
+	fields := make([]string, 0, len(all))
+	for k := range all {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	h.Write([]byte(key))
+	for _, k := range fields {
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(all[k]))
+	}
+}
+
+// StartModelCacheRefresher 启动时加载模型缓存，并在后台保持刷新：
+//  1. 定时刷新，间隔由 overview.modelCache.refreshInterval 配置，默认5分钟；
+//  2. 订阅各模型 hash 的 keyspace 通知，有变化时尽快刷新。
+//     需要 redis 打开 notify-keyspace-events（至少包含 K、h、g），没打开时只靠定时刷新。
+//
+// 只会启动一次，重复调用直接返回。
+func StartModelCacheRefresher(ctx context.Context) {
+	if !modelCacheStarted.CompareAndSwap(false, true) {
+		return
+	}
+
+	if _, err := RefreshModelCache(ctx); err != nil {
+		g.Log().Warningf(ctx, "首次加载模型缓存失败，后台会继续重试: %v", err)
+	}
+
+	interval := g.Cfg().MustGet(ctx, "overview.modelCache.refreshInterval", "5m").Duration()
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	// 连续通知合并成一次刷新，避免发布模型时逐个 HSET 引起反复加载
+	debounce := g.Cfg().MustGet(ctx, "overview.modelCache.debounce", "1s").Duration()
+
+	trigger := make(chan struct{}, 1)
+	go watchModelKeyspace(ctx, trigger)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-trigger:
+				if debounce > 0 {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(debounce):
+					}
+				}
+				// 等待期间又来的通知一并处理
+				select {
+				case <-trigger:
+				default:
+				}
+			}
+			before := currentModelCache.Load()
+			cache, err := RefreshModelCache(ctx)
+			if err != nil {
+				g.Log().Warningf(ctx, "刷新模型缓存失败，继续使用旧版本: %v", err)
+				continue
+			}
+			if before == nil || cache.Version != before.Version {
+				g.Log().Infof(ctx, "模型缓存已更新，版本: %d", cache.Version)
+			}
+		}
+	}()
+}
+
+// watchModelKeyspace 订阅模型 hash 的 keyspace 通知，收到后往 trigger 里投递一次刷新信号
+func watchModelKeyspace(ctx context.Context, trigger chan<- struct{}) {
+	dbIndex := g.Cfg().MustGet(ctx, "redis.default.db").Int()
+	channels := []string{
+		fmt.Sprintf("__keyspace@%d__:%s", dbIndex, DynamicModelKey),
+		fmt.Sprintf("__keyspace@%d__:%s", dbIndex, StaticModelKey),
+		fmt.Sprintf("__keyspace@%d__:%s", dbIndex, SetItemModelKey),
+		fmt.Sprintf("__keyspace@%d__:%s", dbIndex, OperationsModelKey),
+	}
+
+	for {
+		pubsub := db.Redis.Subscribe(ctx, channels...)
+		ch := pubsub.Channel()
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				pubsub.Close()
+				return
+			case _, ok := <-ch:
+				if !ok {
+					break loop
+				}
+				select {
+				case trigger <- struct{}{}:
+				default:
+				}
+			}
+		}
+		pubsub.Close()
+
+		// 连接断开后稍等再重新订阅
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 告警和控制失败的通知。
+// 新产生或升级的告警、下发失败的控制命令按 notify.routes 中的路由规则（台站、级别、类型）匹配通道，
+// 每个通道写一条 notify_outbox 记录，由发送协程每 notify.interval 取出待发送的记录发送，失败时按退避时间重试。
+// 同一通道同一去重键在 notify.dedupWindow 内只发一次；路由配置了静默时段时，低于 quietSeverity 的通知推迟到静默结束后发送。
+// 搁置中的告警和被根因告警抑制的告警不发通知。
+
+// NotifyOutboxTable 通知发件箱表名
+const NotifyOutboxTable = "notify_outbox"
+
+// 通知类型
+const (
+	NotifyKindAlarm   = "alarm"
+	NotifyKindCommand = "command"
+)
+
+// 发件箱记录状态
+const (
+	NotifyPending = "pending"
+	NotifySent    = "sent"
+	NotifyFailed  = "failed" // 超过最大重试次数，不再发送
+)
+
+// Notification 一条通知的内容，序列化后存在发件箱的 payload 中
+type Notification struct {
+	Kind       string    `json:"kind"`  // alarm / command
+	Event      string    `json:"event"` // raised / escalated / ungrouped / failed / test
+	StationId  string    `json:"stationId"`
+	PositionId string    `json:"positionId"`
+	Severity   string    `json:"severity"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	DedupKey   string    `json:"dedupKey"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// NotifyRoute 路由规则，列表为空表示不限
+type NotifyRoute struct {
+	Name       string   `json:"name"`
+	Stations   []string `json:"stations"`
+	Severities []string `json:"severities"`
+	Kinds      []string `json:"kinds"`
+	Channels   []string `json:"channels"`
+	// QuietHours 静默时段，如 "22:00-07:00"，可以跨零点
+	QuietHours string `json:"quietHours"`
+	// QuietSeverity 静默时段内仍立即发送的最低级别，默认 critical
+	QuietSeverity string `json:"quietSeverity"`
+}
+
+// NotifyConfig notify 配置
+type NotifyConfig struct {
+	Channels    map[string]NotifyChannelConfig
+	Routes      []NotifyRoute
+	DedupWindow time.Duration
+	MaxAttempts int
+	Backoff     time.Duration // 第一次重试的等待时间，之后每次翻倍
+	MaxBackoff  time.Duration
+}
+
+// LoadNotifyConfig 读取 notify 配置
+func LoadNotifyConfig(ctx context.Context) (*NotifyConfig, error) {
+	cfg := &NotifyConfig{
+		Channels:    make(map[string]NotifyChannelConfig),
+		DedupWindow: g.Cfg().MustGet(ctx, "notify.dedupWindow", "10m").Duration(),
+		MaxAttempts: g.Cfg().MustGet(ctx, "notify.retry.maxAttempts", 8).Int(),
+		Backoff:     g.Cfg().MustGet(ctx, "notify.retry.backoff", "30s").Duration(),
+		MaxBackoff:  g.Cfg().MustGet(ctx, "notify.retry.maxBackoff", "30m").Duration(),
+	}
+	var channels []NotifyChannelConfig
+	if v, err := g.Cfg().Get(ctx, "notify.channels"); err == nil && !v.IsNil() {
+		if err := v.Scan(&channels); err != nil {
+			return nil, fmt.Errorf("解析 notify.channels 失败: %w", err)
+		}
+	}
+	for _, c := range channels {
+		if c.Name == "" {
+			return nil, fmt.Errorf("notify.channels 中有通道没有配置 name")
+		}
+		cfg.Channels[c.Name] = c
+	}
+	if v, err := g.Cfg().Get(ctx, "notify.routes"); err == nil && !v.IsNil() {
+		if err := v.Scan(&cfg.Routes); err != nil {
+			return nil, fmt.Errorf("解析 notify.routes 失败: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// Match 通知是否匹配路由
+func (r *NotifyRoute) Match(n *Notification) bool {
+	return matchAny(r.Stations, n.StationId) && matchAny(r.Severities, n.Severity) && matchAny(r.Kinds, n.Kind)
+}
+
+func matchAny(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == "*" || strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// QuietUntil now 处于静默时段时返回静默结束的时间
+func (r *NotifyRoute) QuietUntil(now time.Time) (time.Time, bool) {
+	if r.QuietHours == "" {
+		return time.Time{}, false
+	}
+	begin, end, ok := parseQuietHours(r.QuietHours)
+	if !ok {
+		return time.Time{}, false
+	}
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	minute := now.Hour()*60 + now.Minute()
+	switch {
+	case begin < end && minute >= begin && minute < end:
+		return day.Add(time.Duration(end) * time.Minute), true
+	case begin > end && minute >= begin:
+		return day.AddDate(0, 0, 1).Add(time.Duration(end) * time.Minute), true
+	case begin > end && minute < end:
+		return day.Add(time.Duration(end) * time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// parseQuietHours 解析 "HH:MM-HH:MM"，返回从零点开始的分钟数
+func parseQuietHours(s string) (begin, end int, ok bool) {
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		return 0, 0, false
+	}
+	parse := func(v string) (int, bool) {
+		t, err := time.Parse("15:04", strings.TrimSpace(v))
+		if err != nil {
+			return 0, false
+		}
+		return t.Hour()*60 + t.Minute(), true
+	}
+	if begin, ok = parse(from); !ok {
+		return 0, 0, false
+	}
+	if end, ok = parse(to); !ok {
+		return 0, 0, false
+	}
+	return begin, end, begin != end
+}
+
+var notifyStarted atomic.Bool
+
+// EnqueueNotification 按路由规则把通知写入发件箱，返回写入的条数。
+// 多条路由指向同一通道时只写一次；去重窗口内已经写过的不再写。
+func EnqueueNotification(ctx context.Context, n *Notification) (int, error) {
+	if err := checkDB(); err != nil {
+		return 0, err
+	}
+	cfg, err := LoadNotifyConfig(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return enqueueNotification(ctx, cfg, n)
+}
+
+// enqueueNotification 按已加载的配置写入发件箱，一批通知共用一份配置
+func enqueueNotification(ctx context.Context, cfg *NotifyConfig, n *Notification) (int, error) {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return 0, fmt.Errorf("序列化通知失败: %w", err)
+	}
+
+	now := time.Now()
+	// 通道 → 最早可以发送的时间；任一路由允许立即发送就立即发送
+	targets := make(map[string]time.Time)
+	order := make([]string, 0)
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		if !route.Match(n) {
+			continue
+		}
+		at := now
+		quietSeverity := route.QuietSeverity
+		if quietSeverity == "" {
+			quietSeverity = SeverityCritical
+		}
+		if until, quiet := route.QuietUntil(now); quiet && SeverityRank(n.Severity) < SeverityRank(quietSeverity) {
+			at = until
+		}
+		for _, name := range route.Channels {
+			if _, ok := cfg.Channels[name]; !ok {
+				g.Log().Warningf(ctx, "通知路由 %s 引用了不存在的通道 %s", route.Name, name)
+				continue
+			}
+			prev, seen := targets[name]
+			if !seen {
+				order = append(order, name)
+			}
+			if !seen || at.Before(prev) {
+				targets[name] = at
+			}
+		}
+	}
+
+	count := 0
+	for _, name := range order {
+		if n.DedupKey != "" && cfg.DedupWindow > 0 {
+			dup, err := db.PgDB.GetValue(ctx, `SELECT COUNT(*) FROM `+NotifyOutboxTable+`
+				WHERE channel = ? AND dedup_key = ? AND created_at > ?`, name, n.DedupKey, now.Add(-cfg.DedupWindow))
+			if err != nil {
+				return count, fmt.Errorf("查询通知去重失败: %w", err)
+			}
+			if dup.Int() > 0 {
+				continue
+			}
+		}
+		if _, err := db.PgDB.Model(NotifyOutboxTable).Ctx(ctx).Data(g.Map{
+			"channel":         name,
+			"kind":            n.Kind,
+			"dedup_key":       n.DedupKey,
+			"station_id":      n.StationId,
+			"severity":        n.Severity,
+			"payload":         string(payload),
+			"status":          NotifyPending,
+			"attempts":        0,
+			"next_attempt_at": targets[name],
+			"created_at":      now,
+		}).Insert(); err != nil {
+			return count, fmt.Errorf("写入通知发件箱失败: %w", err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// StartNotifier 启动通知发送，每 notify.interval（默认5s）发送一次到期的通知；notify.enabled=false 时不启动
+func StartNotifier(ctx context.Context) {
+	if !g.Cfg().MustGet(ctx, "notify.enabled", true).Bool() {
+		return
+	}
+	if !notifyStarted.CompareAndSwap(false, true) {
+		return
+	}
+	interval := g.Cfg().MustGet(ctx, "notify.interval", "5s").Duration()
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	OnAlarmChange(notifyAlarmChanges)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := DispatchNotifications(ctx); err != nil {
+				g.Log().Warningf(ctx, "发送通知失败: %v", err)
+			}
+		}
+	}()
+}
+
+// notifyAlarmChanges 新产生和升级的告警发通知，降级、消除、搁置中和被根因告警抑制的告警不发
+func notifyAlarmChanges(ctx context.Context, changes []AlarmChange) {
+	if err := checkDB(); err != nil {
+		g.Log().Warningf(ctx, "告警写入通知失败: %v", err)
+		return
+	}
+	cfg, err := LoadNotifyConfig(ctx)
+	if err != nil {
+		g.Log().Warningf(ctx, "告警写入通知失败: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, ch := range changes {
+		ev := ch.Event
+		if ev.Shelved(now) || ev.Suppressed {
+			continue
+		}
+		event := ""
+		switch {
+		case ch.Type == AlarmRaised:
+			event = "raised"
+		case ch.Type == AlarmUpdated && SeverityRank(ev.Severity) > SeverityRank(ch.PrevSeverity):
+			event = "escalated"
+		case ch.Type == AlarmUpdated && ch.PrevRootKey != "" && ev.RootKey == "":
+			// 根因告警已经消除，原来被抑制的告警成为独立的告警
+			event = "ungrouped"
+		default:
+			continue
+		}
+		n := &Notification{
+			Kind:       NotifyKindAlarm,
+			Event:      event,
+			StationId:  ev.StationId,
+			PositionId: ev.PositionId,
+			Severity:   ev.Severity,
+			Title:      fmt.Sprintf("[%s] 台站 %s %s %s", ev.Severity, ev.StationId, ev.Path, ev.Attribute),
+			Content:    ev.Message,
+			DedupKey:   "alarm:" + ev.AlarmKey + ":" + ev.Severity,
+			OccurredAt: ev.UpdatedAt,
+		}
+		switch event {
+		case "escalated":
+			n.Title += "（由 " + ch.PrevSeverity + " 升级）"
+		case "ungrouped":
+			n.Title += "（根因告警已消除）"
+			n.DedupKey += ":ungrouped"
+		}
+		if _, err := enqueueNotification(ctx, cfg, n); err != nil {
+			g.Log().Warningf(ctx, "告警 %s 写入通知失败: %v", ev.AlarmKey, err)
+		}
+	}
+}
+
+// NotifyCommandFailure 控制命令下发失败时发通知，级别为 notify.commandSeverity（默认 major）
+func NotifyCommandFailure(ctx context.Context, positionId, command, reason string) {
+	n := &Notification{
+		Kind:       NotifyKindCommand,
+		Event:      "failed",
+		StationId:  stationOfPosition(positionId),
+		PositionId: positionId,
+		Severity:   g.Cfg().MustGet(ctx, "notify.commandSeverity", SeverityMajor).String(),
+		Title:      fmt.Sprintf("控制命令下发失败：%s %s", positionId, command),
+		Content:    reason,
+		DedupKey:   "command:" + positionId + ":" + command,
+		OccurredAt: time.Now(),
+	}
+	if _, err := EnqueueNotification(ctx, n); err != nil {
+		g.Log().Warningf(ctx, "控制命令失败写入通知失败: %v", err)
+	}
+}
+
+// stationOfPosition 工位号的台站部分，如 0101_0x0702_2 → 0101
+func stationOfPosition(positionId string) string {
+	station, _, _ := strings.Cut(positionId, "_")
+	return station
+}
+
+// DispatchNotifications 发送到期的通知，返回发送成功的条数
+func DispatchNotifications(ctx context.Context) (int, error) {
+	if err := checkDB(); err != nil {
+		return 0, err
+	}
+	cfg, err := LoadNotifyConfig(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	res, err := db.PgDB.GetAll(ctx, `SELECT id, channel, payload, attempts FROM `+NotifyOutboxTable+`
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		NotifyPending, now, g.Cfg().MustGet(ctx, "notify.batchSize", 50).Int())
+	if err != nil {
+		return 0, fmt.Errorf("查询待发送通知失败: %w", err)
+	}
+
+	sent := 0
+	for _, row := range res {
+		id, name, attempts := row["id"].Int64(), row["channel"].String(), row["attempts"].Int()+1
+		var n Notification
+		err := json.Unmarshal([]byte(row["payload"].String()), &n)
+		if err == nil {
+			c, ok := cfg.Channels[name]
+			if !ok {
+				err = fmt.Errorf("通道 %s 不存在", name)
+				attempts = cfg.MaxAttempts // 通道已经删掉了，不再重试
+			} else {
+				err = SendNotification(ctx, c, &n)
+			}
+		}
+		if err == nil {
+			sent++
+			_, err = db.PgDB.Exec(ctx, `UPDATE `+NotifyOutboxTable+` SET status = ?, attempts = ?, sent_at = ?, last_error = '' WHERE id = ?`,
+				NotifySent, attempts, time.Now(), id)
+		} else {
+			status, next := cfg.failedState(attempts, time.Now())
+			g.Log().Warningf(ctx, "通知 %d 通过 %s 发送失败（第%d次）: %v", id, name, attempts, err)
+			_, err = db.PgDB.Exec(ctx, `UPDATE `+NotifyOutboxTable+` SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?`,
+				status, attempts, next, truncateString(err.Error(), 512), id)
+		}
+		if err != nil {
+			return sent, fmt.Errorf("更新通知 %d 状态失败: %w", id, err)
+		}
+	}
+	return sent, nil
+}
+
+// failedState 第 attempts 次发送失败后的状态和下次发送时间，达到 MaxAttempts 后为 failed
+func (c *NotifyConfig) failedState(attempts int, now time.Time) (string, time.Time) {
+	next := now.Add(c.retryDelay(attempts))
+	if attempts >= c.MaxAttempts {
+		return NotifyFailed, next
+	}
+	return NotifyPending, next
+}
+
+// retryDelay 第 attempts 次失败后的等待时间
+func (c *NotifyConfig) retryDelay(attempts int) time.Duration {
+	delay := c.Backoff
+	if delay <= 0 {
+		delay = 30 * time.Second
+	}
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if c.MaxBackoff > 0 && delay >= c.MaxBackoff {
+			return c.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// NotifyOutboxItem 发件箱中的一条记录
+type NotifyOutboxItem struct {
+	Id            int64         `json:"id"`
+	Channel       string        `json:"channel"`
+	Status        string        `json:"status"`
+	Attempts      int           `json:"attempts"`
+	NextAttemptAt time.Time     `json:"nextAttemptAt"`
+	LastError     string        `json:"lastError"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	SentAt        *time.Time    `json:"sentAt,omitempty"`
+	Notification  *Notification `json:"notification"`
+}
+
+// QueryNotifyOutbox 按创建时间从新到旧分页查询发件箱，status 为空表示不限
+func QueryNotifyOutbox(ctx context.Context, status string, pageIndex, pageSize int) (list []*NotifyOutboxItem, total int, err error) {
+	if err := checkDB(); err != nil {
+		return nil, 0, err
+	}
+	if pageIndex <= 0 {
+		pageIndex = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	where, args := "", []interface{}{}
+	if status != "" {
+		where, args = " WHERE status = ?", append(args, status)
+	}
+	count, err := db.PgDB.GetValue(ctx, `SELECT COUNT(*) FROM `+NotifyOutboxTable+where, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询通知发件箱失败: %w", err)
+	}
+	res, err := db.PgDB.GetAll(ctx, `SELECT id, channel, status, attempts, next_attempt_at, last_error, created_at, sent_at, payload
+		FROM `+NotifyOutboxTable+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, pageSize, (pageIndex-1)*pageSize)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询通知发件箱失败: %w", err)
+	}
+	list = make([]*NotifyOutboxItem, 0, len(res))
+	for _, row := range res {
+		item := &NotifyOutboxItem{
+			Id:            row["id"].Int64(),
+			Channel:       row["channel"].String(),
+			Status:        row["status"].String(),
+			Attempts:      row["attempts"].Int(),
+			NextAttemptAt: row["next_attempt_at"].Time(),
+			LastError:     row["last_error"].String(),
+			CreatedAt:     row["created_at"].Time(),
+			SentAt:        recordTime(row["sent_at"]),
+		}
+		var n Notification
+		if json.Unmarshal([]byte(row["payload"].String()), &n) == nil {
+			item.Notification = &n
+		}
+		list = append(list, item)
+	}
+	return list, count.Int(), nil
+}
+
+// SendTestNotification 直接通过指定通道发一条测试通知（不经过发件箱），用于检查通道配置
+func SendTestNotification(ctx context.Context, channel string) error {
+	cfg, err := LoadNotifyConfig(ctx)
+	if err != nil {
+		return err
+	}
+	c, ok := cfg.Channels[channel]
+	if !ok {
+		return fmt.Errorf("通道 %s 不存在", channel)
+	}
+	return SendNotification(ctx, c, &Notification{
+		Kind:       "test",
+		Event:      "test",
+		Severity:   SeverityWarning,
+		Title:      "通知通道测试",
+		Content:    fmt.Sprintf("这是一条来自 gf_api 的测试通知，通道 %s", channel),
+		OccurredAt: time.Now(),
+	})
+}
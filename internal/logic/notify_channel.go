@@ -0,0 +1,220 @@
+package logic
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 通知通道：
+//   - webhook：POST 通知的 JSON；
+//   - email：通过 SMTP 发纯文本邮件，tls=true 时使用 SMTPS（465），否则服务器支持时使用 STARTTLS；
+//   - robot：钉钉/企业微信群机器人的 text 消息，配置了 secret 时按钉钉的方式加签。
+
+// 通道类型
+const (
+	NotifyChannelWebhook = "webhook"
+	NotifyChannelEmail   = "email"
+	NotifyChannelRobot   = "robot"
+)
+
+// NotifyChannelConfig notify.channels 中的一个通道
+type NotifyChannelConfig struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Timeout string            `json:"timeout"` // 默认 10s
+	URL     string            `json:"url"`     // webhook / robot
+	Headers map[string]string `json:"headers"` // webhook 附加的请求头
+	Secret  string            `json:"secret"`  // robot 加签密钥
+	// email
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	TLS      bool     `json:"tls"`
+	// SkipVerify 不校验 SMTP 服务器证书，只用于测试环境的自签名证书
+	SkipVerify bool `json:"skipVerify"`
+}
+
+func (c NotifyChannelConfig) timeout() time.Duration {
+	if d, err := time.ParseDuration(c.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Second
+}
+
+// SendNotification 通过通道发送一条通知
+func SendNotification(ctx context.Context, c NotifyChannelConfig, n *Notification) error {
+	switch c.Type {
+	case NotifyChannelWebhook:
+		return sendWebhook(ctx, c, n)
+	case NotifyChannelEmail:
+		return sendEmail(c, n)
+	case NotifyChannelRobot:
+		return sendRobot(ctx, c, n)
+	}
+	return fmt.Errorf("不支持的通道类型 %q", c.Type)
+}
+
+// notificationText 通知的纯文本内容，邮件正文和机器人消息使用
+func notificationText(n *Notification) string {
+	var b strings.Builder
+	b.WriteString(n.Title)
+	for _, line := range [][2]string{
+		{"台站", n.StationId},
+		{"工位号", n.PositionId},
+		{"级别", n.Severity},
+		{"内容", n.Content},
+	} {
+		if line[1] != "" {
+			fmt.Fprintf(&b, "\n%s：%s", line[0], line[1])
+		}
+	}
+	fmt.Fprintf(&b, "\n时间：%s", n.OccurredAt.Format("2006-01-02 15:04:05"))
+	return b.String()
+}
+
+func sendWebhook(ctx context.Context, c NotifyChannelConfig, n *Notification) error {
+	if c.URL == "" {
+		return fmt.Errorf("通道 %s 没有配置 url", c.Name)
+	}
+	resp, err := g.Client().Timeout(c.timeout()).Header(c.Headers).ContentJson().Post(ctx, c.URL, n)
+	if err != nil {
+		return fmt.Errorf("请求 webhook 失败: %w", err)
+	}
+	defer resp.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook 返回状态码 %d: %s", resp.StatusCode, truncateString(resp.ReadAllString(), 200))
+	}
+	return nil
+}
+
+func sendRobot(ctx context.Context, c NotifyChannelConfig, n *Notification) error {
+	if c.URL == "" {
+		return fmt.Errorf("通道 %s 没有配置 url", c.Name)
+	}
+	target := c.URL
+	if c.Secret != "" {
+		ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(c.Secret))
+		mac.Write([]byte(ts + "\n" + c.Secret))
+		sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(sign)
+	}
+	resp, err := g.Client().Timeout(c.timeout()).ContentJson().Post(ctx, target, g.Map{
+		"msgtype": "text",
+		"text":    g.Map{"content": notificationText(n)},
+	})
+	if err != nil {
+		return fmt.Errorf("请求机器人 webhook 失败: %w", err)
+	}
+	defer resp.Close()
+	body := resp.ReadAll()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("机器人 webhook 返回状态码 %d: %s", resp.StatusCode, truncateString(string(body), 200))
+	}
+	// 钉钉和企业微信都用 errcode 表示结果，0 为成功
+	if j, err := gjson.DecodeToJson(body); err == nil && j.Contains("errcode") && j.Get("errcode").Int() != 0 {
+		return fmt.Errorf("机器人 webhook 返回错误 %d: %s", j.Get("errcode").Int(), j.Get("errmsg").String())
+	}
+	return nil
+}
+
+func sendEmail(c NotifyChannelConfig, n *Notification) error {
+	if c.Host == "" || c.From == "" || len(c.To) == 0 {
+		return fmt.Errorf("通道 %s 的 host、from、to 不能为空", c.Name)
+	}
+	port := c.Port
+	if port == 0 {
+		port = 25
+		if c.TLS {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(port))
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", n.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	body := base64.StdEncoding.EncodeToString([]byte(notificationText(n)))
+	for len(body) > 76 {
+		msg.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	msg.WriteString(body + "\r\n")
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, c.timeout())
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	if c.TLS {
+		conn = tls.Client(conn, &tls.Config{ServerName: c.Host, InsecureSkipVerify: c.SkipVerify})
+	}
+	_ = conn.SetDeadline(time.Now().Add(c.timeout()))
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	defer client.Close()
+	if !c.TLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: c.Host, InsecureSkipVerify: c.SkipVerify}); err != nil {
+				return fmt.Errorf("SMTP STARTTLS 失败: %w", err)
+			}
+		}
+	}
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+	if err := client.Mail(c.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM 失败: %w", err)
+	}
+	for _, to := range c.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s 失败: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA 失败: %w", err)
+	}
+	if _, err := w.Write([]byte(msg.String())); err != nil {
+		return fmt.Errorf("写入邮件内容失败: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,286 @@
+package logic
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNotification() *Notification {
+	return &Notification{
+		Kind:       "alarm",
+		Event:      "raised",
+		StationId:  "0101",
+		PositionId: "0101_TX1",
+		Severity:   "critical",
+		Title:      "发射机告警：功率过低",
+		Content:    "正向功率 0.5kW 低于下限 2kW",
+		DedupKey:   "0101_TX1/FwdPower",
+		OccurredAt: time.Date(2026, 10, 18, 10, 30, 0, 0, time.Local),
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	var (
+		got    Notification
+		header string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Token")
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			t.Errorf("请求应为 JSON POST，得到 %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("解析 payload 失败: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	n := testNotification()
+	c := NotifyChannelConfig{Name: "hook", Type: NotifyChannelWebhook, URL: srv.URL, Headers: map[string]string{"X-Token": "abc"}}
+	if err := SendNotification(context.Background(), c, n); err != nil {
+		t.Fatalf("SendNotification: %v", err)
+	}
+	if header != "abc" {
+		t.Errorf("附加请求头 X-Token = %q, want abc", header)
+	}
+	if !got.OccurredAt.Equal(n.OccurredAt) {
+		t.Errorf("occurredAt = %s, want %s", got.OccurredAt, n.OccurredAt)
+	}
+	got.OccurredAt = n.OccurredAt
+	if got != *n {
+		t.Errorf("payload = %+v, want %+v", got, *n)
+	}
+}
+
+func TestSendWebhookStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("upstream down"))
+	}))
+	defer srv.Close()
+
+	err := SendNotification(context.Background(), NotifyChannelConfig{Name: "hook", Type: NotifyChannelWebhook, URL: srv.URL}, testNotification())
+	if err == nil || !strings.Contains(err.Error(), "502") || !strings.Contains(err.Error(), "upstream down") {
+		t.Errorf("err = %v, 应包含状态码和返回内容", err)
+	}
+	if err := SendNotification(context.Background(), NotifyChannelConfig{Name: "hook", Type: NotifyChannelWebhook}, testNotification()); err == nil {
+		t.Error("没有 url 时应返回错误")
+	}
+}
+
+func TestSendRobot(t *testing.T) {
+	const secret = "SECabc123"
+	cases := []struct {
+		name    string
+		secret  string
+		query   string
+		reply   string
+		wantErr string
+	}{
+		{"不加签", "", "", `{"errcode":0,"errmsg":"ok"}`, ""},
+		{"钉钉加签", secret, "", `{"errcode":0,"errmsg":"ok"}`, ""},
+		{"url 已有参数时追加", secret, "?access_token=t1", `{"errcode":0}`, ""},
+		{"没有 errcode 按成功", "", "", `ok`, ""},
+		{"errcode 不为0", "", "", `{"errcode":310000,"errmsg":"sign not match"}`, "310000"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var (
+				query robotQuery
+				body  struct {
+					MsgType string `json:"msgtype"`
+					Text    struct {
+						Content string `json:"content"`
+					} `json:"text"`
+				}
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = robotQuery{r.URL.Query().Get("access_token"), r.URL.Query().Get("timestamp"), r.URL.Query().Get("sign")}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("解析机器人消息失败: %v", err)
+				}
+				_, _ = io.WriteString(w, c.reply)
+			}))
+			defer srv.Close()
+
+			n := testNotification()
+			start := time.Now().UnixMilli()
+			err := SendNotification(context.Background(), NotifyChannelConfig{Name: "robot", Type: NotifyChannelRobot,
+				URL: srv.URL + c.query, Secret: c.secret}, n)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("err = %v, 应包含 %s", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SendNotification: %v", err)
+			}
+			if body.MsgType != "text" || body.Text.Content != notificationText(n) {
+				t.Errorf("消息 = %+v", body)
+			}
+			if c.query != "" && query.token != "t1" {
+				t.Errorf("原有参数 access_token = %q, want t1", query.token)
+			}
+			if c.secret == "" {
+				if query.timestamp != "" || query.sign != "" {
+					t.Errorf("不加签时不应带 timestamp/sign，得到 %+v", query)
+				}
+				return
+			}
+			ts, err := strconv.ParseInt(query.timestamp, 10, 64)
+			if err != nil || ts < start || ts > time.Now().UnixMilli() {
+				t.Fatalf("timestamp = %q 应为发送时的毫秒时间戳", query.timestamp)
+			}
+			mac := hmac.New(sha256.New, []byte(c.secret))
+			mac.Write([]byte(query.timestamp + "\n" + c.secret))
+			if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); query.sign != want {
+				t.Errorf("sign = %q, want %q", query.sign, want)
+			}
+		})
+	}
+}
+
+// robotQuery 机器人请求 URL 中的参数
+type robotQuery struct{ token, timestamp, sign string }
+
+// smtpStub 最简单的 SMTP 服务器，不支持 STARTTLS 和认证，记录收到的信封和邮件内容
+type smtpStub struct {
+	ln   net.Listener
+	from string
+	rcpt []string
+	data string
+	done chan struct{}
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	s := &smtpStub{ln: ln, done: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStub) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(line string) { _ = tp.PrintfLine("%s", line) }
+	reply("220 stub ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 stub")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpt = append(s.rcpt, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			b, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(b)
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSendEmail(t *testing.T) {
+	stub := newSMTPStub(t)
+	defer stub.ln.Close()
+	host, port, _ := net.SplitHostPort(stub.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	n := testNotification()
+	n.Content = strings.Repeat("长内容", 40) // 正文超过76个字符，需要折行
+	c := NotifyChannelConfig{Name: "mail", Type: NotifyChannelEmail, Host: host, Port: p, Timeout: "5s",
+		From: "alarm@example.com", To: []string{"a@example.com", "b@example.com"}}
+	if err := SendNotification(context.Background(), c, n); err != nil {
+		t.Fatalf("SendNotification: %v", err)
+	}
+	<-stub.done
+
+	if stub.from != c.From {
+		t.Errorf("MAIL FROM = %q, want %q", stub.from, c.From)
+	}
+	if strings.Join(stub.rcpt, ",") != "a@example.com,b@example.com" {
+		t.Errorf("RCPT TO = %v", stub.rcpt)
+	}
+	tp := textproto.NewReader(bufio.NewReader(strings.NewReader(stub.data)))
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("解析邮件头失败: %v", err)
+	}
+	subject := header.Get("Subject")
+	if !strings.HasPrefix(subject, "=?UTF-8?b?") {
+		t.Errorf("Subject 应为 UTF-8 B 编码，得到 %q", subject)
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err != nil || decoded != n.Title {
+		t.Errorf("Subject 解码 = %q (%v), want %q", decoded, err, n.Title)
+	}
+	if got := header.Get("To"); got != "a@example.com, b@example.com" {
+		t.Errorf("To = %q", got)
+	}
+	if header.Get("Content-Transfer-Encoding") != "base64" || !strings.Contains(header.Get("Content-Type"), "charset=UTF-8") {
+		t.Errorf("邮件头 = %v", header)
+	}
+
+	rest, _ := io.ReadAll(tp.R)
+	var encoded strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(string(rest), "\n"), "\n") {
+		if len(line) > 76 {
+			t.Errorf("正文行超过76个字符: %d", len(line))
+		}
+		encoded.WriteString(strings.TrimSpace(line))
+	}
+	body, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		t.Fatalf("正文 base64 解码失败: %v", err)
+	}
+	if string(body) != notificationText(n) {
+		t.Errorf("正文 = %q, want %q", body, notificationText(n))
+	}
+}
+
+func TestSendEmailConfigError(t *testing.T) {
+	if err := SendNotification(context.Background(), NotifyChannelConfig{Name: "mail", Type: NotifyChannelEmail}, testNotification()); err == nil {
+		t.Error("没有 host/from/to 时应返回错误")
+	}
+	if err := SendNotification(context.Background(), NotifyChannelConfig{Name: "x", Type: "sms"}, testNotification()); err == nil {
+		t.Error("不支持的通道类型应返回错误")
+	}
+}
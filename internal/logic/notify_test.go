@@ -0,0 +1,95 @@
+package logic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotifyRetryDelay(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfg      NotifyConfig
+		attempts int
+		want     time.Duration
+	}{
+		{"未配置时默认30s", NotifyConfig{}, 1, 30 * time.Second},
+		{"第一次失败", NotifyConfig{Backoff: time.Minute}, 1, time.Minute},
+		{"第二次翻倍", NotifyConfig{Backoff: time.Minute}, 2, 2 * time.Minute},
+		{"第四次", NotifyConfig{Backoff: time.Minute}, 4, 8 * time.Minute},
+		{"不超过 MaxBackoff", NotifyConfig{Backoff: time.Minute, MaxBackoff: 5 * time.Minute}, 4, 5 * time.Minute},
+		{"正好等于 MaxBackoff", NotifyConfig{Backoff: time.Minute, MaxBackoff: 4 * time.Minute}, 3, 4 * time.Minute},
+		{"MaxBackoff 为0时不限", NotifyConfig{Backoff: time.Second}, 11, 1024 * time.Second},
+	}
+	for _, c := range cases {
+		if got := c.cfg.retryDelay(c.attempts); got != c.want {
+			t.Errorf("%s: retryDelay(%d) = %s, want %s", c.name, c.attempts, got, c.want)
+		}
+	}
+}
+
+func TestNotifyFailedState(t *testing.T) {
+	cfg := NotifyConfig{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour}
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		attempts   int
+		wantStatus string
+		wantNext   time.Time
+	}{
+		{1, NotifyPending, now.Add(time.Minute)},
+		{2, NotifyPending, now.Add(2 * time.Minute)},
+		{3, NotifyFailed, now.Add(4 * time.Minute)},
+		{4, NotifyFailed, now.Add(8 * time.Minute)},
+	} {
+		status, next := cfg.failedState(c.attempts, now)
+		if status != c.wantStatus || !next.Equal(c.wantNext) {
+			t.Errorf("failedState(%d) = (%s, %s), want (%s, %s)", c.attempts, status, next, c.wantStatus, c.wantNext)
+		}
+	}
+}
+
+func TestNotifyRouteMatch(t *testing.T) {
+	n := &Notification{Kind: "alarm", StationId: "0101", Severity: "critical"}
+	cases := []struct {
+		name  string
+		route NotifyRoute
+		want  bool
+	}{
+		{"空规则匹配所有", NotifyRoute{}, true},
+		{"台站匹配", NotifyRoute{Stations: []string{"0102", "0101"}}, true},
+		{"台站不匹配", NotifyRoute{Stations: []string{"0102"}}, false},
+		{"通配符", NotifyRoute{Stations: []string{"*"}, Kinds: []string{"alarm"}}, true},
+		{"级别不区分大小写", NotifyRoute{Severities: []string{"CRITICAL"}}, true},
+		{"类型不匹配", NotifyRoute{Kinds: []string{"command"}}, false},
+	}
+	for _, c := range cases {
+		if got := c.route.Match(n); got != c.want {
+			t.Errorf("%s: Match = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNotifyRouteQuietUntil(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2026, 10, 18, h, m, 0, 0, time.UTC) }
+	cases := []struct {
+		quiet  string
+		now    time.Time
+		want   time.Time
+		wantOk bool
+	}{
+		{"", at(23, 0), time.Time{}, false},
+		{"bad", at(23, 0), time.Time{}, false},
+		{"08:00-08:00", at(8, 0), time.Time{}, false},
+		{"12:00-14:00", at(13, 0), at(14, 0), true},
+		{"12:00-14:00", at(14, 0), time.Time{}, false},
+		{"22:00-07:00", at(23, 30), at(31, 0), true},
+		{"22:00-07:00", at(6, 59), at(7, 0), true},
+		{"22:00-07:00", at(12, 0), time.Time{}, false},
+	}
+	for _, c := range cases {
+		r := NotifyRoute{QuietHours: c.quiet}
+		got, ok := r.QuietUntil(c.now)
+		if ok != c.wantOk || !got.Equal(c.want) {
+			t.Errorf("%q QuietUntil(%s) = (%s, %v), want (%s, %v)", c.quiet, c.now, got, ok, c.want, c.wantOk)
+		}
+	}
+}
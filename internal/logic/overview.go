@@ -0,0 +1,300 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"gf_api/internal/db"
+	"gf_api/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/redis/go-redis/v9"
+)
+
+// 台站总览的模型结构和实时数据在 redis 中的 key
+const (
+	StationNodeModelBasicKey = "svr_stationNodeModelBasic"
+	StationNodeModelIdxKey   = "svr_stationNodeModelIdx"
+	DataKeyPrefix            = "svr_DATA_"
+)
+
+// DataKey 拼接实时数据的 redis key：svr_DATA_<Num>
+func DataKey(num string) string {
+	return DataKeyPrefix + num
+}
+
+// PreloadError 批量预加载时部分 key 读取失败。
+// 成功的部分仍然可用，失败的 key 在合并时按“没有数据”处理。
+type PreloadError struct {
+	Failed []string
+	Err    error
+}
+
+func (e *PreloadError) Error() string {
+	return fmt.Sprintf("%d 个 svr_DATA key 读取失败: %v", len(e.Failed), e.Err)
+}
+
+func (e *PreloadError) Unwrap() error {
+	return e.Err
+}
+
+// LoadStationModel 读取台站的 Basic 和 Idx，返回使用的来源。
+// redis 中没有该台站的 Basic 或 Idx 时（模型发布任务还没跑过），从数据库 station_node 表搭出 Idx，Basic 为空；
+// overview.fallback.stationNode=false 时不回退。
+func LoadStationModel(ctx context.Context, stationId string) (basic, idx map[string]interface{}, source string, err error) {
+	basic, idx, err = LoadStationModelFromRedis(ctx, stationId)
+	if !errors.Is(err, redis.Nil) || !g.Cfg().MustGet(ctx, "overview.fallback.stationNode", true).Bool() {
+		return basic, idx, ModelSourceRedis, err
+	}
+
+	redisErr := err
+	basic, idx, err = LoadStationModelFromDB(ctx, stationId)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("%v，从 station_node 构造也失败: %w", redisErr, err)
+	}
+	g.Log().Infof(ctx, "台站 %s 在 redis 中没有模型，使用 station_node 构造", stationId)
+	return basic, idx, ModelSourceStationNode, nil
+}
+
+// LoadStationModelFromRedis 并行读取台站的 Basic 和 Idx 并解析，不存在时返回的错误包装了 redis.Nil
+func LoadStationModelFromRedis(ctx context.Context, stationId string) (basic, idx map[string]interface{}, err error) {
+	var (
+		basicStr, idxStr string
+		basicErr, idxErr error
+	)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		basicStr, basicErr = db.Redis.HGet(ctx, StationNodeModelBasicKey, stationId).Result()
+	}()
+	go func() {
+		defer wg.Done()
+		idxStr, idxErr = db.Redis.HGet(ctx, StationNodeModelIdxKey, stationId).Result()
+	}()
+	wg.Wait()
+
+	if basicErr != nil {
+		return nil, nil, fmt.Errorf("读取 %s 出错: %w", StationNodeModelBasicKey, basicErr)
+	}
+	if idxErr != nil {
+		return nil, nil, fmt.Errorf("读取 %s 出错: %w", StationNodeModelIdxKey, idxErr)
+	}
+
+	if err := json.Unmarshal([]byte(basicStr), &basic); err != nil {
+		return nil, nil, fmt.Errorf("解析 Basic JSON 失败: %w", err)
+	}
+	if err := json.Unmarshal([]byte(idxStr), &idx); err != nil {
+		return nil, nil, fmt.Errorf("解析 Idx JSON 失败: %w", err)
+	}
+	return basic, idx, nil
+}
+
+// LoadStationModelFromDB 从 station_node 表搭出台站的 Idx，Basic 为空
+func LoadStationModelFromDB(ctx context.Context, stationId string) (basic, idx map[string]interface{}, err error) {
+	rows, err := LoadStationNodes(ctx, stationId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("station_node 中没有台站 %s 的节点", stationId)
+	}
+	idx, dropped := BuildIdxFromStationNodes(rows)
+	if dropped > 0 {
+		g.Log().Warningf(ctx, "台站 %s 的 station_node 中有 %d 个节点父节点成环或不存在，已忽略", stationId, dropped)
+	}
+	return make(map[string]interface{}), idx, nil
+}
+
+// PreloadDataByNums 批量预加载 Redis 中的 svr_DATA_*（按 positionId / rPositionId）。
+// 每 overview.preload.batchSize（默认500）个 key 一个 pipeline，读取失败的 key 会再重试一次；
+// 仍然失败的 key 通过 *PreloadError 返回，同时返回已经成功读取的数据。
+func PreloadDataByNums(ctx context.Context, nums []string) (map[string]map[string]string, error) {
+	dataCache := make(map[string]map[string]string, len(nums))
+	if len(nums) == 0 {
+		return dataCache, nil
+	}
+
+	batchSize := g.Cfg().MustGet(ctx, "overview.preload.batchSize", 500).Int()
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	// 去重，调用方可能把多个台站的工位号拼在一起传进来
+	keys := make([]string, 0, len(nums))
+	seen := make(map[string]struct{}, len(nums))
+	for _, num := range nums {
+		if num == "" {
+			continue
+		}
+		key := DataKey(num)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+
+	failed, lastErr := preloadBatches(ctx, keys, batchSize, dataCache)
+	if len(failed) > 0 {
+		// 失败的 key 单独再试一次，网络抖动时大多能补回来
+		failed, lastErr = preloadBatches(ctx, failed, batchSize, dataCache)
+	}
+	if len(failed) > 0 {
+		return dataCache, &PreloadError{Failed: failed, Err: lastErr}
+	}
+	return dataCache, nil
+}
+
+// OverviewETag 总览的数据版本 ETag：模型缓存指纹、台站的 Basic/Idx、请求参数和用到的 svr_DATA_* 都不变时不变。
+// 在填值之前算出来，If-None-Match 命中时不必构造内容；响应里的 timestamp、time 这类每次都变的字段不参与。
+func OverviewETag(cache *ModelCache, basic, idx map[string]interface{}, data map[string]map[string]string, params ...string) string {
+	h := fnv.New64a()
+	if cache != nil {
+		_, _ = fmt.Fprintf(h, "%d\x00", cache.Fingerprint)
+	}
+	for _, p := range params {
+		_, _ = h.Write([]byte(p))
+		_, _ = h.Write([]byte{0})
+	}
+	// encoding/json 按 key 排序输出 map，同样的内容得到同样的字节
+	for _, m := range []map[string]interface{}{basic, idx} {
+		b, _ := json.Marshal(m)
+		_, _ = h.Write(b)
+		_, _ = h.Write([]byte{0})
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		hashModelFields(h, k, data[k])
+	}
+	return fmt.Sprintf(`"ov-%016x"`, h.Sum64())
+}
+
+// preloadBatches 按批次执行 HGETALL pipeline，成功的写入 dataCache，返回失败的 key
+func preloadBatches(ctx context.Context, keys []string, batchSize int, dataCache map[string]map[string]string) (failed []string, lastErr error) {
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+
+		pipe := db.Redis.Pipeline()
+		cmds := make([]*redis.MapStringStringCmd, len(batch))
+		for i, key := range batch {
+			cmds[i] = pipe.HGetAll(ctx, key)
+		}
+		// Exec 的错误只是第一个失败命令的错误，逐个检查每条命令
+		_, _ = pipe.Exec(ctx)
+
+		for i, cmd := range cmds {
+			if err := cmd.Err(); err != nil && err != redis.Nil {
+				failed = append(failed, batch[i])
+				lastErr = err
+				continue
+			}
+			dataCache[batch[i]] = cmd.Val()
+		}
+	}
+	return failed, lastErr
+}
+
+// BuildStationTree 构造一个台站的类型化总览树：读取 Basic/Idx，搭好结构后批量预加载需要的 svr_DATA_*，再填值。
+// svr_DATA 部分读取失败时只记录日志，对应属性标记为缺失。
+func BuildStationTree(ctx context.Context, stationId string) (*model.StationTree, error) {
+	cache, err := GetModelCache(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("加载模型缓存失败: %w", err)
+	}
+
+	basic, idx, source, err := LoadStationModel(ctx, stationId)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := NewStationTreeBuilder(stationId, basic, idx, cache)
+	builder.Tree.Source = source
+	dataCache, err := PreloadDataByNums(ctx, builder.DataNums())
+	if err != nil {
+		g.Log().Warningf(ctx, "台站 %s 预加载 svr_DATA 出错: %v", stationId, err)
+	}
+	return builder.Fill(dataCache), nil
+}
+
+// BuildStationSubtree 只构造台站总览中 path 指定的子树，attrs 不为空时只保留这些字段和属性。
+// 子树外的 svr_DATA_* 不会被加载。
+func BuildStationSubtree(ctx context.Context, stationId string, path, attrs []string) (*model.Node, error) {
+	cache, err := GetModelCache(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("加载模型缓存失败: %w", err)
+	}
+
+	basic, idx, source, err := LoadStationModel(ctx, stationId)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := NewStationTreeBuilder(stationId, basic, idx, cache)
+	builder.Tree.Source = source
+	node := builder.Select(path, attrs)
+	if node == nil {
+		return nil, fmt.Errorf("台站 %s 中未找到节点 %s", stationId, strings.Join(path, "/"))
+	}
+	dataCache, err := PreloadDataByNums(ctx, builder.DataNums())
+	if err != nil {
+		g.Log().Warningf(ctx, "台站 %s 预加载 svr_DATA 出错: %v", stationId, err)
+	}
+	builder.Fill(dataCache)
+	node.Project(attrs)
+	return node, nil
+}
+
+// FindWirePath 在旧版输出结构中按路径取子树，每一级先精确匹配，再不区分大小写匹配
+func FindWirePath(content map[string]interface{}, path []string) (interface{}, bool) {
+	var cur interface{} = content
+	for _, name := range path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		next, ok := m[name]
+		if !ok {
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if strings.EqualFold(k, name) {
+					next, ok = m[k], true
+					break
+				}
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+	return cur, true
+}
+
+// BuildOverview 构造一个台站的总览数据（旧版输出结构），
+// 同时返回取值用到的工位号，方便调用方按工位号订阅数据变化。
+func BuildOverview(ctx context.Context, stationId string) (content map[string]interface{}, nums []string, err error) {
+	tree, err := BuildStationTree(ctx, stationId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tree.Root.WireMap(), TreeDataNums(tree.Root), nil
+}
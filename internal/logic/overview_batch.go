@@ -0,0 +1,259 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gf_api/internal/db"
+	"gf_api/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/redis/go-redis/v9"
+)
+
+// 多台站总览：所有台站共用一份模型缓存，Basic/Idx 用一次 HMGET 取回，
+// 所有台站需要的 svr_DATA_* 合在一起做一次批量预加载，单个台站出错只影响它自己。
+
+// StationIdKey redis 中所有台站ID的 key
+const StationIdKey = "svr_station_id"
+
+// StationTreeResult 单个台站的构造结果
+type StationTreeResult struct {
+	StationId string
+	Tree      *model.StationTree
+	Err       error
+}
+
+// ListStationIds 读取 svr_station_id 中的所有台站ID。
+// 兼容字符串数组、对象数组（stationId/station_id/value/id 字段）、以台站ID为 key 的对象和逗号分隔的字符串。
+func ListStationIds(ctx context.Context) ([]string, error) {
+	val, err := db.Redis.Get(ctx, StationIdKey).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("Redis key '%s' 不存在", StationIdKey)
+	} else if err != nil {
+		return nil, err
+	}
+	return parseStationIds(val), nil
+}
+
+func parseStationIds(val string) []string {
+	var ids []string
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(val), &decoded); err != nil {
+		for _, id := range strings.Split(val, ",") {
+			ids = append(ids, strings.TrimSpace(id))
+		}
+		return uniqueNonEmpty(ids)
+	}
+
+	switch v := decoded.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if obj, ok := item.(map[string]interface{}); ok {
+				for _, key := range []string{"stationId", "station_id", "StationId", "value", "id"} {
+					if id := gconv.String(obj[key]); id != "" {
+						ids = append(ids, id)
+						break
+					}
+				}
+				continue
+			}
+			ids = append(ids, gconv.String(item))
+		}
+	case map[string]interface{}:
+		for k := range v {
+			ids = append(ids, k)
+		}
+		sort.Strings(ids)
+	default:
+		ids = append(ids, gconv.String(v))
+	}
+	return uniqueNonEmpty(ids)
+}
+
+func uniqueNonEmpty(ids []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	return out
+}
+
+// BuildStationTrees 构造多个台站的总览树，结果顺序和 stationIds 一致，同时返回构造时使用的模型缓存版本。
+// 解析和填值的并发数由 overview.batch.concurrency 配置，默认8。
+// 每个台站的搭结构（含 station_node 回退）和填值各自限时 overview.batch.stationTimeout（默认10s），
+// 超时或 panic 记为该台站的错误，不影响其他台站；共用的 svr_DATA 预加载限时 overview.batch.preloadTimeout（默认30s），
+// 超时后已经取到的数据照常填值，没取到的属性按缺失处理。
+func BuildStationTrees(ctx context.Context, stationIds []string) ([]StationTreeResult, int64, error) {
+	results := make([]StationTreeResult, len(stationIds))
+	for i, id := range stationIds {
+		results[i].StationId = id
+	}
+
+	cache, err := GetModelCache(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("加载模型缓存失败: %w", err)
+	}
+	if len(stationIds) == 0 {
+		return results, cache.Version, nil
+	}
+
+	// 1.一次往返取回所有台站的 Basic 和 Idx
+	pipe := db.Redis.Pipeline()
+	basicCmd := pipe.HMGet(ctx, StationNodeModelBasicKey, stationIds...)
+	idxCmd := pipe.HMGet(ctx, StationNodeModelIdxKey, stationIds...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, 0, fmt.Errorf("读取台站模型失败: %w", err)
+	}
+	basicVals, idxVals := basicCmd.Val(), idxCmd.Val()
+
+	concurrency := g.Cfg().MustGet(ctx, "overview.batch.concurrency", 8).Int()
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	stationTimeout := g.Cfg().MustGet(ctx, "overview.batch.stationTimeout", "10s").Duration()
+	if stationTimeout <= 0 {
+		stationTimeout = 10 * time.Second
+	}
+	preloadTimeout := g.Cfg().MustGet(ctx, "overview.batch.preloadTimeout", "30s").Duration()
+	if preloadTimeout <= 0 {
+		preloadTimeout = 30 * time.Second
+	}
+
+	// 2.并发解析并搭结构，redis 中没有模型的台站从 station_node 构造
+	fallback := g.Cfg().MustGet(ctx, "overview.fallback.stationNode", true).Bool()
+	builders := make([]*StationTreeBuilder, len(stationIds))
+	runBounded(len(stationIds), concurrency, func(i int) {
+		var b *StationTreeBuilder
+		results[i].Err = runStation(ctx, stationTimeout, "构造台站结构", func(ctx context.Context) (err error) {
+			if fallback && (basicVals[i] == nil || idxVals[i] == nil) {
+				b, err = newBuilderFromDB(ctx, stationIds[i], cache)
+				return err
+			}
+			b, err = newBuilderFromRaw(stationIds[i], basicVals[i], idxVals[i], cache)
+			return err
+		})
+		if results[i].Err == nil {
+			builders[i] = b
+		}
+	})
+
+	// 3.所有台站的工位号合在一起预加载一次
+	var nums []string
+	for _, b := range builders {
+		if b != nil {
+			nums = append(nums, b.DataNums()...)
+		}
+	}
+	preloadCtx, cancel := context.WithTimeout(ctx, preloadTimeout)
+	dataCache, err := PreloadDataByNums(preloadCtx, nums)
+	cancel()
+	if err != nil {
+		g.Log().Warningf(ctx, "多台站预加载 svr_DATA 出错: %v", err)
+	}
+
+	// 4.并发填值
+	runBounded(len(stationIds), concurrency, func(i int) {
+		if builders[i] == nil {
+			return
+		}
+		var tree *model.StationTree
+		results[i].Err = runStation(ctx, stationTimeout, "填充台站数据", func(context.Context) error {
+			tree = builders[i].Fill(dataCache)
+			return nil
+		})
+		if results[i].Err == nil {
+			results[i].Tree = tree
+		}
+	})
+	return results, cache.Version, nil
+}
+
+// runStation 在 timeout 内执行一个台站的一步（step 为步骤名，用在错误信息中）。
+// 超时或 fn 出现 panic 时返回该台站的错误；超时时不等 fn 结束，fn 应在 ctx 取消后尽快返回，
+// 并且只能把结果写到调用方在返回 nil 之后才读取的变量里。
+func runStation(ctx context.Context, timeout time.Duration, step string, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("%s异常: %v", step, p)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%s超时（%s）: %w", step, timeout, ctx.Err())
+	}
+}
+
+// newBuilderFromRaw 解析 HMGET 取回的 Basic/Idx
+func newBuilderFromRaw(stationId string, basicVal, idxVal interface{}, cache *ModelCache) (*StationTreeBuilder, error) {
+	basicStr, ok := basicVal.(string)
+	if !ok {
+		return nil, fmt.Errorf("Redis中未找到 %s,[%s]", StationNodeModelBasicKey, stationId)
+	}
+	idxStr, ok := idxVal.(string)
+	if !ok {
+		return nil, fmt.Errorf("Redis中未找到 %s,[%s]", StationNodeModelIdxKey, stationId)
+	}
+
+	var basic, idx map[string]interface{}
+	if err := json.Unmarshal([]byte(basicStr), &basic); err != nil {
+		return nil, fmt.Errorf("解析 Basic JSON 失败: %w", err)
+	}
+	if err := json.Unmarshal([]byte(idxStr), &idx); err != nil {
+		return nil, fmt.Errorf("解析 Idx JSON 失败: %w", err)
+	}
+	b := NewStationTreeBuilder(stationId, basic, idx, cache)
+	b.Tree.Source = ModelSourceRedis
+	return b, nil
+}
+
+// newBuilderFromDB 从 station_node 构造台站结构
+func newBuilderFromDB(ctx context.Context, stationId string, cache *ModelCache) (*StationTreeBuilder, error) {
+	basic, idx, err := LoadStationModelFromDB(ctx, stationId)
+	if err != nil {
+		return nil, fmt.Errorf("Redis中未找到台站模型，从 station_node 构造失败: %w", err)
+	}
+	b := NewStationTreeBuilder(stationId, basic, idx, cache)
+	b.Tree.Source = ModelSourceStationNode
+	return b, nil
+}
+
+// runBounded 以最多 limit 个协程执行 fn(0..n-1)，全部完成后返回
+func runBounded(n, limit int, fn func(i int)) {
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,77 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunStation(t *testing.T) {
+	ctx := context.Background()
+	if err := runStation(ctx, time.Second, "构造台站结构", func(context.Context) error { return nil }); err != nil {
+		t.Errorf("正常执行不应返回错误: %v", err)
+	}
+
+	want := errors.New("station_node 查询失败")
+	if err := runStation(ctx, time.Second, "构造台站结构", func(context.Context) error { return want }); !errors.Is(err, want) {
+		t.Errorf("应返回 fn 的错误，得到 %v", err)
+	}
+
+	err := runStation(ctx, time.Second, "填充台站数据", func(context.Context) error { panic("节点为空") })
+	if err == nil || !strings.Contains(err.Error(), "填充台站数据异常") || !strings.Contains(err.Error(), "节点为空") {
+		t.Errorf("panic 应转成该台站的错误，得到 %v", err)
+	}
+
+	// 超时时不等 fn 结束
+	release := make(chan struct{})
+	defer close(release)
+	start := time.Now()
+	err = runStation(ctx, 20*time.Millisecond, "构造台站结构", func(context.Context) error {
+		<-release
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "构造台站结构超时") {
+		t.Errorf("超时应返回该台站的超时错误，得到 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("超时后应立即返回，实际用时 %s", elapsed)
+	}
+
+	// fn 能收到取消
+	err = runStation(ctx, 20*time.Millisecond, "构造台站结构", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("fn 应能通过 ctx 收到超时，得到 %v", err)
+	}
+}
+
+func TestNewBuilderFromRaw(t *testing.T) {
+	cache := &ModelCache{Resolver: NewAttributeResolver(DefaultResolveRules())}
+	cases := []struct {
+		name       string
+		basic, idx interface{}
+		wantErr    string
+	}{
+		{"没有 Basic", nil, `{}`, StationNodeModelBasicKey},
+		{"没有 Idx", `{}`, nil, StationNodeModelIdxKey},
+		{"Basic 格式错误", `{`, `{}`, "解析 Basic JSON 失败"},
+		{"Idx 格式错误", `{}`, `[]`, "解析 Idx JSON 失败"},
+	}
+	for _, c := range cases {
+		if _, err := newBuilderFromRaw("0101", c.basic, c.idx, cache); err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("%s: 应返回包含 %q 的错误，得到 %v", c.name, c.wantErr, err)
+		}
+	}
+
+	b, err := newBuilderFromRaw("0101", `{"发射机": {"nodeName": "发射机"}}`, `{"发射机": {"positionId": "0101_01"}}`, cache)
+	if err != nil {
+		t.Fatalf("构造失败: %v", err)
+	}
+	if b.Tree.Source != ModelSourceRedis || b.Tree.Root.Find([]string{"发射机"}) == nil {
+		t.Errorf("构造结果为 %+v", b.Tree)
+	}
+}
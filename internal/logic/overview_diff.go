@@ -0,0 +1,137 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 两棵台站总览树（旧版输出结构）的结构化比较。
+// 可以是同一台站的当前值和历史快照，也可以是同一模型的两个台站（例如主站和备站）。
+
+// 差异类型
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// DiffEntry 一条差异
+type DiffEntry struct {
+	Type string      `json:"type"`          // added / removed / changed
+	Path string      `json:"path"`          // 所在节点路径，以 / 分隔，根节点为空
+	Name string      `json:"name"`          // 属性或子节点名
+	Node bool        `json:"node"`          // true 表示整个子节点只在一边存在
+	Old  interface{} `json:"old,omitempty"` // 左边的值
+	New  interface{} `json:"new,omitempty"` // 右边的值
+}
+
+// OverviewDiff 比较结果，按路径和名称排序
+type OverviewDiff struct {
+	Added   []DiffEntry `json:"added"`
+	Removed []DiffEntry `json:"removed"`
+	Changed []DiffEntry `json:"changed"`
+}
+
+// OverviewSide 比较的一边：台站ID，At 为零值表示当前值
+type OverviewSide struct {
+	StationId string
+	At        time.Time
+}
+
+// Label 用于提示信息
+func (s OverviewSide) Label() string {
+	if s.At.IsZero() {
+		return s.StationId + "@当前"
+	}
+	return s.StationId + "@" + s.At.Format("2006-01-02 15:04:05")
+}
+
+// LoadOverviewSide 取一边总览中 path 指定的子树：At 为零值时实时构造，和 BuildStationSubtree 一样只加载子树内的 svr_DATA_*；
+// 否则从历史快照重建后按路径取子树
+func LoadOverviewSide(ctx context.Context, side OverviewSide, path []string) (map[string]interface{}, error) {
+	if side.At.IsZero() {
+		node, err := BuildStationSubtree(ctx, side.StationId, path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", side.Label(), err)
+		}
+		return node.WireMap(), nil
+	}
+	res, err := OverviewAt(ctx, side.StationId, side.At)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", side.Label(), err)
+	}
+	target, found := FindWirePath(res.Content, path)
+	sub, ok := target.(map[string]interface{})
+	if !found || !ok {
+		return nil, fmt.Errorf("%s 中未找到节点 %s", side.Label(), strings.Join(path, "/"))
+	}
+	return sub, nil
+}
+
+// CompareOverview 比较左右两棵树，base 为两棵树所在的节点路径（用于输出），ignore 中的名称（不区分大小写）不参与比较
+func CompareOverview(left, right map[string]interface{}, base []string, ignore []string) *OverviewDiff {
+	skip := make(map[string]struct{}, len(ignore))
+	for _, name := range ignore {
+		skip[strings.ToLower(name)] = struct{}{}
+	}
+	d := &OverviewDiff{
+		Added:   make([]DiffEntry, 0),
+		Removed: make([]DiffEntry, 0),
+		Changed: make([]DiffEntry, 0),
+	}
+	compareNode(base, left, right, skip, d)
+	return d
+}
+
+func compareNode(path []string, left, right map[string]interface{}, skip map[string]struct{}, d *OverviewDiff) {
+	keys := make([]string, 0, len(left)+len(right))
+	for k := range left {
+		keys = append(keys, k)
+	}
+	for k := range right {
+		if _, ok := left[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	nodePath := strings.Join(path, "/")
+	for _, k := range keys {
+		if _, ok := skip[strings.ToLower(k)]; ok {
+			continue
+		}
+		l, inLeft := left[k]
+		r, inRight := right[k]
+		lSub, lIsNode := l.(map[string]interface{})
+		rSub, rIsNode := r.(map[string]interface{})
+
+		switch {
+		case !inRight:
+			d.Removed = append(d.Removed, DiffEntry{Type: DiffRemoved, Path: nodePath, Name: k, Node: lIsNode, Old: l})
+		case !inLeft:
+			d.Added = append(d.Added, DiffEntry{Type: DiffAdded, Path: nodePath, Name: k, Node: rIsNode, New: r})
+		case lIsNode && rIsNode:
+			compareNode(append(path[:len(path):len(path)], k), lSub, rSub, skip, d)
+		case !reflect.DeepEqual(l, r):
+			d.Changed = append(d.Changed, DiffEntry{Type: DiffChanged, Path: nodePath, Name: k, Node: lIsNode || rIsNode, Old: l, New: r})
+		}
+	}
+}
+
+// CompareOverviewSides 取两边总览中 path 指定的子树后比较
+func CompareOverviewSides(ctx context.Context, left, right OverviewSide, path []string, ignore []string) (*OverviewDiff, error) {
+	sides := [2]OverviewSide{left, right}
+	var contents [2]map[string]interface{}
+	for i, side := range sides {
+		content, err := LoadOverviewSide(ctx, side, path)
+		if err != nil {
+			return nil, err
+		}
+		contents[i] = content
+	}
+	return CompareOverview(contents[0], contents[1], path, ignore), nil
+}
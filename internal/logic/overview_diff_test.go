@@ -0,0 +1,64 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareOverview(t *testing.T) {
+	left := map[string]interface{}{
+		"positionId": "0101_01",
+		"Power":      10.0,
+		"Status":     "运行",
+		"Time":       "08:00:00",
+		"1号机": map[string]interface{}{
+			"Power": 5.0,
+			"风机":    map[string]interface{}{"Speed": 100.0},
+		},
+		"2号机":   map[string]interface{}{"Power": 4.0},
+		"Mode":  map[string]interface{}{"value": 1.0},
+		"Modes": []interface{}{"A", "B"},
+	}
+	right := map[string]interface{}{
+		"positionId": "0101_01",
+		"Power":      11.0,
+		"Status":     "运行",
+		"Time":       "08:01:00",
+		"Reflect":    1.0,
+		"1号机": map[string]interface{}{
+			"Power": 5.0,
+			"风机":    map[string]interface{}{"Speed": 120.0, "Temp": 40.0},
+		},
+		"3号机":   map[string]interface{}{"Power": 3.0},
+		"Mode":  2.0,
+		"Modes": []interface{}{"A", "C"},
+	}
+
+	d := CompareOverview(left, right, []string{"发射机"}, []string{"time"})
+	want := &OverviewDiff{
+		Added: []DiffEntry{
+			{Type: DiffAdded, Path: "发射机/1号机/风机", Name: "Temp", New: 40.0},
+			{Type: DiffAdded, Path: "发射机", Name: "3号机", Node: true, New: map[string]interface{}{"Power": 3.0}},
+			{Type: DiffAdded, Path: "发射机", Name: "Reflect", New: 1.0},
+		},
+		Removed: []DiffEntry{
+			{Type: DiffRemoved, Path: "发射机", Name: "2号机", Node: true, Old: map[string]interface{}{"Power": 4.0}},
+		},
+		Changed: []DiffEntry{
+			{Type: DiffChanged, Path: "发射机/1号机/风机", Name: "Speed", Old: 100.0, New: 120.0},
+			{Type: DiffChanged, Path: "发射机", Name: "Mode", Node: true, Old: map[string]interface{}{"value": 1.0}, New: 2.0},
+			{Type: DiffChanged, Path: "发射机", Name: "Modes", Old: []interface{}{"A", "B"}, New: []interface{}{"A", "C"}},
+			{Type: DiffChanged, Path: "发射机", Name: "Power", Old: 10.0, New: 11.0},
+		},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("比较结果为 %+v\n期望 %+v", d, want)
+	}
+
+	// 相同的树没有差异，结果中的数组不为 nil（输出为 []）
+	d = CompareOverview(left, left, nil, nil)
+	if d.Added == nil || d.Removed == nil || d.Changed == nil ||
+		len(d.Added)+len(d.Removed)+len(d.Changed) != 0 {
+		t.Errorf("相同的树不应有差异，得到 %+v", d)
+	}
+}
@@ -0,0 +1,177 @@
+package logic
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"gf_api/internal/model"
+
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// 台站总览导出成属性平铺表。
+// 行数据直接取自 StationTreeBuilder 构造的树，取值工位号、parno 和值与总览接口输出的一致；
+// 没取到数据（总览中不出现）的属性不导出。
+
+// ExportHeader 导出表的表头
+var ExportHeader = []string{"台站", "节点路径", "属性名", "类型", "工位号", "parno", "值"}
+
+// ExportRow 导出表的一行
+type ExportRow struct {
+	StationId  string
+	Path       string
+	Name       string
+	Kind       model.AttributeKind
+	PositionId string
+	Parno      string
+	Value      string
+}
+
+// Strings 按表头顺序输出
+func (r ExportRow) Strings() []string {
+	return []string{r.StationId, r.Path, r.Name, string(r.Kind), r.PositionId, r.Parno, r.Value}
+}
+
+// ExportRows 把节点子树平铺成行，节点和属性都按名称排序
+func ExportRows(stationId string, root *model.Node) []ExportRow {
+	rows := make([]ExportRow, 0)
+	root.Walk(func(n *model.Node) bool {
+		path := n.PathString()
+		for _, name := range n.AttributeNames() {
+			a := n.Attributes[name]
+			if a.Missing {
+				continue
+			}
+			rows = append(rows, ExportRow{
+				StationId:  stationId,
+				Path:       path,
+				Name:       a.Name,
+				Kind:       a.Kind,
+				PositionId: a.PositionId,
+				Parno:      a.Parno,
+				Value:      gconv.String(a.Raw),
+			})
+		}
+		return true
+	})
+	return rows
+}
+
+// WriteExportCSV 写 CSV，带 UTF-8 BOM 以便 Excel 直接打开时中文不乱码
+func WriteExportCSV(w io.Writer, rows []ExportRow) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ExportHeader); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write(r.Strings()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteExportXLSX 写只有一个工作表的 xlsx，单元格都用内联字符串
+func WriteExportXLSX(w io.Writer, sheetName string, rows []ExportRow) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(sheetName))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+
+	fw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	if err := writeXLSXSheet(fw, rows); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeXLSXSheet(w io.Writer, rows []ExportRow) error {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`)
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	writeRow := func(rowNum int, cells []string) {
+		fmt.Fprintf(&sb, `<row r="%d">`, rowNum)
+		for i, c := range cells {
+			fmt.Fprintf(&sb, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, xlsxColumn(i), rowNum, xmlEscape(c))
+		}
+		sb.WriteString(`</row>`)
+	}
+	writeRow(1, ExportHeader)
+	for i, r := range rows {
+		writeRow(i+2, r.Strings())
+		// 行数多时分段写出，避免整张表都留在内存里
+		if sb.Len() > 1<<20 {
+			if _, err := io.WriteString(w, sb.String()); err != nil {
+				return err
+			}
+			sb.Reset()
+		}
+	}
+	sb.WriteString(`</sheetData></worksheet>`)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// xlsxColumn 列序号（从0开始）转成 A、B … Z、AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
@@ -0,0 +1,160 @@
+package logic
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gf_api/internal/model"
+)
+
+func exportTree() *model.Node {
+	root := model.NewNode("", nil)
+	tx := root.Child("发射机").Child("1号机")
+	tx.SetAttribute(&model.Attribute{Name: "Status", Kind: model.AttributeDynamic, PositionId: "0101_01", Parno: "St", Raw: `运行,"主机"`})
+	tx.SetAttribute(&model.Attribute{Name: "Power", Kind: model.AttributeDynamic, PositionId: "0101_09", Parno: "RPower", Raw: 10.5})
+	tx.SetAttribute(&model.Attribute{Name: "Reflect", Kind: model.AttributeDynamic, PositionId: "0101_01", Parno: "Reflect", Missing: true})
+	tx.Child("风机").SetAttribute(&model.Attribute{Name: "Note", Kind: model.AttributeStatic, Raw: "第一行\n第二行"})
+	root.Child("配电").SetAttribute(&model.Attribute{Name: "Mode", Kind: model.AttributeSetItem, PositionId: "0101_05", Parno: "Mode", Raw: "<自动> & 手动"})
+	return root
+}
+
+func exportWant() [][]string {
+	return [][]string{
+		ExportHeader,
+		{"0101", "发射机/1号机", "Power", "dynamic", "0101_09", "RPower", "10.5"},
+		{"0101", "发射机/1号机", "Status", "dynamic", "0101_01", "St", `运行,"主机"`},
+		{"0101", "发射机/1号机/风机", "Note", "static", "", "", "第一行\n第二行"},
+		{"0101", "配电", "Mode", "setitem", "0101_05", "Mode", "<自动> & 手动"},
+	}
+}
+
+func TestWriteExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteExportCSV(&buf, ExportRows("0101", exportTree())); err != nil {
+		t.Fatalf("写 CSV 失败: %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "\ufeff台站,节点路径,属性名,类型,工位号,parno,值\n") {
+		t.Errorf("应以 BOM 和表头开始，得到 %q", out)
+	}
+	// 含逗号、引号、换行的值加引号转义
+	for _, s := range []string{`"运行,""主机"""`, "\"第一行\n第二行\""} {
+		if !strings.Contains(out, s) {
+			t.Errorf("输出中应包含转义后的 %q，得到 %q", s, out)
+		}
+	}
+
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(out, "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatalf("读回 CSV 失败: %v", err)
+	}
+	if want := exportWant(); !reflect.DeepEqual(records, want) {
+		t.Errorf("读回的 CSV 为 %q\n期望 %q", records, want)
+	}
+}
+
+// xlsxSheet 只解析测试需要的部分
+type xlsxSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R    string `xml:"r,attr"`
+			T    string `xml:"t,attr"`
+			V    string `xml:"v"`
+			Text string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readZipFile(t *testing.T, zr *zip.Reader, name string) []byte {
+	t.Helper()
+	f, err := zr.Open(name)
+	if err != nil {
+		t.Fatalf("xlsx 中没有 %s: %v", name, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("读取 %s 失败: %v", name, err)
+	}
+	return data
+}
+
+func TestWriteExportXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteExportXLSX(&buf, "台站<0101>", ExportRows("0101", exportTree())); err != nil {
+		t.Fatalf("写 xlsx 失败: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("xlsx 不是有效的 zip: %v", err)
+	}
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	wantNames := []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("xlsx 中的文件为 %v，期望 %v", names, wantNames)
+	}
+
+	// 单元格都是内联字符串，不使用共享字符串表
+	if types := string(readZipFile(t, zr, "[Content_Types].xml")); strings.Contains(types, "sharedStrings") {
+		t.Errorf("[Content_Types].xml 不应引用共享字符串表: %s", types)
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(readZipFile(t, zr, "xl/workbook.xml"), &workbook); err != nil {
+		t.Fatalf("解析 workbook.xml 失败: %v", err)
+	}
+	if len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != "台站<0101>" {
+		t.Errorf("工作表为 %+v", workbook.Sheets)
+	}
+
+	var sheet xlsxSheet
+	if err := xml.Unmarshal(readZipFile(t, zr, "xl/worksheets/sheet1.xml"), &sheet); err != nil {
+		t.Fatalf("解析 sheet1.xml 失败: %v", err)
+	}
+	want := exportWant()
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("工作表有 %d 行，期望 %d 行", len(sheet.Rows), len(want))
+	}
+	for i, row := range sheet.Rows {
+		if row.R != i+1 {
+			t.Errorf("第 %d 行的行号为 %d", i+1, row.R)
+		}
+		got := make([]string, 0, len(row.Cells))
+		for j, c := range row.Cells {
+			if ref := fmt.Sprintf("%s%d", xlsxColumn(j), i+1); c.R != ref {
+				t.Errorf("第 %d 行第 %d 列的引用为 %s，期望 %s", i+1, j+1, c.R, ref)
+			}
+			if c.T != "inlineStr" || c.V != "" {
+				t.Errorf("单元格 %s 应为内联字符串，得到 t=%q v=%q", c.R, c.T, c.V)
+			}
+			got = append(got, c.Text)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("第 %d 行为 %q\n期望 %q", i+1, got, want[i])
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 6: "G", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("xlsxColumn(%d) = %s，期望 %s", i, got, want)
+		}
+	}
+}
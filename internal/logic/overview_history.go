@@ -0,0 +1,325 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+)
+
+// 台站总览历史快照。
+// 定时构造所有台站的总览，存到 PostgreSQL 的 overview_snapshot 表：
+//   - full：完整的总览（旧版输出结构），每个台站第一次采集、模型版本变化或每 overview.history.fullEvery 次采集存一次；
+//   - delta：和上一次采集相比的 JSON Patch，没有变化时不存。
+// 查询某个时间点时，取该时间点之前最近的 full，再依次应用之后的 delta。
+
+// OverviewSnapshotTable 历史快照表名
+const OverviewSnapshotTable = "overview_snapshot"
+
+// 快照类型
+const (
+	SnapshotFull  = "full"
+	SnapshotDelta = "delta"
+)
+
+// ErrNoSnapshot 指定时间之前没有完整快照
+var ErrNoSnapshot = errors.New("指定时间之前没有历史快照")
+
+// OverviewAtResult 某个时间点的台站总览
+type OverviewAtResult struct {
+	StationId    string
+	Content      map[string]interface{}
+	ModelVersion int64
+	CapturedAt   time.Time // 实际使用的最后一条快照的采集时间
+	Deltas       int       // 在完整快照上应用的增量条数
+}
+
+// historyState 每个台站上一次采集的内容，只在采集协程里使用
+type historyState struct {
+	content      map[string]interface{}
+	modelVersion int64
+	sinceFull    int
+}
+
+var historyStarted atomic.Bool
+
+// StartOverviewHistory 启动历史快照采集，每 overview.history.interval（默认1m）采集一次。
+// overview.history.enabled=false 时不启动；超过 overview.history.retainDays（默认30）天的快照每天清理一次。
+func StartOverviewHistory(ctx context.Context) {
+	if !g.Cfg().MustGet(ctx, "overview.history.enabled", true).Bool() {
+		return
+	}
+	if !historyStarted.CompareAndSwap(false, true) {
+		return
+	}
+
+	interval := g.Cfg().MustGet(ctx, "overview.history.interval", "1m").Duration()
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	fullEvery := g.Cfg().MustGet(ctx, "overview.history.fullEvery", 60).Int()
+	if fullEvery <= 0 {
+		fullEvery = 60
+	}
+	retainDays := g.Cfg().MustGet(ctx, "overview.history.retainDays", 30).Int()
+
+	go func() {
+		states := make(map[string]*historyState)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastPurge time.Time
+		for {
+			if err := captureOverviewHistory(ctx, states, fullEvery); err != nil {
+				g.Log().Warningf(ctx, "采集台站总览历史快照失败: %v", err)
+			}
+			if retainDays > 0 && time.Since(lastPurge) >= 24*time.Hour {
+				if err := purgeOverviewHistory(ctx, retainDays); err != nil {
+					g.Log().Warningf(ctx, "清理台站总览历史快照失败: %v", err)
+				} else {
+					lastPurge = time.Now()
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// captureOverviewHistory 采集一次所有台站的总览，写入完整快照或增量
+func captureOverviewHistory(ctx context.Context, states map[string]*historyState, fullEvery int) error {
+	if err := checkDB(); err != nil {
+		return err
+	}
+	stationIds, err := ListStationIds(ctx)
+	if err != nil {
+		return err
+	}
+	results, _, err := BuildStationTrees(ctx, stationIds)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rows := make([]g.Map, 0, len(results))
+	next := make(map[string]*historyState, len(results))
+	for _, res := range results {
+		if res.Err != nil {
+			// 构造失败时保留上一次的状态，下次成功后和它比较
+			if st, ok := states[res.StationId]; ok {
+				next[res.StationId] = st
+			}
+			continue
+		}
+
+		content := res.Tree.Root.WireMap()
+		st := states[res.StationId]
+		var (
+			kind    string
+			payload interface{}
+		)
+		switch {
+		case st == nil || st.modelVersion != res.Tree.ModelVersion || st.sinceFull+1 >= fullEvery:
+			kind, payload = SnapshotFull, content
+			st = &historyState{}
+		default:
+			ops := DiffOverview(st.content, content)
+			if len(ops) == 0 {
+				next[res.StationId] = st
+				continue
+			}
+			kind, payload = SnapshotDelta, ops
+			st.sinceFull++
+		}
+
+		data, err := json.Marshal(payload)
+		if err != nil {
+			g.Log().Warningf(ctx, "序列化台站 %s 历史快照失败: %v", res.StationId, err)
+			continue
+		}
+		rows = append(rows, g.Map{
+			"station_id":    res.StationId,
+			"kind":          kind,
+			"model_version": res.Tree.ModelVersion,
+			"captured_at":   now,
+			"content":       string(data),
+		})
+		st.content, st.modelVersion = content, res.Tree.ModelVersion
+		next[res.StationId] = st
+	}
+
+	if len(rows) > 0 {
+		if _, err := db.PgDB.Model(OverviewSnapshotTable).Ctx(ctx).Data(rows).Insert(); err != nil {
+			// 写入失败时下次全部重新存完整快照，避免增量缺一段
+			for k := range states {
+				delete(states, k)
+			}
+			return fmt.Errorf("写入历史快照失败: %w", err)
+		}
+	}
+	for k := range states {
+		delete(states, k)
+	}
+	for k, v := range next {
+		states[k] = v
+	}
+	return nil
+}
+
+// purgeOverviewHistory 清理过期快照。增量依赖它之前最近的完整快照，所以每个台站只删除
+// 截止时间之前最新一个完整快照之前的记录，该完整快照和之后的增量保留；截止时间之前没有完整快照的台站不删除。
+func purgeOverviewHistory(ctx context.Context, retainDays int) error {
+	if err := checkDB(); err != nil {
+		return err
+	}
+	cutoff := time.Now().AddDate(0, 0, -retainDays)
+	res, err := db.PgDB.GetAll(ctx, `SELECT station_id, captured_at FROM `+OverviewSnapshotTable+`
+		WHERE kind = ? AND captured_at <= ?`, SnapshotFull, cutoff)
+	if err != nil {
+		return fmt.Errorf("查询完整快照失败: %w", err)
+	}
+	fulls := make([]snapshotMeta, 0, len(res))
+	for _, row := range res {
+		fulls = append(fulls, snapshotMeta{StationId: row["station_id"].String(), Kind: SnapshotFull, CapturedAt: row["captured_at"].Time()})
+	}
+	for stationId, base := range overviewPurgeBefore(fulls, cutoff) {
+		if _, err := db.PgDB.Exec(ctx, `DELETE FROM `+OverviewSnapshotTable+` WHERE station_id = ? AND captured_at < ?`,
+			stationId, base); err != nil {
+			return fmt.Errorf("清理台站 %s 的历史快照失败: %w", stationId, err)
+		}
+	}
+	return nil
+}
+
+// snapshotMeta 一条快照的台站、类型和采集时间
+type snapshotMeta struct {
+	StationId  string
+	Kind       string
+	CapturedAt time.Time
+}
+
+// overviewPurgeBefore 每个台站可以删除的时间界限：截止时间之前（含）最新的完整快照的采集时间，早于它的记录都可以删除
+func overviewPurgeBefore(snapshots []snapshotMeta, cutoff time.Time) map[string]time.Time {
+	bases := make(map[string]time.Time)
+	for _, m := range snapshots {
+		if m.Kind != SnapshotFull || m.CapturedAt.After(cutoff) {
+			continue
+		}
+		if base, ok := bases[m.StationId]; !ok || m.CapturedAt.After(base) {
+			bases[m.StationId] = m.CapturedAt
+		}
+	}
+	return bases
+}
+
+// OverviewAt 重建台站在 at 时刻的总览
+func OverviewAt(ctx context.Context, stationId string, at time.Time) (*OverviewAtResult, error) {
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+
+	full, err := db.PgDB.GetOne(ctx, `SELECT id, model_version, captured_at, content FROM `+OverviewSnapshotTable+`
+		WHERE station_id = ? AND kind = ? AND captured_at <= ? ORDER BY captured_at DESC, id DESC LIMIT 1`,
+		stationId, SnapshotFull, at)
+	if err != nil {
+		return nil, fmt.Errorf("查询历史快照失败: %w", err)
+	}
+	if full.IsEmpty() {
+		return nil, ErrNoSnapshot
+	}
+
+	res := &OverviewAtResult{
+		StationId:    stationId,
+		ModelVersion: full["model_version"].Int64(),
+		CapturedAt:   full["captured_at"].Time(),
+	}
+
+	rows, err := db.PgDB.GetAll(ctx, `SELECT captured_at, content FROM `+OverviewSnapshotTable+`
+		WHERE station_id = ? AND kind = ? AND id > ? AND captured_at <= ? ORDER BY id`,
+		stationId, SnapshotDelta, full["id"].Int64(), at)
+	if err != nil {
+		return nil, fmt.Errorf("查询历史增量失败: %w", err)
+	}
+	deltas := make([]string, 0, len(rows))
+	for _, row := range rows {
+		deltas = append(deltas, row["content"].String())
+		res.CapturedAt = row["captured_at"].Time()
+	}
+	if res.Content, err = rebuildOverview(full["content"].String(), deltas); err != nil {
+		return nil, err
+	}
+	res.Deltas = len(deltas)
+	return res, nil
+}
+
+// rebuildOverview 在完整快照上依次应用增量，full 和 deltas 为表中存的 JSON
+func rebuildOverview(full string, deltas []string) (map[string]interface{}, error) {
+	var content map[string]interface{}
+	if err := json.Unmarshal([]byte(full), &content); err != nil {
+		return nil, fmt.Errorf("解析完整快照失败: %w", err)
+	}
+	for _, delta := range deltas {
+		var ops []PatchOp
+		if err := json.Unmarshal([]byte(delta), &ops); err != nil {
+			return nil, fmt.Errorf("解析历史增量失败: %w", err)
+		}
+		if err := ApplyPatch(content, ops); err != nil {
+			return nil, fmt.Errorf("应用历史增量失败: %w", err)
+		}
+	}
+	return content, nil
+}
+
+// ParseSnapshotTime 解析 at 参数：秒或毫秒时间戳，或者 2006-01-02 15:04:05、RFC3339 等常见格式
+func ParseSnapshotTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	t, err := gtime.StrToTime(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无法解析时间 %s: %w", s, err)
+	}
+	return t.Time, nil
+}
+
+// ProjectWire 在旧版输出结构上只保留名称在 names 中的普通值（不区分大小写），子节点保留
+func ProjectWire(content map[string]interface{}, names []string) map[string]interface{} {
+	if len(names) == 0 {
+		return content
+	}
+	keep := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		keep[strings.ToLower(name)] = struct{}{}
+	}
+	var project func(m map[string]interface{}) map[string]interface{}
+	project = func(m map[string]interface{}) map[string]interface{} {
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			if sub, ok := v.(map[string]interface{}); ok {
+				out[k] = project(sub)
+				continue
+			}
+			if _, ok := keep[strings.ToLower(k)]; ok {
+				out[k] = v
+			}
+		}
+		return out
+	}
+	return project(content)
+}
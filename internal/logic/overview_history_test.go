@@ -0,0 +1,191 @@
+package logic
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// historyRow 模拟 overview_snapshot 表中的一行
+type historyRow struct {
+	kind       string
+	capturedAt time.Time
+	content    string
+}
+
+// captureHistory 按 captureOverviewHistory 的方式把几版总览存成完整快照和增量，fullAt 为存完整快照的下标
+func captureHistory(t *testing.T, start time.Time, versions []map[string]interface{}, fullAt map[int]bool) []historyRow {
+	t.Helper()
+	var rows []historyRow
+	var prev map[string]interface{}
+	for i, v := range versions {
+		var (
+			kind    string
+			payload interface{}
+		)
+		if prev == nil || fullAt[i] {
+			kind, payload = SnapshotFull, v
+		} else {
+			ops := DiffOverview(prev, v)
+			if len(ops) == 0 {
+				continue
+			}
+			kind, payload = SnapshotDelta, ops
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("序列化第 %d 版失败: %v", i, err)
+		}
+		rows = append(rows, historyRow{kind: kind, capturedAt: start.Add(time.Duration(i) * time.Minute), content: string(data)})
+		prev = v
+	}
+	return rows
+}
+
+// rebuildAt 按 OverviewAt 的方式取 at 之前最近的完整快照和之后的增量重建
+func rebuildAt(t *testing.T, rows []historyRow, at time.Time) map[string]interface{} {
+	t.Helper()
+	base := -1
+	for i, r := range rows {
+		if r.kind == SnapshotFull && !r.capturedAt.After(at) {
+			base = i
+		}
+	}
+	if base < 0 {
+		t.Fatalf("%s 之前没有完整快照", at.Format(time.TimeOnly))
+	}
+	var deltas []string
+	for _, r := range rows[base+1:] {
+		if r.kind == SnapshotDelta && !r.capturedAt.After(at) {
+			deltas = append(deltas, r.content)
+		}
+	}
+	content, err := rebuildOverview(rows[base].content, deltas)
+	if err != nil {
+		t.Fatalf("重建 %s 的总览失败: %v", at.Format(time.TimeOnly), err)
+	}
+	return content
+}
+
+// jsonRoundTrip 总览存到表里再读出来后的样子（数字变成 float64）
+func jsonRoundTrip(t *testing.T, v map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func historyVersions() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"发射机": map[string]interface{}{
+				"1号机": map[string]interface{}{"Power": 10, "Status": "运行", "a/b~c": 1},
+				"2号机": map[string]interface{}{"Power": 9},
+			},
+			"alarms": []interface{}{"A1"},
+		},
+		{
+			"发射机": map[string]interface{}{
+				"1号机": map[string]interface{}{"Power": 11, "Status": "运行", "a/b~c": 2},
+				"2号机": map[string]interface{}{"Power": 9},
+			},
+			"alarms": []interface{}{"A1"},
+		},
+		{
+			"发射机": map[string]interface{}{
+				"1号机": map[string]interface{}{"Power": 11, "Status": nil, "a/b~c": 2},
+				"3号机": map[string]interface{}{"Power": 8},
+			},
+			"alarms": []interface{}{"A1", "A2"},
+		},
+		{
+			"发射机": map[string]interface{}{
+				"1号机": map[string]interface{}{"Power": 11, "Status": nil, "a/b~c": 2},
+				"3号机": map[string]interface{}{"Power": 8},
+			},
+			"alarms": []interface{}{"A1", "A2"},
+		},
+		{
+			"发射机": map[string]interface{}{
+				"1号机": map[string]interface{}{"Power": 12, "Status": "停机"},
+				"3号机": map[string]interface{}{"Power": 8},
+			},
+			"alarms": []interface{}{},
+		},
+	}
+}
+
+func TestRebuildOverviewHistory(t *testing.T) {
+	start := time.Date(2026, 5, 1, 8, 0, 0, 0, time.Local)
+	versions := historyVersions()
+	rows := captureHistory(t, start, versions, nil)
+	if len(rows) != 4 || rows[0].kind != SnapshotFull {
+		t.Fatalf("应存 1 个完整快照和 3 个增量（第 3 版没有变化不存），得到 %+v", rows)
+	}
+
+	for i, v := range versions {
+		at := start.Add(time.Duration(i) * time.Minute)
+		if got, want := rebuildAt(t, rows, at), jsonRoundTrip(t, v); !reflect.DeepEqual(got, want) {
+			t.Errorf("第 %d 版重建结果为 %v\n期望 %v", i, got, want)
+		}
+	}
+
+	if _, err := rebuildOverview(`{`, nil); err == nil {
+		t.Error("完整快照格式错误时应返回错误")
+	}
+	if _, err := rebuildOverview(rows[0].content, []string{`[{"op":"remove","path":"/不存在/1号机"}]`}); err == nil {
+		t.Error("增量路径不存在时应返回错误")
+	}
+}
+
+func TestOverviewPurgeBefore(t *testing.T) {
+	start := time.Date(2026, 5, 1, 8, 0, 0, 0, time.Local)
+	versions := historyVersions()
+	// 第 0、2、4 版存完整快照
+	rows := captureHistory(t, start, versions, map[int]bool{2: true, 4: true})
+	minute := func(i int) time.Time { return start.Add(time.Duration(i) * time.Minute) }
+
+	var metas []snapshotMeta
+	for _, r := range rows {
+		metas = append(metas, snapshotMeta{StationId: "0101", Kind: r.kind, CapturedAt: r.capturedAt})
+	}
+	// 0102 截止时间之前只有增量，0103 的完整快照都在截止时间之后
+	metas = append(metas,
+		snapshotMeta{StationId: "0102", Kind: SnapshotDelta, CapturedAt: minute(1)},
+		snapshotMeta{StationId: "0103", Kind: SnapshotFull, CapturedAt: minute(4)},
+	)
+
+	cutoff := minute(3)
+	bases := overviewPurgeBefore(metas, cutoff)
+	if want := map[string]time.Time{"0101": minute(2)}; !reflect.DeepEqual(bases, want) {
+		t.Fatalf("删除界限为 %v，期望 %v", bases, want)
+	}
+
+	// 删除基准完整快照之前的记录后，截止时间及之后的总览仍能重建
+	var kept []historyRow
+	for _, r := range rows {
+		if !r.capturedAt.Before(bases["0101"]) {
+			kept = append(kept, r)
+		}
+	}
+	if kept[0].kind != SnapshotFull || !kept[0].capturedAt.Equal(minute(2)) {
+		t.Fatalf("应保留截止时间之前最新的完整快照，保留了 %+v", kept)
+	}
+	for i := 2; i < len(versions); i++ {
+		if got, want := rebuildAt(t, kept, minute(i)), jsonRoundTrip(t, versions[i]); !reflect.DeepEqual(got, want) {
+			t.Errorf("清理后第 %d 版重建结果为 %v\n期望 %v", i, got, want)
+		}
+	}
+
+	// 截止时间正好是完整快照的采集时间时以它为基准
+	if bases := overviewPurgeBefore(metas, minute(2)); !bases["0101"].Equal(minute(2)) {
+		t.Errorf("截止时间等于完整快照时间时界限为 %v", bases)
+	}
+}
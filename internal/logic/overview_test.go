@@ -0,0 +1,125 @@
+package logic
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOverviewETag(t *testing.T) {
+	cache := &ModelCache{Fingerprint: 42}
+	basic := map[string]interface{}{"发射机": map[string]interface{}{"name": "1号机"}}
+	idx := map[string]interface{}{"发射机": map[string]interface{}{"positionId": "0101_1"}}
+	data := map[string]map[string]string{
+		DataKey("0101_1"): {"Power": "10", "Status": "1"},
+		DataKey("0101_2"): {"Power": "3"},
+	}
+	base := OverviewETag(cache, basic, idx, data, "0101", "redis", "")
+
+	same := map[string]map[string]string{
+		DataKey("0101_2"): {"Power": "3"},
+		DataKey("0101_1"): {"Status": "1", "Power": "10"},
+	}
+	if got := OverviewETag(cache, basic, idx, same, "0101", "redis", ""); got != base {
+		t.Errorf("内容相同时 ETag 应相同: %s != %s", got, base)
+	}
+
+	changed := []struct {
+		name string
+		etag string
+	}{
+		{"svr_DATA 值变化", OverviewETag(cache, basic, idx, map[string]map[string]string{
+			DataKey("0101_1"): {"Power": "11", "Status": "1"}, DataKey("0101_2"): {"Power": "3"}}, "0101", "redis", "")},
+		{"模型缓存变化", OverviewETag(&ModelCache{Fingerprint: 43}, basic, idx, data, "0101", "redis", "")},
+		{"台站结构变化", OverviewETag(cache, basic, map[string]interface{}{}, data, "0101", "redis", "")},
+		{"请求参数变化", OverviewETag(cache, basic, idx, data, "0101", "redis", "发射机")},
+		{"参数边界不同", OverviewETag(cache, basic, idx, data, "0101r", "edis", "")},
+	}
+	for _, c := range changed {
+		if c.etag == base {
+			t.Errorf("%s时 ETag 应变化", c.name)
+		}
+	}
+}
+
+func TestWatcherKey(t *testing.T) {
+	if got := watcherKey("0101", nil); got != "0101" {
+		t.Errorf("整个台站的 key 应为台站ID，得到 %q", got)
+	}
+	if watcherKey("0101", []string{}) != watcherKey("0101", nil) {
+		t.Error("空路径应为整个台站")
+	}
+	keys := map[string]bool{}
+	for _, path := range [][]string{nil, {"发射机"}, {"发射机", "1号机"}, {"发射机1号机"}} {
+		keys[watcherKey("0101", path)] = true
+	}
+	if len(keys) != 4 {
+		t.Errorf("不同子树的 key 应不同，得到 %v", keys)
+	}
+}
+
+func TestSubscriberDropsPatchesInSnapshot(t *testing.T) {
+	w := &stationWatcher{stationId: "0101", epoch: 1, version: 2, subs: make(map[*OverviewSubscriber]struct{})}
+	s := &OverviewSubscriber{w: w, resync: true, notify: make(chan struct{}, 1), maxQueue: 8}
+	patch := func(v int64) OverviewEvent {
+		return OverviewEvent{Type: "patch", Epoch: 1, Version: v, BaseVersion: v - 1}
+	}
+
+	// watcher 已经更新到版本 2，版本 2 的增量在快照之后才入队
+	events := s.Drain()
+	if len(events) != 1 || events[0].Type != "snapshot" || events[0].Version != 2 {
+		t.Fatalf("应先收到版本 2 的快照，得到 %+v", events)
+	}
+	s.push(patch(2))
+	s.push(patch(3))
+	events = s.Drain()
+	if len(events) != 1 || events[0].Version != 3 {
+		t.Fatalf("快照已包含的增量应丢弃，得到 %+v", events)
+	}
+
+	// 已入队的增量在 Snapshot 之后取出时也要丢弃
+	s.push(patch(4))
+	w.version = 4
+	if snap := s.Snapshot(); snap.Version != 4 {
+		t.Fatalf("快照版本应为 4，得到 %d", snap.Version)
+	}
+	s.push(patch(5))
+	events = s.Drain()
+	if len(events) != 1 || events[0].Version != 5 {
+		t.Fatalf("应只剩版本 5 的增量，得到 %+v", events)
+	}
+}
+
+func TestPatchOpJSON(t *testing.T) {
+	ops := []PatchOp{
+		{Op: "replace", Path: "/发射机/Status", Value: nil},
+		{Op: "add", Path: "/发射机/Power", Value: 0},
+		{Op: "replace", Path: "/发射机/Mode", Value: ""},
+		{Op: "remove", Path: "/发射机/Reflect"},
+	}
+	data, err := json.Marshal(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"op":"replace","path":"/发射机/Status","value":null},{"op":"add","path":"/发射机/Power","value":0},` +
+		`{"op":"replace","path":"/发射机/Mode","value":""},{"op":"remove","path":"/发射机/Reflect"}]`
+	if string(data) != want {
+		t.Errorf("序列化结果为 %s\n期望 %s", data, want)
+	}
+
+	// 读回后值为 null 的 replace 应用后 key 仍然存在，值为 nil
+	var decoded []PatchOp
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	content := map[string]interface{}{"发射机": map[string]interface{}{"Status": "运行", "Reflect": 1.0}}
+	if err := ApplyPatch(content, decoded); err != nil {
+		t.Fatal(err)
+	}
+	tx := content["发射机"].(map[string]interface{})
+	if v, ok := tx["Status"]; !ok || v != nil {
+		t.Errorf("Status 应为 null，得到 %v（存在 %v）", v, ok)
+	}
+	if _, ok := tx["Reflect"]; ok {
+		t.Error("Reflect 应被删除")
+	}
+}
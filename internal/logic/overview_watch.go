@@ -0,0 +1,547 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 台站总览的实时推送：每个被订阅的台站（或台站中的一个子树）有一个 watcher，
+// 定时或者收到 svr_DATA_* 的 keyspace 通知时重新构造总览，和上一版比较后把变化以 JSON Patch 的形式推给订阅者。
+// 订阅子树时 watcher 只构造该子树、只加载子树内工位号的 svr_DATA_*，JSON Patch 的路径相对于子树。
+
+// PatchOp JSON Patch（RFC 6902）风格的一条变更，path 为 JSON Pointer
+type PatchOp struct {
+	Op    string      `json:"op"` // add / remove / replace
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON remove 不输出 value；add/replace 总是输出 value，值为 null 时也输出
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	type plain PatchOp
+	return json.Marshal(plain(op))
+}
+
+// OverviewEvent 推送给订阅者的一条消息
+type OverviewEvent struct {
+	Type        string                 `json:"type"` // snapshot：全量；patch：增量
+	StationId   string                 `json:"stationId"`
+	Path        string                 `json:"path,omitempty"` // 订阅的子树路径，为空表示整个台站
+	Epoch       int64                  `json:"epoch"`          // watcher 的启动标识，服务重启或 watcher 重建后会变，此时版本号重新计数
+	Version     int64                  `json:"version"`
+	BaseVersion int64                  `json:"baseVersion,omitempty"` // patch 基于的版本
+	Content     map[string]interface{} `json:"content,omitempty"`
+	Ops         []PatchOp              `json:"ops,omitempty"`
+	Timestamp   string                 `json:"timestamp"`
+}
+
+// OverviewSubscriber 一个订阅者。
+// 推送不会阻塞 watcher：消息先进订阅者自己的队列，队列积压超过上限时清空队列，
+// 改为下次取消息时直接发一份最新的全量快照，慢客户端因此只会丢中间过程，不会拖慢别人。
+type OverviewSubscriber struct {
+	w        *stationWatcher
+	mu       sync.Mutex
+	queue    []OverviewEvent
+	resync   bool
+	snapshot int64 // 最近一次给出的快照版本，不大于它的增量已经包含在快照里
+	closed   bool
+	notify   chan struct{}
+	maxQueue int
+}
+
+// Notify 有新消息时收到信号
+func (s *OverviewSubscriber) Notify() <-chan struct{} {
+	return s.notify
+}
+
+// Drain 取出当前积压的全部消息。需要重新同步时返回一份最新快照。
+func (s *OverviewSubscriber) Drain() []OverviewEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := s.queue
+	s.queue = nil
+	if s.resync {
+		s.resync = false
+		return []OverviewEvent{s.takeSnapshotLocked()}
+	}
+	// 快照之前生成、快照之后才入队的增量已经包含在快照里，丢掉
+	kept := events[:0]
+	for _, ev := range events {
+		if ev.Version > s.snapshot {
+			kept = append(kept, ev)
+		}
+	}
+	return kept
+}
+
+// Snapshot 当前版本的全量数据。Content 发布后不会再被修改，可以直接只读使用。
+func (s *OverviewSubscriber) Snapshot() OverviewEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.takeSnapshotLocked()
+}
+
+// takeSnapshotLocked 取快照并记下版本号。watcher 先更新版本再推送增量，
+// 所以快照可能已经包含还没入队的增量，之后按版本号丢弃。调用方持有 s.mu。
+func (s *OverviewSubscriber) takeSnapshotLocked() OverviewEvent {
+	snap := s.w.snapshot()
+	if snap.Version > s.snapshot {
+		s.snapshot = snap.Version
+	}
+	return snap
+}
+
+// Close 取消订阅
+func (s *OverviewSubscriber) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+	s.w.removeSubscriber(s)
+}
+
+// push 由 watcher 调用，非阻塞
+func (s *OverviewSubscriber) push(ev OverviewEvent) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if s.resync || ev.Version <= s.snapshot {
+		// 已经要发全量了，或者增量已经包含在发出的快照里
+	} else if len(s.queue) >= s.maxQueue {
+		s.queue = nil
+		s.resync = true
+	} else {
+		s.queue = append(s.queue, ev)
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// stationWatcher 单个台站（或子树）的总览监视器
+type stationWatcher struct {
+	key       string // hub 中的 key，见 watcherKey
+	stationId string
+	path      []string
+	epoch     int64
+
+	mu       sync.RWMutex
+	version  int64
+	content  map[string]interface{}
+	history  []OverviewEvent     // 最近的增量，用于断线重连时补发
+	keys     map[string]struct{} // 参与合并的 svr_DATA key
+	subs     map[*OverviewSubscriber]struct{}
+	idleFrom time.Time // 最后一个订阅者离开的时间
+	stopped  bool
+
+	trigger chan struct{}
+	cancel  context.CancelFunc
+}
+
+type overviewHub struct {
+	mu           sync.Mutex
+	watchers     map[string]*stationWatcher
+	keyspaceOnce sync.Once
+}
+
+var overviewWatchHub = &overviewHub{watchers: make(map[string]*stationWatcher)}
+
+// SubscribeOverview 订阅一个台站的总览变化。
+// since/epoch 为客户端上次收到的版本号和 epoch：能从历史增量中补齐时只补发增量，否则先发一份全量快照。
+// since 传 0 表示首次连接。
+func SubscribeOverview(ctx context.Context, stationId string, since, epoch int64) (*OverviewSubscriber, error) {
+	return SubscribeOverviewPath(ctx, stationId, nil, since, epoch)
+}
+
+// SubscribeOverviewPath 订阅台站中一个子树的变化，path 为空时与 SubscribeOverview 相同。
+// 快照的 Content 为子树节点（与 ProgramSystemDataSubscribe 的 Content 相同），路径不存在时返回错误。
+func SubscribeOverviewPath(ctx context.Context, stationId string, path []string, since, epoch int64) (*OverviewSubscriber, error) {
+	maxQueue := g.Cfg().MustGet(ctx, "overview.watch.subscriberQueue", 32).Int()
+	if maxQueue <= 0 {
+		maxQueue = 32
+	}
+
+	var sub *OverviewSubscriber
+	for sub == nil {
+		w, err := overviewWatchHub.watcher(ctx, stationId, path)
+		if err != nil {
+			return nil, err
+		}
+
+		w.mu.Lock()
+		if w.stopped {
+			// 刚好空闲退出了，重新取一个
+			w.mu.Unlock()
+			continue
+		}
+		sub = &OverviewSubscriber{
+			w:        w,
+			notify:   make(chan struct{}, 1),
+			maxQueue: maxQueue,
+		}
+		if initial := w.catchUpLocked(since, epoch); initial == nil {
+			sub.resync = true
+		} else {
+			sub.queue = initial
+		}
+		w.subs[sub] = struct{}{}
+		w.mu.Unlock()
+	}
+
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+	return sub, nil
+}
+
+// watcherKey 台站为 stationId，子树为 stationId 加路径
+func watcherKey(stationId string, path []string) string {
+	if len(path) == 0 {
+		return stationId
+	}
+	return stationId + "\x00" + strings.Join(path, "/")
+}
+
+// watcher 取台站（或子树）的 watcher，没有就创建并同步构造第一版
+func (h *overviewHub) watcher(ctx context.Context, stationId string, path []string) (*stationWatcher, error) {
+	key := watcherKey(stationId, path)
+	h.mu.Lock()
+	w, ok := h.watchers[key]
+	h.mu.Unlock()
+	if ok {
+		return w, nil
+	}
+
+	content, nums, err := buildWatchContent(ctx, stationId, path)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// 并发创建时以先放进去的为准
+	if w, ok := h.watchers[key]; ok {
+		return w, nil
+	}
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	w = &stationWatcher{
+		key:       key,
+		stationId: stationId,
+		path:      path,
+		epoch:     time.Now().UnixNano(),
+		version:   1,
+		content:   content,
+		keys:      dataKeySet(nums),
+		subs:      make(map[*OverviewSubscriber]struct{}),
+		idleFrom:  time.Now(),
+		trigger:   make(chan struct{}, 1),
+		cancel:    cancel,
+	}
+	h.watchers[key] = w
+	h.keyspaceOnce.Do(func() {
+		go h.watchDataKeyspace(context.Background())
+	})
+	go w.run(loopCtx)
+	return w, nil
+}
+
+// removeIfIdle 没有订阅者且空闲超时时把 watcher 从 hub 中摘掉，返回是否已摘掉
+func (h *overviewHub) removeIfIdle(w *stationWatcher, idleTimeout time.Duration) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.subs) > 0 || time.Since(w.idleFrom) <= idleTimeout {
+		return false
+	}
+	w.stopped = true
+	if h.watchers[w.key] == w {
+		delete(h.watchers, w.key)
+	}
+	w.cancel()
+	return true
+}
+
+// watchDataKeyspace 订阅 svr_DATA_* 的 keyspace 通知，通知到包含该 key 的台站尽快刷新。
+// redis 没开 notify-keyspace-events 时收不到任何消息，只靠定时刷新。
+func (h *overviewHub) watchDataKeyspace(ctx context.Context) {
+	dbIndex := g.Cfg().MustGet(ctx, "redis.default.db").Int()
+	prefix := fmt.Sprintf("__keyspace@%d__:", dbIndex)
+	pubsub := db.Redis.PSubscribe(ctx, prefix+DataKeyPrefix+"*")
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		key := strings.TrimPrefix(msg.Channel, prefix)
+
+		h.mu.Lock()
+		for _, w := range h.watchers {
+			w.mu.RLock()
+			_, hit := w.keys[key]
+			w.mu.RUnlock()
+			if hit {
+				select {
+				case w.trigger <- struct{}{}:
+				default:
+				}
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// run watcher 的刷新循环。
+// 定时刷新间隔 overview.watch.interval（默认5s），两次刷新至少间隔 overview.watch.minInterval（默认500ms），
+// 没有订阅者超过 overview.watch.idleTimeout（默认1m）后自动退出。
+func (w *stationWatcher) run(ctx context.Context) {
+	interval := g.Cfg().MustGet(ctx, "overview.watch.interval", "5s").Duration()
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	minInterval := g.Cfg().MustGet(ctx, "overview.watch.minInterval", "500ms").Duration()
+	idleTimeout := g.Cfg().MustGet(ctx, "overview.watch.idleTimeout", "1m").Duration()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if overviewWatchHub.removeIfIdle(w, idleTimeout) {
+				return
+			}
+		case <-w.trigger:
+		}
+
+		w.refresh(ctx)
+
+		if minInterval > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(minInterval):
+			}
+		}
+	}
+}
+
+// buildWatchContent 构造 watcher 的内容：整个台站的总览，或者只构造 path 对应的子树
+func buildWatchContent(ctx context.Context, stationId string, path []string) (map[string]interface{}, []string, error) {
+	if len(path) == 0 {
+		return BuildOverview(ctx, stationId)
+	}
+	node, err := BuildStationSubtree(ctx, stationId, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return node.WireMap(), TreeDataNums(node), nil
+}
+
+// refresh 重新构造总览，有变化时生成新版本并推送增量
+func (w *stationWatcher) refresh(ctx context.Context) {
+	content, nums, err := buildWatchContent(ctx, w.stationId, w.path)
+	if err != nil {
+		g.Log().Warningf(ctx, "刷新台站 %s 总览 %s 失败: %v", w.stationId, strings.Join(w.path, "/"), err)
+		return
+	}
+
+	w.mu.Lock()
+	ops := DiffOverview(w.content, content)
+	w.keys = dataKeySet(nums)
+	if len(ops) == 0 {
+		w.mu.Unlock()
+		return
+	}
+
+	w.version++
+	w.content = content
+	ev := OverviewEvent{
+		Type:        "patch",
+		StationId:   w.stationId,
+		Path:        strings.Join(w.path, "/"),
+		Epoch:       w.epoch,
+		Version:     w.version,
+		BaseVersion: w.version - 1,
+		Ops:         ops,
+		Timestamp:   time.Now().Format("2006-01-02 15:04:05"),
+	}
+	historySize := g.Cfg().MustGet(ctx, "overview.watch.historySize", 100).Int()
+	w.history = append(w.history, ev)
+	if historySize > 0 && len(w.history) > historySize {
+		w.history = w.history[len(w.history)-historySize:]
+	}
+	subs := make([]*OverviewSubscriber, 0, len(w.subs))
+	for s := range w.subs {
+		subs = append(subs, s)
+	}
+	w.mu.Unlock()
+
+	for _, s := range subs {
+		s.push(ev)
+	}
+}
+
+// catchUpLocked 计算重连时要补发的消息；返回 nil 表示需要全量快照。调用方持有 w.mu。
+func (w *stationWatcher) catchUpLocked(since, epoch int64) []OverviewEvent {
+	if since <= 0 || epoch != w.epoch || since > w.version {
+		return nil
+	}
+	if since == w.version {
+		return []OverviewEvent{}
+	}
+	for i, ev := range w.history {
+		if ev.BaseVersion == since {
+			events := make([]OverviewEvent, len(w.history)-i)
+			copy(events, w.history[i:])
+			return events
+		}
+	}
+	return nil
+}
+
+// snapshot 当前版本的全量消息
+func (w *stationWatcher) snapshot() OverviewEvent {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return OverviewEvent{
+		Type:      "snapshot",
+		StationId: w.stationId,
+		Path:      strings.Join(w.path, "/"),
+		Epoch:     w.epoch,
+		Version:   w.version,
+		Content:   w.content,
+		Timestamp: time.Now().Format("2006-01-02 15:04:05"),
+	}
+}
+
+func (w *stationWatcher) removeSubscriber(s *OverviewSubscriber) {
+	w.mu.Lock()
+	delete(w.subs, s)
+	if len(w.subs) == 0 {
+		w.idleFrom = time.Now()
+	}
+	w.mu.Unlock()
+}
+
+func dataKeySet(nums []string) map[string]struct{} {
+	keys := make(map[string]struct{}, len(nums))
+	for _, num := range nums {
+		keys[DataKey(num)] = struct{}{}
+	}
+	return keys
+}
+
+// DiffOverview 比较两版总览，返回把 oldM 变成 newM 的 JSON Patch。
+// 对象逐层比较，其他值（包括数组）整体替换；按 key 排序输出，结果稳定。
+func DiffOverview(oldM, newM map[string]interface{}) []PatchOp {
+	var ops []PatchOp
+	diffObject("", oldM, newM, &ops)
+	return ops
+}
+
+func diffObject(prefix string, oldM, newM map[string]interface{}, ops *[]PatchOp) {
+	keys := make([]string, 0, len(oldM)+len(newM))
+	for k := range oldM {
+		keys = append(keys, k)
+	}
+	for k := range newM {
+		if _, ok := oldM[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := prefix + "/" + EscapePointer(k)
+		oldV, inOld := oldM[k]
+		newV, inNew := newM[k]
+		switch {
+		case !inNew:
+			*ops = append(*ops, PatchOp{Op: "remove", Path: path})
+		case !inOld:
+			*ops = append(*ops, PatchOp{Op: "add", Path: path, Value: newV})
+		default:
+			oldSub, oldIsMap := oldV.(map[string]interface{})
+			newSub, newIsMap := newV.(map[string]interface{})
+			if oldIsMap && newIsMap {
+				diffObject(path, oldSub, newSub, ops)
+			} else if !reflect.DeepEqual(oldV, newV) {
+				*ops = append(*ops, PatchOp{Op: "replace", Path: path, Value: newV})
+			}
+		}
+	}
+}
+
+// ApplyPatch 把 DiffOverview 生成的 add/remove/replace 应用到 content 上（原地修改）
+func ApplyPatch(content map[string]interface{}, ops []PatchOp) error {
+	for _, op := range ops {
+		if !strings.HasPrefix(op.Path, "/") {
+			return fmt.Errorf("无效的路径 %q", op.Path)
+		}
+		parts := strings.Split(op.Path[1:], "/")
+		parent := content
+		for _, p := range parts[:len(parts)-1] {
+			sub, ok := parent[UnescapePointer(p)].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("路径 %s 的上级节点不存在", op.Path)
+			}
+			parent = sub
+		}
+		key := UnescapePointer(parts[len(parts)-1])
+		switch op.Op {
+		case "add", "replace":
+			parent[key] = op.Value
+		case "remove":
+			delete(parent, key)
+		default:
+			return fmt.Errorf("不支持的操作 %s", op.Op)
+		}
+	}
+	return nil
+}
+
+// UnescapePointer EscapePointer 的逆操作
+func UnescapePointer(s string) string {
+	if !strings.Contains(s, "~") {
+		return s
+	}
+	s = strings.ReplaceAll(s, "~1", "/")
+	return strings.ReplaceAll(s, "~0", "~")
+}
+
+// EscapePointer 按 JSON Pointer 规则转义一段路径：~ → ~0，/ → ~1
+func EscapePointer(s string) string {
+	if !strings.ContainsAny(s, "~/") {
+		return s
+	}
+	s = strings.ReplaceAll(s, "~", "~0")
+	return strings.ReplaceAll(s, "/", "~1")
+}
@@ -0,0 +1,132 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	"gf_api/internal/db"
+
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// 数据库 station_node 表是台站模型的源头，模型发布任务把它转换成 redis 中的 svr_stationNodeModelBasic/Idx。
+// redis 中还没有某个台站的模型时，总览直接从这张表搭出同样结构的 Idx。
+
+// 台站模型来源
+const (
+	ModelSourceRedis       = "redis"        // svr_stationNodeModelBasic / svr_stationNodeModelIdx
+	ModelSourceStationNode = "station_node" // 数据库 station_node 表
+)
+
+// stationNodeRow station_node 表中的一行
+type stationNodeRow struct {
+	NodeId             int
+	ParentNodeId       int
+	NodeName           string
+	PositionId         string
+	RelationPositionId string
+	DynamicModelId     string
+	StaticModelId      string
+	SetitemModelId     string
+	OperateModelId     string
+}
+
+// LoadStationNodes 按 node_id 顺序读取一个台站在 station_node 表中的所有节点
+func LoadStationNodes(ctx context.Context, stationId string) ([]*stationNodeRow, error) {
+	if db.PgDB == nil {
+		return nil, fmt.Errorf("数据库未初始化，无法读取 station_node")
+	}
+	sql := `SELECT node_id, parent_node_id, node_name, position_id, relation_position_id, dynamic_model_id, static_model_id, setitem_model_id, operate_model_id
+		FROM station_node WHERE station_id = ? ORDER BY node_id`
+	res, err := db.PgDB.Query(ctx, sql, stationId)
+	if err != nil {
+		return nil, fmt.Errorf("查询 station_node 失败: %w", err)
+	}
+
+	rows := make([]*stationNodeRow, 0, len(res))
+	for _, row := range res {
+		rows = append(rows, &stationNodeRow{
+			NodeId:             gconv.Int(row["node_id"]),
+			ParentNodeId:       gconv.Int(row["parent_node_id"]),
+			NodeName:           gconv.String(row["node_name"]),
+			PositionId:         gconv.String(row["position_id"]),
+			RelationPositionId: gconv.String(row["relation_position_id"]),
+			DynamicModelId:     gconv.String(row["dynamic_model_id"]),
+			StaticModelId:      gconv.String(row["static_model_id"]),
+			SetitemModelId:     gconv.String(row["setitem_model_id"]),
+			OperateModelId:     gconv.String(row["operate_model_id"]),
+		})
+	}
+	return rows, nil
+}
+
+// indexStationNodes 按 node_id 建索引，返回 父节点 -> 子节点（按 node_id 顺序）和根节点。
+// 和 GetOverViewDataOld 一样以 node_id 最小的节点为根。
+func indexStationNodes(rows []*stationNodeRow) (nodes map[int]*stationNodeRow, children map[int][]int, rootId int) {
+	nodes = make(map[int]*stationNodeRow, len(rows))
+	children = make(map[int][]int)
+	for i, n := range rows {
+		nodes[n.NodeId] = n
+		children[n.ParentNodeId] = append(children[n.ParentNodeId], n.NodeId)
+		if i == 0 || n.NodeId < rootId {
+			rootId = n.NodeId
+		}
+	}
+	return nodes, children, rootId
+}
+
+// walkStationNodes 从根节点按层遍历，每个可达节点只访问一次，fn 先于该节点的子节点调用。
+// 父节点成环或父节点不存在的节点不可达，不会被访问。
+func walkStationNodes(nodes map[int]*stationNodeRow, children map[int][]int, rootId int, fn func(id, parentId int)) {
+	visited := map[int]bool{rootId: true}
+	fn(rootId, 0)
+	queue := []int{rootId}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, childId := range children[id] {
+			if visited[childId] {
+				continue
+			}
+			visited[childId] = true
+			fn(childId, id)
+			queue = append(queue, childId)
+		}
+	}
+}
+
+// BuildIdxFromStationNodes 用 station_node 的行搭出和 svr_stationNodeModelIdx 相同结构的 Idx：
+// 根节点的字段在第一层，子节点以 node_name 为 key 嵌套，同名子节点 node_id 大的覆盖小的。
+// 返回从根到不了（父节点成环或不存在）而被丢弃的节点数。
+func BuildIdxFromStationNodes(rows []*stationNodeRow) (idx map[string]interface{}, dropped int) {
+	idx = make(map[string]interface{})
+	if len(rows) == 0 {
+		return idx, 0
+	}
+	nodes, children, rootId := indexStationNodes(rows)
+
+	maps := make(map[int]map[string]interface{}, len(nodes))
+	walkStationNodes(nodes, children, rootId, func(id, parentId int) {
+		m := idx
+		if id != rootId {
+			m = make(map[string]interface{})
+			maps[parentId][nodes[id].NodeName] = m
+		}
+		maps[id] = m
+
+		n := nodes[id]
+		for k, v := range map[string]string{
+			"positionId":       n.PositionId,
+			"rPositionId":      n.RelationPositionId,
+			"dynamic_model_id": n.DynamicModelId,
+			"static_model_id":  n.StaticModelId,
+			"setitem_model_id": n.SetitemModelId,
+			"operate_model_id": n.OperateModelId,
+		} {
+			if v != "" {
+				m[k] = v
+			}
+		}
+	})
+	return idx, len(nodes) - len(maps)
+}
@@ -0,0 +1,82 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildIdxFromStationNodes(t *testing.T) {
+	rows := []*stationNodeRow{
+		{NodeId: 1, ParentNodeId: 0, NodeName: "一号台", PositionId: "0101"},
+		{NodeId: 2, ParentNodeId: 1, NodeName: "发射机"},
+		{NodeId: 3, ParentNodeId: 2, NodeName: "1号机", PositionId: "0101_01", RelationPositionId: "0101_09", DynamicModelId: "tx"},
+		{NodeId: 4, ParentNodeId: 2, NodeName: "1号机", PositionId: "0101_02", DynamicModelId: "tx", StaticModelId: "txs"}, // 同名，node_id 大的覆盖
+		{NodeId: 5, ParentNodeId: 4, NodeName: "风机", PositionId: "0101_03", SetitemModelId: "fan", OperateModelId: "op"},
+		{NodeId: 6, ParentNodeId: 7, NodeName: "环A"}, // 6 和 7 互为父节点，从根到不了
+		{NodeId: 7, ParentNodeId: 6, NodeName: "环B"},
+		{NodeId: 8, ParentNodeId: 8, NodeName: "自环"},
+		{NodeId: 9, ParentNodeId: 99, NodeName: "孤儿"}, // 父节点不存在
+		{NodeId: 10, ParentNodeId: 9, NodeName: "孤儿的子节点"},
+	}
+	idx, dropped := BuildIdxFromStationNodes(rows)
+
+	want := map[string]interface{}{
+		"positionId": "0101",
+		"发射机": map[string]interface{}{
+			"1号机": map[string]interface{}{
+				"positionId":       "0101_02",
+				"dynamic_model_id": "tx",
+				"static_model_id":  "txs",
+				"风机": map[string]interface{}{
+					"positionId":       "0101_03",
+					"setitem_model_id": "fan",
+					"operate_model_id": "op",
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(idx, want) {
+		t.Errorf("Idx 为 %v\n期望 %v", idx, want)
+	}
+	if dropped != 5 {
+		t.Errorf("应丢弃成环和父节点不存在的 5 个节点，实际 %d", dropped)
+	}
+}
+
+func TestBuildIdxFromStationNodesRoot(t *testing.T) {
+	if idx, dropped := BuildIdxFromStationNodes(nil); len(idx) != 0 || dropped != 0 {
+		t.Errorf("没有节点时应返回空 Idx，得到 %v, %d", idx, dropped)
+	}
+
+	// 以 node_id 最小的节点为根，和行的顺序无关
+	rows := []*stationNodeRow{
+		{NodeId: 5, ParentNodeId: 2, NodeName: "发射机", PositionId: "0101_01"},
+		{NodeId: 2, ParentNodeId: 0, NodeName: "一号台", PositionId: "0101"},
+	}
+	idx, dropped := BuildIdxFromStationNodes(rows)
+	want := map[string]interface{}{
+		"positionId": "0101",
+		"发射机":        map[string]interface{}{"positionId": "0101_01"},
+	}
+	if !reflect.DeepEqual(idx, want) || dropped != 0 {
+		t.Errorf("Idx 为 %v（丢弃 %d）\n期望 %v", idx, dropped, want)
+	}
+}
+
+func TestWalkStationNodesVisitsOnce(t *testing.T) {
+	rows := []*stationNodeRow{
+		{NodeId: 1, ParentNodeId: 0},
+		{NodeId: 2, ParentNodeId: 1},
+		{NodeId: 3, ParentNodeId: 2},
+		{NodeId: 1, ParentNodeId: 3}, // 根节点又出现在环里
+	}
+	nodes, children, rootId := indexStationNodes(rows)
+	var order [][2]int
+	walkStationNodes(nodes, children, rootId, func(id, parentId int) {
+		order = append(order, [2]int{id, parentId})
+	})
+	want := [][2]int{{1, 0}, {2, 1}, {3, 2}}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("遍历顺序为 %v，期望 %v", order, want)
+	}
+}
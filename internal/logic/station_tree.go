@@ -0,0 +1,229 @@
+package logic
+
+import (
+	"strings"
+
+	"gf_api/internal/model"
+)
+
+// StationTreeBuilder 分步构造台站总览树：
+//  1. NewStationTreeBuilder 根据 Basic/Idx 搭好节点结构，并按模型确定每个属性从哪个 svr_DATA_Num 的哪个字段取值；
+//  2. DataNums 给出需要预加载的工位号；
+//  3. Fill 用预加载好的数据填值。
+//
+// 搭结构时不访问 redis，所以可以先裁剪子树再决定要加载哪些数据。
+type StationTreeBuilder struct {
+	Tree     *model.StationTree
+	pending  []pendingAttribute // 按旧版合并顺序排列，填值时依次挂到节点上
+	resolver *AttributeResolver
+}
+
+type pendingAttribute struct {
+	node *model.Node
+	attr *model.Attribute
+	def  map[string]interface{} // 属性定义，填值时 para_value 回退要用
+}
+
+// NewStationTreeBuilder 合并数据总览的基本属性Basic 和 数据总览的详细属性Idx，搭出节点结构。
+// 规则和原来的 mergeRecursive 一致：Idx 中 rConfig 下的内容合并到所在节点，其他对象为子节点，普通值为节点字段。
+func NewStationTreeBuilder(stationId string, basic, idx map[string]interface{}, cache *ModelCache) *StationTreeBuilder {
+	b := &StationTreeBuilder{
+		Tree: &model.StationTree{
+			StationId:    stationId,
+			ModelVersion: cache.Version,
+			Root:         model.NewNode("", nil),
+		},
+		resolver: cache.Resolver,
+	}
+	b.applyBasic(b.Tree.Root, basic)
+	b.applyIdx(b.Tree.Root, idx, cache)
+	return b
+}
+
+func (b *StationTreeBuilder) applyBasic(n *model.Node, basic map[string]interface{}) {
+	for k, v := range basic {
+		if sub, ok := v.(map[string]interface{}); ok {
+			b.applyBasic(n.Child(k), sub)
+			continue
+		}
+		n.Fields[k] = v
+	}
+}
+
+func (b *StationTreeBuilder) applyIdx(n *model.Node, idx map[string]interface{}, cache *ModelCache) {
+	positionId, _ := idx["positionId"].(string)
+	rPositionId, _ := idx["rPositionId"].(string)
+
+	if id, ok := idx["dynamic_model_id"].(string); ok && id != "" {
+		for attrName, attrDef := range cache.Dynamic[id] {
+			b.add(n, newDataAttribute(b.resolver, model.AttributeDynamic, id, attrName, attrDef, positionId, rPositionId), attrDef)
+		}
+		n.Fields["dynamic_model_id"] = id
+	}
+
+	if id, ok := idx["static_model_id"].(string); ok && id != "" {
+		for attrName, attrDef := range cache.Static[id] {
+			if a := newStaticAttribute(id, attrName, attrDef); a != nil {
+				b.add(n, a, nil)
+			}
+		}
+		n.Fields["static_model_id"] = id
+	}
+
+	if id, ok := idx["setitem_model_id"].(string); ok && id != "" {
+		for attrName, attrDef := range cache.SetItem[id] {
+			b.add(n, newDataAttribute(b.resolver, model.AttributeSetItem, id, attrName, attrDef, positionId, rPositionId), attrDef)
+		}
+		n.Fields["setitem_model_id"] = id
+	}
+
+	for k, v := range idx {
+		if k == "dynamic_model_id" || k == "static_model_id" || k == "setitem_model_id" {
+			continue
+		}
+
+		switch sub := v.(type) {
+		case map[string]interface{}:
+			// 特殊处理 rConfig：跳过节点名，仅合并其子属性
+			if k == "rConfig" {
+				b.applyIdx(n, sub, cache)
+				continue
+			}
+			b.applyIdx(n.Child(k), sub, cache)
+		default:
+			n.Fields[k] = v
+		}
+	}
+}
+
+func (b *StationTreeBuilder) add(n *model.Node, a *model.Attribute, def map[string]interface{}) {
+	b.pending = append(b.pending, pendingAttribute{node: n, attr: a, def: def})
+}
+
+// newDataAttribute 动态属性和设置项属性从 svr_DATA 取值，取值位置由 AttributeResolver 按规则确定
+func newDataAttribute(r *AttributeResolver, kind model.AttributeKind, modelId, attrName string, attrDef map[string]interface{}, positionId, rPositionId string) *model.Attribute {
+	ref := r.Locate(kind, attrDef, positionId, rPositionId)
+	return &model.Attribute{
+		Name:        r.Name(kind, attrName),
+		Kind:        kind,
+		ModelId:     modelId,
+		PositionId:  ref.PositionId,
+		Parno:       ref.Parno,
+		UseRelation: ref.UseRelation,
+		Missing:     true,
+	}
+}
+
+// newStaticAttribute 静态属性，属性定义是对象时取 para_value，对象里没有 para_value 时不输出
+func newStaticAttribute(modelId, attrName string, attrDef interface{}) *model.Attribute {
+	raw := attrDef
+	if attrMap, ok := attrDef.(map[string]interface{}); ok {
+		paraValue, ok := attrMap["para_value"]
+		if !ok {
+			return nil
+		}
+		raw = paraValue
+	}
+	return &model.Attribute{
+		Name:    strings.ToLower(attrName),
+		Kind:    model.AttributeStatic,
+		ModelId: modelId,
+		Raw:     raw,
+		Value:   model.ParseAttributeValue(raw),
+	}
+}
+
+// Select 只保留 path 指定子树内、名称在 attrs 中（attrs 为空表示全部，不区分大小写）的属性，
+// 之后 DataNums 只返回这些属性需要的工位号，子树外的 svr_DATA_* 不会被加载。
+// 返回选中的节点，找不到时返回 nil；Fill 之后需要再对返回的节点调用 Project(attrs) 裁剪普通字段。
+func (b *StationTreeBuilder) Select(path []string, attrs []string) *model.Node {
+	node := b.Tree.Root.Find(path)
+	if node == nil {
+		return nil
+	}
+
+	var keep map[string]struct{}
+	if len(attrs) > 0 {
+		keep = make(map[string]struct{}, len(attrs))
+		for _, name := range attrs {
+			keep[strings.ToLower(name)] = struct{}{}
+		}
+	}
+
+	pending := b.pending[:0]
+	for _, p := range b.pending {
+		if !node.Contains(p.node) {
+			continue
+		}
+		if keep != nil {
+			if _, ok := keep[strings.ToLower(p.attr.Name)]; !ok {
+				continue
+			}
+		}
+		pending = append(pending, p)
+	}
+	b.pending = pending
+	return node
+}
+
+// DataNums 需要预加载的工位号（已去重）
+func (b *StationTreeBuilder) DataNums() []string {
+	seen := make(map[string]struct{})
+	nums := make([]string, 0)
+	for _, p := range b.pending {
+		if p.attr.Kind == model.AttributeStatic || p.attr.PositionId == "" {
+			continue
+		}
+		if _, ok := seen[p.attr.PositionId]; ok {
+			continue
+		}
+		seen[p.attr.PositionId] = struct{}{}
+		nums = append(nums, p.attr.PositionId)
+	}
+	return nums
+}
+
+// Fill 用预加载的 svr_DATA 数据给属性填值并挂到节点上，返回构造好的树。
+// 取值和缺失的判断见 AttributeResolver.Resolve。
+func (b *StationTreeBuilder) Fill(dataCache map[string]map[string]string) *model.StationTree {
+	records := make(map[string]*DataRecord)
+	for _, p := range b.pending {
+		a := p.attr
+		if a.Kind != model.AttributeStatic {
+			key := DataKey(a.PositionId)
+			rec, ok := records[key]
+			if !ok {
+				rec = NewDataRecord(dataCache[key])
+				records[key] = rec
+			}
+			ref := AttributeRef{PositionId: a.PositionId, Parno: a.Parno, UseRelation: a.UseRelation}
+			if raw, ok := b.resolver.Resolve(a.Kind, ref, p.def, rec); ok {
+				a.Raw = raw
+				a.Value = model.ParseAttributeValue(raw)
+				a.Missing = false
+			}
+		}
+		p.node.SetAttribute(a)
+	}
+	b.pending = nil
+	return b.Tree
+}
+
+// TreeDataNums 树上动态和设置项属性取值用到的工位号（已去重）
+func TreeDataNums(root *model.Node) []string {
+	seen := make(map[string]struct{})
+	nums := make([]string, 0)
+	root.Walk(func(n *model.Node) bool {
+		for _, a := range n.Attributes {
+			if a.Kind == model.AttributeStatic || a.PositionId == "" {
+				continue
+			}
+			if _, ok := seen[a.PositionId]; !ok {
+				seen[a.PositionId] = struct{}{}
+				nums = append(nums, a.PositionId)
+			}
+		}
+		return true
+	})
+	return nums
+}
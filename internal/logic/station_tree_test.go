@@ -0,0 +1,152 @@
+package logic
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gf_api/internal/model"
+)
+
+// legacyMerge 旧版总览接口的合并逻辑（controller 中的 mergeRecursive / processDataModelCached / processStaticModelCached），
+// 把逐个 HGETALL 换成从 data 中取，用来检查 WireMap 的输出和旧版一致。basic 和 idx 会被修改。
+func legacyMerge(basic, idx map[string]interface{}, cache *ModelCache, data map[string]map[string]string) {
+	if id, ok := idx["dynamic_model_id"].(string); ok && id != "" {
+		legacyDataModel(idx, model.AttributeDynamic, cache.Dynamic[id], cache.Resolver, data)
+		basic["dynamic_model_id"] = id
+	}
+	if id, ok := idx["static_model_id"].(string); ok && id != "" {
+		for attrName, attrDef := range cache.Static[id] {
+			attrName = strings.ToLower(attrName)
+			if attrMap, ok := attrDef.(map[string]interface{}); ok {
+				if paraValue, ok := attrMap["para_value"]; ok {
+					idx[attrName] = paraValue
+				}
+				continue
+			}
+			idx[attrName] = attrDef
+		}
+		basic["static_model_id"] = id
+	}
+	if id, ok := idx["setitem_model_id"].(string); ok && id != "" {
+		legacyDataModel(idx, model.AttributeSetItem, cache.SetItem[id], cache.Resolver, data)
+		basic["setitem_model_id"] = id
+	}
+
+	for k, v := range idx {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			if k == "rConfig" {
+				legacyMerge(basic, val, cache, data)
+				continue
+			}
+			if _, exists := basic[k]; !exists {
+				basic[k] = make(map[string]interface{})
+			}
+			legacyMerge(basic[k].(map[string]interface{}), val, cache, data)
+		default:
+			if k == "dynamic_model_id" || k == "static_model_id" || k == "setitem_model_id" {
+				continue
+			}
+			basic[k] = v
+		}
+	}
+}
+
+func legacyDataModel(node map[string]interface{}, kind model.AttributeKind, modelDef map[string]map[string]interface{},
+	resolver *AttributeResolver, data map[string]map[string]string) {
+	positionId, _ := node["positionId"].(string)
+	rPositionId, _ := node["rPositionId"].(string)
+	for attrName, attrDef := range modelDef {
+		ref := resolver.Locate(kind, attrDef, positionId, rPositionId)
+		if raw, ok := resolver.Resolve(kind, ref, attrDef, NewDataRecord(data[DataKey(ref.PositionId)])); ok {
+			node[resolver.Name(kind, attrName)] = raw
+		}
+	}
+}
+
+// overviewFixture 一个台站的 Basic、Idx、模型和 svr_DATA，每次调用返回新的副本
+func overviewFixture() (basic, idx map[string]interface{}, cache *ModelCache, data map[string]map[string]string) {
+	decode := func(s string) map[string]interface{} {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			panic(err)
+		}
+		return m
+	}
+	basic = decode(`{
+		"stationName": "一号台",
+		"发射机": {
+			"nodeName": "发射机",
+			"1号机": {"nodeName": "1号机", "power": "basic 中的字段"},
+			"2号机": {"nodeName": "2号机"}
+		},
+		"配电": {"nodeName": "配电"}
+	}`)
+	idx = decode(`{
+		"发射机": {
+			"1号机": {
+				"positionId": "0101_01",
+				"rPositionId": "0101_09",
+				"dynamic_model_id": "tx",
+				"static_model_id": "txs",
+				"fan": {"positionId": "0101_02"}
+			},
+			"2号机": {"rConfig": {"positionId": "0101_03", "dynamic_model_id": "tx", "setitem_model_id": "set"}},
+			"3号机": {"positionId": "0101_04", "dynamic_model_id": "tx"}
+		},
+		"配电": {"positionId": "0101_05", "dynamic_model_id": "ups", "static_model_id": "txs"}
+	}`)
+	cache = &ModelCache{
+		Dynamic: map[string]map[string]map[string]interface{}{
+			"tx": {
+				"Power":   {"parno": "Power", "relation_parno": "RPower"},
+				"Reflect": {"parno": "Reflect"},
+				"fan":     {"parno": "FanState"}, // 和子节点 fan 同名时属性覆盖子节点
+				"Absent":  {"parno": "Absent"},
+			},
+			"ups": {"Voltage": {"parno": "Voltage", "is_enable": "1", "relation_parno": "RV"}},
+		},
+		Static: map[string]map[string]interface{}{
+			"txs": {
+				"Model":  map[string]interface{}{"para_value": "DS-10"},
+				"Vendor": "某厂",
+				"NoPara": map[string]interface{}{"unit": "kW"},
+			},
+		},
+		SetItem: map[string]map[string]map[string]interface{}{
+			"set": {"Target": {"parno": "Target"}},
+		},
+		Resolver: NewAttributeResolver(DefaultResolveRules()),
+	}
+	data = map[string]map[string]string{
+		DataKey("0101_01"): {"Power": "10.5", "Reflect": "NaN", "FanState": "on"},
+		DataKey("0101_09"): {"RPower": "9.8"},
+		DataKey("0101_03"): {"Target": "12"},
+		DataKey("0101_05"): {"Voltage": "220"},
+		// 0101_04 没有数据：3号机的动态属性都不输出
+	}
+	return
+}
+
+func TestWireMapMatchesLegacyMerge(t *testing.T) {
+	basic, idx, cache, data := overviewFixture()
+	legacyMerge(basic, idx, cache, data)
+	want := basic
+
+	basic, idx, cache, data = overviewFixture()
+	b := NewStationTreeBuilder("0101", basic, idx, cache)
+	tree := b.Fill(data)
+	got := tree.Root.WireMap()
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("WireMap 和旧版合并结果不一致\n got: %s\nwant: %s", gotJSON, wantJSON)
+	}
+
+	// 设备上报的 NaN 保持字符串，format=rich 可以正常序列化
+	if _, err := json.Marshal(tree.Root.Rich()); err != nil {
+		t.Errorf("序列化 Rich 失败: %v", err)
+	}
+}
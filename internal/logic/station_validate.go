@@ -0,0 +1,440 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gf_api/internal/db"
+	"gf_api/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// 台站模型一致性检查。
+// 数据错误在总览里只会表现为空字符串或者缺少属性，这里把原因逐条列出来：
+// redis 中的 svr_stationNodeModelBasic/Idx 检查模型ID、parno 和 rPositionId，
+// 数据库 station_node 表检查模型ID、父节点环和同名节点。
+
+// IssueKind 问题类型
+type IssueKind string
+
+const (
+	IssueMissingModel     IssueKind = "missing_model"      // 模型ID在 svr_dynamic_model/svr_static_model/svr_setitem_model 中不存在
+	IssueMissingData      IssueKind = "missing_data"       // 取值的 svr_DATA_* 不存在或为空
+	IssueMissingParno     IssueKind = "missing_parno"      // parno/relation_parno 在 svr_DATA_* 中不存在
+	IssueDanglingRelation IssueKind = "dangling_rposition" // rPositionId 对应的 svr_DATA_* 不存在
+	IssueNodeCycle        IssueKind = "node_cycle"         // station_node 父节点形成环
+	IssueMissingParent    IssueKind = "missing_parent"     // station_node 父节点不存在，节点不会出现在总览中
+	IssueDuplicateName    IssueKind = "duplicate_name"     // 同一父节点下有同名（不区分大小写）的子节点
+)
+
+// 问题来源
+const (
+	IssueSourceRedis       = "redis"
+	IssueSourceStationNode = "station_node"
+)
+
+// ValidationIssue 一条检查结果
+type ValidationIssue struct {
+	Kind       IssueKind `json:"kind"`
+	Source     string    `json:"source"`               // redis 或 station_node
+	Path       string    `json:"path,omitempty"`       // 节点路径，以 / 分隔
+	NodeId     int       `json:"nodeId,omitempty"`     // station_node.node_id
+	Attribute  string    `json:"attribute,omitempty"`  // 属性名
+	ModelId    string    `json:"modelId,omitempty"`    // 模型ID
+	PositionId string    `json:"positionId,omitempty"` // 取值的工位号
+	Parno      string    `json:"parno,omitempty"`      // 实际使用的 parno 或 relation_parno
+	Message    string    `json:"message"`
+}
+
+// StationValidation 单个台站的检查结果
+type StationValidation struct {
+	StationId string            `json:"stationId"`
+	Issues    []ValidationIssue `json:"issues"`
+	Errors    []string          `json:"errors,omitempty"` // 检查本身出错，例如读不到 Basic/Idx 或查询数据库失败
+}
+
+// ValidationReport 一次检查的汇总
+type ValidationReport struct {
+	CheckedAt  string              `json:"checkedAt"`
+	Stations   int                 `json:"stations"`
+	IssueCount int                 `json:"issueCount"`
+	Counts     map[IssueKind]int   `json:"counts"`
+	Results    []StationValidation `json:"results"`
+}
+
+// ValidateStations 检查台站模型，stationIds 为空时检查 svr_station_id 中的所有台站
+func ValidateStations(ctx context.Context, stationIds []string) (*ValidationReport, error) {
+	if len(stationIds) == 0 {
+		ids, err := ListStationIds(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stationIds = ids
+	}
+
+	cache, err := GetModelCache(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("加载模型缓存失败: %w", err)
+	}
+
+	results := make([]StationValidation, len(stationIds))
+	for i, id := range stationIds {
+		results[i] = StationValidation{StationId: id, Issues: make([]ValidationIssue, 0)}
+	}
+
+	builders := make([]*StationTreeBuilder, len(stationIds))
+	if len(stationIds) > 0 {
+		pipe := db.Redis.Pipeline()
+		basicCmd := pipe.HMGet(ctx, StationNodeModelBasicKey, stationIds...)
+		idxCmd := pipe.HMGet(ctx, StationNodeModelIdxKey, stationIds...)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("读取台站模型失败: %w", err)
+		}
+		basicVals, idxVals := basicCmd.Val(), idxCmd.Val()
+		for i, id := range stationIds {
+			b, err := newBuilderFromRaw(id, basicVals[i], idxVals[i], cache)
+			if err != nil {
+				results[i].Errors = append(results[i].Errors, err.Error())
+				continue
+			}
+			builders[i] = b
+		}
+	}
+
+	// 所有台站用到的工位号和关联工位号一起预加载
+	var nums []string
+	for _, b := range builders {
+		if b == nil {
+			continue
+		}
+		nums = append(nums, b.DataNums()...)
+		b.Tree.Root.Walk(func(n *model.Node) bool {
+			nums = append(nums, gconv.String(n.Fields["rPositionId"]))
+			return true
+		})
+	}
+	dataCache, err := PreloadDataByNums(ctx, nums)
+	unreadable := make(map[string]struct{})
+	var preloadErr *PreloadError
+	if errors.As(err, &preloadErr) {
+		for _, key := range preloadErr.Failed {
+			unreadable[key] = struct{}{}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	concurrency := g.Cfg().MustGet(ctx, "overview.batch.concurrency", 8).Int()
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	runBounded(len(stationIds), concurrency, func(i int) {
+		res := &results[i]
+		if b := builders[i]; b != nil {
+			res.Issues = append(res.Issues, validateStationModel(b, cache, dataCache, unreadable)...)
+		}
+		issues, err := validateStationNodes(ctx, res.StationId, cache)
+		if err != nil {
+			res.Errors = append(res.Errors, err.Error())
+		}
+		res.Issues = append(res.Issues, issues...)
+	})
+
+	report := &ValidationReport{
+		CheckedAt: time.Now().Format("2006-01-02 15:04:05"),
+		Stations:  len(results),
+		Counts:    make(map[IssueKind]int),
+		Results:   results,
+	}
+	for _, res := range results {
+		for _, issue := range res.Issues {
+			report.Counts[issue.Kind]++
+		}
+		report.IssueCount += len(res.Issues)
+	}
+	return report, nil
+}
+
+// validateStationModel 检查 redis 中一个台站的 Basic/Idx
+func validateStationModel(b *StationTreeBuilder, cache *ModelCache, dataCache map[string]map[string]string, unreadable map[string]struct{}) []ValidationIssue {
+	issues := make([]ValidationIssue, 0)
+	dangling := make(map[*model.Node]bool)
+
+	b.Tree.Root.Walk(func(n *model.Node) bool {
+		path := n.PathString()
+		issues = append(issues, checkModelIds(IssueSourceRedis, path, 0, cache,
+			gconv.String(n.Fields["dynamic_model_id"]),
+			gconv.String(n.Fields["static_model_id"]),
+			gconv.String(n.Fields["setitem_model_id"]))...)
+
+		if rPositionId := gconv.String(n.Fields["rPositionId"]); rPositionId != "" {
+			key := DataKey(rPositionId)
+			if _, skip := unreadable[key]; !skip && len(dataCache[key]) == 0 {
+				dangling[n] = true
+				issues = append(issues, ValidationIssue{
+					Kind:       IssueDanglingRelation,
+					Source:     IssueSourceRedis,
+					Path:       path,
+					PositionId: rPositionId,
+					Message:    fmt.Sprintf("关联工位号 %s 对应的 %s 不存在", rPositionId, key),
+				})
+			}
+		}
+
+		issues = append(issues, checkDuplicateNames(n.ChildNames(), func(names []string) ValidationIssue {
+			return ValidationIssue{
+				Kind:    IssueDuplicateName,
+				Source:  IssueSourceRedis,
+				Path:    path,
+				Message: fmt.Sprintf("子节点名只有大小写不同，按路径查找时无法区分: %s", strings.Join(names, ", ")),
+			}
+		})...)
+		return true
+	})
+
+	// 按 positionId 去重，同一个节点的同一个 svr_DATA_* 只报一次不存在
+	missingData := make(map[*model.Node]map[string]bool)
+	for _, p := range b.pending {
+		a := p.attr
+		if a.Kind == model.AttributeStatic {
+			continue
+		}
+		if a.UseRelation && dangling[p.node] {
+			continue
+		}
+		issue := ValidationIssue{
+			Source:     IssueSourceRedis,
+			Path:       p.node.PathString(),
+			Attribute:  a.Name,
+			ModelId:    a.ModelId,
+			PositionId: a.PositionId,
+			Parno:      a.Parno,
+		}
+		if a.PositionId == "" {
+			issue.Kind = IssueMissingData
+			issue.Message = "节点没有 positionId，属性无法取值"
+			issues = append(issues, issue)
+			continue
+		}
+
+		key := DataKey(a.PositionId)
+		if _, skip := unreadable[key]; skip {
+			continue
+		}
+		data := dataCache[key]
+		if len(data) == 0 {
+			if missingData[p.node] == nil {
+				missingData[p.node] = make(map[string]bool)
+			}
+			if !missingData[p.node][a.PositionId] {
+				missingData[p.node][a.PositionId] = true
+				issue.Attribute, issue.ModelId, issue.Parno = "", "", ""
+				issue.Kind = IssueMissingData
+				issue.Message = fmt.Sprintf("%s 不存在或为空", key)
+				issues = append(issues, issue)
+			}
+			continue
+		}
+
+		if !hasParno(data, a.Parno, b.resolver.Rule(a.Kind).IgnoreCase) {
+			issue.Kind = IssueMissingParno
+			field := "parno"
+			if a.UseRelation {
+				field = "relation_parno"
+			}
+			if a.Parno == "" {
+				issue.Message = fmt.Sprintf("模型 %s 的属性 %s 没有配置 %s", a.ModelId, a.Name, field)
+			} else {
+				issue.Message = fmt.Sprintf("%s %s 在 %s 中不存在", field, a.Parno, key)
+			}
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// hasParno 判断 svr_DATA_* 中是否有该字段，是否区分大小写按取值规则
+func hasParno(data map[string]string, parno string, ignoreCase bool) bool {
+	if parno == "" {
+		return false
+	}
+	_, ok := NewDataRecord(data).Get(parno, ignoreCase)
+	return ok
+}
+
+// checkModelIds 检查节点引用的三种模型ID是否存在
+func checkModelIds(source, path string, nodeId int, cache *ModelCache, dynamicId, staticId, setitemId string) []ValidationIssue {
+	var issues []ValidationIssue
+	check := func(id, key string, exists bool) {
+		if id == "" || exists {
+			return
+		}
+		issues = append(issues, ValidationIssue{
+			Kind:    IssueMissingModel,
+			Source:  source,
+			Path:    path,
+			NodeId:  nodeId,
+			ModelId: id,
+			Message: fmt.Sprintf("模型ID %s 在 %s 中不存在", id, key),
+		})
+	}
+	_, ok := cache.Dynamic[dynamicId]
+	check(dynamicId, DynamicModelKey, ok)
+	_, ok = cache.Static[staticId]
+	check(staticId, StaticModelKey, ok)
+	_, ok = cache.SetItem[setitemId]
+	check(setitemId, SetItemModelKey, ok)
+	return issues
+}
+
+// checkDuplicateNames 找出不区分大小写后重名的节点名，每组生成一条问题
+func checkDuplicateNames(names []string, newIssue func(names []string) ValidationIssue) []ValidationIssue {
+	groups := make(map[string][]string)
+	var order []string
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], name)
+	}
+	var issues []ValidationIssue
+	for _, key := range order {
+		if len(groups[key]) > 1 {
+			issues = append(issues, newIssue(groups[key]))
+		}
+	}
+	return issues
+}
+
+// validateStationNodes 检查数据库 station_node 表中一个台站的节点。
+// 和 GetOverViewDataOld 一样以 node_id 最小的节点为根，从根到不了的节点不会出现在总览中，
+// 这些节点沿父节点向上找，回到自己路径上的是环，找不到父节点的是父节点缺失。
+func validateStationNodes(ctx context.Context, stationId string, cache *ModelCache) ([]ValidationIssue, error) {
+	rows, err := LoadStationNodes(ctx, stationId)
+	if err != nil {
+		return nil, err
+	}
+	return checkStationNodes(rows, cache), nil
+}
+
+// checkStationNodes 检查 station_node 的行，见 validateStationNodes
+func checkStationNodes(rows []*stationNodeRow, cache *ModelCache) []ValidationIssue {
+	if len(rows) == 0 {
+		return nil
+	}
+	nodes, children, rootId := indexStationNodes(rows)
+
+	issues := make([]ValidationIssue, 0)
+
+	// 从根向下遍历，得到可达节点和它们的路径
+	paths := make(map[int]string, len(nodes))
+	walkStationNodes(nodes, children, rootId, func(id, parentId int) {
+		if id == rootId {
+			paths[id] = ""
+			return
+		}
+		paths[id] = strings.TrimPrefix(paths[parentId]+"/"+nodes[id].NodeName, "/")
+	})
+
+	ids := make([]int, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	reportedCycle := make(map[int]bool)
+	for _, id := range ids {
+		n := nodes[id]
+		issues = append(issues, checkModelIds(IssueSourceStationNode, paths[id], id, cache,
+			n.DynamicModelId, n.StaticModelId, n.SetitemModelId)...)
+
+		if _, ok := paths[id]; ok {
+			continue
+		}
+		// 不可达节点：沿父节点向上找
+		chain := []int{id}
+		onChain := map[int]int{id: 0}
+		cur := n
+		for {
+			parent, ok := nodes[cur.ParentNodeId]
+			if !ok {
+				issues = append(issues, ValidationIssue{
+					Kind:    IssueMissingParent,
+					Source:  IssueSourceStationNode,
+					NodeId:  id,
+					Message: fmt.Sprintf("节点 %s(%d) 的父节点 %d 不存在，不会出现在总览中", n.NodeName, id, n.ParentNodeId),
+				})
+				break
+			}
+			if _, ok := paths[parent.NodeId]; ok {
+				// 父节点链接到了可达节点，说明是环下面挂的节点，环本身另外报告
+				break
+			}
+			if start, ok := onChain[parent.NodeId]; ok {
+				cycle := chain[start:]
+				if !reportedCycle[cycle[0]] {
+					names := make([]string, 0, len(cycle))
+					for _, cid := range cycle {
+						reportedCycle[cid] = true
+						names = append(names, fmt.Sprintf("%s(%d)", nodes[cid].NodeName, cid))
+					}
+					issues = append(issues, ValidationIssue{
+						Kind:    IssueNodeCycle,
+						Source:  IssueSourceStationNode,
+						NodeId:  parent.NodeId,
+						Message: fmt.Sprintf("父节点形成环: %s", strings.Join(names, " -> ")),
+					})
+				}
+				break
+			}
+			if reportedCycle[parent.NodeId] {
+				// 挂在已报告的环下面
+				break
+			}
+			onChain[parent.NodeId] = len(chain)
+			chain = append(chain, parent.NodeId)
+			cur = parent
+		}
+	}
+
+	// 同一父节点下的同名节点，在总览中后面的会覆盖前面的
+	for _, parentId := range sortedIntKeys(children) {
+		childIds := children[parentId]
+		names := make([]string, 0, len(childIds))
+		for _, cid := range childIds {
+			if cid != parentId {
+				names = append(names, nodes[cid].NodeName)
+			}
+		}
+		parentPath, reachable := paths[parentId]
+		issues = append(issues, checkDuplicateNames(names, func(dup []string) ValidationIssue {
+			issue := ValidationIssue{
+				Kind:    IssueDuplicateName,
+				Source:  IssueSourceStationNode,
+				NodeId:  parentId,
+				Message: fmt.Sprintf("父节点 %d 下有重名子节点: %s", parentId, strings.Join(dup, ", ")),
+			}
+			if reachable {
+				issue.Path = parentPath
+			}
+			return issue
+		})...)
+	}
+	return issues
+}
+
+func sortedIntKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
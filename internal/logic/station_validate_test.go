@@ -0,0 +1,117 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// issueSummary 只比较问题类型和定位信息，不比较提示文字
+type issueSummary struct {
+	Kind       IssueKind
+	Path       string
+	NodeId     int
+	Attribute  string
+	PositionId string
+}
+
+func summarizeIssues(issues []ValidationIssue) []issueSummary {
+	out := make([]issueSummary, 0, len(issues))
+	for _, i := range issues {
+		out = append(out, issueSummary{Kind: i.Kind, Path: i.Path, NodeId: i.NodeId, Attribute: i.Attribute, PositionId: i.PositionId})
+	}
+	return out
+}
+
+func TestCheckStationNodes(t *testing.T) {
+	cache := &ModelCache{
+		Dynamic: map[string]map[string]map[string]interface{}{"tx": {}},
+		Static:  map[string]map[string]interface{}{},
+		SetItem: map[string]map[string]map[string]interface{}{},
+	}
+	rows := []*stationNodeRow{
+		{NodeId: 1, ParentNodeId: 0, NodeName: "一号台", DynamicModelId: "tx"},
+		{NodeId: 2, ParentNodeId: 1, NodeName: "发射机", StaticModelId: "nope"},
+		{NodeId: 3, ParentNodeId: 2, NodeName: "1号机"},
+		{NodeId: 4, ParentNodeId: 2, NodeName: "1号机"},
+		{NodeId: 5, ParentNodeId: 6, NodeName: "环A"},
+		{NodeId: 6, ParentNodeId: 5, NodeName: "环B"},
+		{NodeId: 7, ParentNodeId: 5, NodeName: "挂在环下"},
+		{NodeId: 8, ParentNodeId: 99, NodeName: "孤儿"},
+	}
+
+	got := summarizeIssues(checkStationNodes(rows, cache))
+	want := []issueSummary{
+		{Kind: IssueMissingModel, Path: "发射机", NodeId: 2},
+		{Kind: IssueNodeCycle, NodeId: 5},
+		{Kind: IssueMissingParent, NodeId: 8},
+		{Kind: IssueDuplicateName, Path: "发射机", NodeId: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("检查结果为 %+v\n期望 %+v", got, want)
+	}
+
+	if issues := checkStationNodes(nil, cache); len(issues) != 0 {
+		t.Errorf("没有节点时不应有问题，得到 %+v", issues)
+	}
+}
+
+func TestValidateStationModel(t *testing.T) {
+	cache := &ModelCache{
+		Dynamic: map[string]map[string]map[string]interface{}{
+			"tx": {
+				"Power":   {"parno": "Power", "relation_parno": "RPower"},
+				"Reflect": {"parno": "Reflect"},
+			},
+		},
+		Static:   map[string]map[string]interface{}{},
+		SetItem:  map[string]map[string]map[string]interface{}{},
+		Resolver: NewAttributeResolver(DefaultResolveRules()),
+	}
+	idx := map[string]interface{}{
+		"发射机": map[string]interface{}{
+			"1号机": map[string]interface{}{"positionId": "0101_01", "rPositionId": "0101_09", "dynamic_model_id": "tx"},
+			"2号机": map[string]interface{}{"positionId": "0101_02", "dynamic_model_id": "tx"},
+			"3号机": map[string]interface{}{"positionId": "0101_03", "dynamic_model_id": "tx"},
+		},
+		"配电": map[string]interface{}{"positionId": "0101_05", "dynamic_model_id": "ups"},
+	}
+	data := map[string]map[string]string{
+		DataKey("0101_01"): {"Power": "10"},
+		DataKey("0101_02"): {"Power": "10", "Reflect": "1"},
+		// 0101_03 读取失败，不报告数据缺失
+	}
+	unreadable := map[string]struct{}{DataKey("0101_03"): {}}
+
+	b := NewStationTreeBuilder("0101", map[string]interface{}{}, idx, cache)
+	got := summarizeIssues(validateStationModel(b, cache, data, unreadable))
+	want := map[issueSummary]bool{
+		{Kind: IssueDanglingRelation, Path: "发射机/1号机", PositionId: "0101_09"}:                   true,
+		{Kind: IssueMissingParno, Path: "发射机/1号机", Attribute: "Reflect", PositionId: "0101_01"}: true,
+		{Kind: IssueMissingModel, Path: "配电"}:                                                   true,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("检查结果为 %+v\n期望 %v", got, want)
+	}
+	for _, i := range got {
+		if !want[i] {
+			t.Errorf("多出的问题 %+v", i)
+		}
+	}
+
+	// rPositionId 有数据但 relation_parno 不存在时报告 missing_parno
+	data[DataKey("0101_09")] = map[string]string{"Other": "1"}
+	b = NewStationTreeBuilder("0101", map[string]interface{}{}, idx, cache)
+	got = summarizeIssues(validateStationModel(b, cache, data, unreadable))
+	found := false
+	for _, i := range got {
+		if i.Kind == IssueDanglingRelation {
+			t.Errorf("rPositionId 有数据时不应报告 dangling_rposition: %+v", i)
+		}
+		if i == (issueSummary{Kind: IssueMissingParno, Path: "发射机/1号机", Attribute: "Power", PositionId: "0101_09"}) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("应报告 relation_parno 不存在，得到 %+v", got)
+	}
+}
@@ -0,0 +1,260 @@
+package model
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 台站总览的类型化结构。
+// 由 svr_stationNodeModelBasic / svr_stationNodeModelIdx 构造出节点树，
+// 节点上的属性来自动态、静态和设置项三种模型，属性值从 svr_DATA_* 中取。
+
+// AttributeKind 属性来源的模型类型
+type AttributeKind string
+
+const (
+	AttributeDynamic AttributeKind = "dynamic" // 动态属性，svr_dynamic_model
+	AttributeStatic  AttributeKind = "static"  // 静态属性，svr_static_model，取 para_value
+	AttributeSetItem AttributeKind = "setitem" // 设置项属性，svr_setitem_model
+)
+
+// StationTree 一个台站的总览树
+type StationTree struct {
+	StationId    string `json:"stationId"`
+	ModelVersion int64  `json:"modelVersion"` // 构造时使用的模型缓存版本
+	Source       string `json:"source"`       // 台站模型来源：redis 或 station_node
+	Root         *Node  `json:"root"`
+}
+
+// Node 总览树上的一个节点
+type Node struct {
+	Name       string                 // 节点名，根节点为空
+	Path       []string               // 从根到本节点的节点名
+	Fields     map[string]interface{} // Basic/Idx 上的普通字段，例如 positionId、rPositionId、dynamic_model_id
+	Attributes map[string]*Attribute  // 模型属性，key 为输出时的属性名
+	Children   map[string]*Node
+}
+
+// Attribute 节点上的一个模型属性
+type Attribute struct {
+	Name        string        `json:"name"`
+	Kind        AttributeKind `json:"kind"`
+	ModelId     string        `json:"modelId"`
+	PositionId  string        `json:"positionId,omitempty"`  // 实际取值的工位号（positionId 或 rPositionId）
+	Parno       string        `json:"parno,omitempty"`       // 实际使用的 parno 或 relation_parno
+	UseRelation bool          `json:"useRelation,omitempty"` // 是否使用了 rPositionId / relation_parno
+	Raw         interface{}   `json:"raw"`                   // 原始值，和旧版总览输出一致
+	Value       interface{}   `json:"value"`                 // 解析后的值：数字、布尔或字符串
+	Missing     bool          `json:"missing,omitempty"`     // 没有取到数据，旧版输出中不出现该属性
+}
+
+// NewNode 创建一个空节点
+func NewNode(name string, path []string) *Node {
+	return &Node{
+		Name:       name,
+		Path:       path,
+		Fields:     make(map[string]interface{}),
+		Attributes: make(map[string]*Attribute),
+		Children:   make(map[string]*Node),
+	}
+}
+
+// Child 取子节点，没有就创建
+func (n *Node) Child(name string) *Node {
+	if c, ok := n.Children[name]; ok {
+		return c
+	}
+	path := make([]string, len(n.Path), len(n.Path)+1)
+	copy(path, n.Path)
+	c := NewNode(name, append(path, name))
+	n.Children[name] = c
+	return c
+}
+
+// SetAttribute 挂一个属性。没取到数据的属性不覆盖已有的同名属性，和旧版合并逻辑一致。
+func (n *Node) SetAttribute(a *Attribute) {
+	if a.Missing {
+		if _, ok := n.Attributes[a.Name]; ok {
+			return
+		}
+	}
+	n.Attributes[a.Name] = a
+}
+
+// PathString 节点路径，以 / 分隔
+func (n *Node) PathString() string {
+	return strings.Join(n.Path, "/")
+}
+
+// ChildNames 按名称排序的子节点名
+func (n *Node) ChildNames() []string {
+	return sortedKeys(n.Children)
+}
+
+// AttributeNames 按名称排序的属性名
+func (n *Node) AttributeNames() []string {
+	return sortedKeys(n.Attributes)
+}
+
+// Walk 先序遍历子树，子节点按名称排序；fn 返回 false 时不再进入该节点的子节点
+func (n *Node) Walk(fn func(*Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, name := range n.ChildNames() {
+		n.Children[name].Walk(fn)
+	}
+}
+
+// Find 按路径查找子孙节点，每一级先精确匹配，再不区分大小写匹配；path 为空时返回自身
+func (n *Node) Find(path []string) *Node {
+	cur := n
+	for _, name := range path {
+		next, ok := cur.Children[name]
+		if !ok {
+			for _, childName := range cur.ChildNames() {
+				if strings.EqualFold(childName, name) {
+					next, ok = cur.Children[childName], true
+					break
+				}
+			}
+		}
+		if !ok {
+			return nil
+		}
+		cur = next
+	}
+	return cur
+}
+
+// Contains 判断 other 是否是本节点或本节点的子孙节点
+func (n *Node) Contains(other *Node) bool {
+	if len(other.Path) < len(n.Path) {
+		return false
+	}
+	for i, name := range n.Path {
+		if other.Path[i] != name {
+			return false
+		}
+	}
+	return true
+}
+
+// Project 只保留子树中名称在 names 里的字段和属性（不区分大小写），子节点保留；names 为空时不做处理
+func (n *Node) Project(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	keep := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		keep[strings.ToLower(name)] = struct{}{}
+	}
+	n.Walk(func(node *Node) bool {
+		for k := range node.Fields {
+			if _, ok := keep[strings.ToLower(k)]; !ok {
+				delete(node.Fields, k)
+			}
+		}
+		for k := range node.Attributes {
+			if _, ok := keep[strings.ToLower(k)]; !ok {
+				delete(node.Attributes, k)
+			}
+		}
+		return true
+	})
+}
+
+// SplitPath 把 发射机/1号机 这样的路径拆成节点名，忽略空段
+func SplitPath(path string) []string {
+	var parts []string
+	for _, p := range strings.Split(path, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// WireMap 转成旧版总览接口的输出结构：子节点、普通字段和属性值放在同一层。
+// 同名时普通字段覆盖子节点，属性覆盖普通字段和子节点，和旧版合并时先写属性再合并 Idx 的顺序一致。
+func (n *Node) WireMap() map[string]interface{} {
+	m := make(map[string]interface{}, len(n.Fields)+len(n.Attributes)+len(n.Children))
+	for k, c := range n.Children {
+		m[k] = c.WireMap()
+	}
+	for k, v := range n.Fields {
+		m[k] = v
+	}
+	for k, a := range n.Attributes {
+		if a.Missing {
+			continue
+		}
+		m[k] = a.Raw
+	}
+	return m
+}
+
+// MarshalJSON 输出旧版格式
+func (n *Node) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.WireMap())
+}
+
+// RichNode 带属性来源信息的输出格式
+type RichNode struct {
+	Name       string                 `json:"name"`
+	Path       string                 `json:"path"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+	Attributes []*Attribute           `json:"attributes,omitempty"`
+	Children   []*RichNode            `json:"children,omitempty"`
+}
+
+// Rich 转成带属性来源信息的输出格式，属性和子节点按名称排序
+func (n *Node) Rich() *RichNode {
+	rn := &RichNode{
+		Name:   n.Name,
+		Path:   n.PathString(),
+		Fields: n.Fields,
+	}
+	for _, name := range n.AttributeNames() {
+		rn.Attributes = append(rn.Attributes, n.Attributes[name])
+	}
+	for _, name := range n.ChildNames() {
+		rn.Children = append(rn.Children, n.Children[name].Rich())
+	}
+	return rn
+}
+
+// ParseAttributeValue 把原始值解析成数字或布尔，解析不了的保持原样。
+// NaN、Inf 不能序列化成 JSON，保持字符串。
+func ParseAttributeValue(raw interface{}) interface{} {
+	s, ok := raw.(string)
+	if !ok {
+		return raw
+	}
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	if f, err := strconv.ParseFloat(trimmed, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f
+	}
+	switch strings.ToLower(trimmed) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
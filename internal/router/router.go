@@ -11,6 +11,8 @@ import (
 	getstationnoteapi "gf_api/internal/controller/client3.0_api/get_station_note_api"
 	getsyslogapi "gf_api/internal/controller/client3.0_api/get_sys_log_api"
 	gettimeapi "gf_api/internal/controller/client3.0_api/get_time_api"
+	commandapi "gf_api/internal/controller/command_api"
+	notifyapi "gf_api/internal/controller/notify_api"
 
 	"github.com/gogf/gf/v2/net/ghttp"
 )
@@ -32,8 +34,13 @@ func RegisterAllRoutes(group *ghttp.RouterGroup) {
 	childsysnumber.Register(group)
 
 	// GET /api/Basic/OverViewData - 获取台站总览数据
+	// GET /api/Basic/OverViewData/ws - 台站总览数据 WebSocket 推送
+	// GET /api/Basic/OverViewDataBatch - 获取多个台站的总览数据
+	// GET /api/Basic/OverViewDiff - 比较两个时间或两个台站的总览数据
+	// GET /api/Basic/OverViewExport - 导出台站总览（CSV/XLSX）
 	// GET /api/Basic/AllStation - 获取所有台站信息
 	// GET /api/Basic/AllStationId - 获取所有台站ID
+	// GET /api/Admin/StationModelValidate - 台站模型一致性检查
 	api.Register(group)
 
 	// GET /api/Basic/ProgramSystemDataSubscribe - 获取子系统信息
@@ -44,6 +51,14 @@ func RegisterAllRoutes(group *ghttp.RouterGroup) {
 
 	// ==================== Resource 相关接口 ====================
 	// GET /api/DevHis - 获取设备历史数据
+	// GET /api/Resource/AlarmHis - 获取告警历史数据
+	// GET /api/Resource/AlarmActive - 获取当前活动告警
+	// GET /api/Resource/AlarmGroups - 获取按根因分组的活动告警
+	// GET /api/Resource/AlarmActions - 获取告警的操作记录
+	// POST /api/Resource/AlarmAck - 确认告警
+	// POST /api/Resource/AlarmComment - 告警备注
+	// POST /api/Resource/AlarmShelve - 搁置告警
+	// POST /api/Resource/AlarmUnshelve - 取消搁置
 	alarmhisapi.Register(group)
 
 	// GET /api/Resource/GetNotes - 获取台站注意事项
@@ -58,6 +73,24 @@ func RegisterAllRoutes(group *ghttp.RouterGroup) {
 	// POST /api/Resource/IssueOperateNew - 台站客户端的下发控制
 	controlsysapi.Register(group)
 
+	// GET /api/Resource/Commands - 查询控制命令列表
+	// GET /api/Resource/Command - 查询单条控制命令的状态
+	// GET /api/Resource/CommandApprovals - 查询待审批的关键操作
+	// POST /api/Resource/CommandApprove - 审批通过关键操作
+	// POST /api/Resource/CommandReject - 驳回关键操作
+	// GET /api/Resource/CommandSchedules - 查询定时控制命令列表
+	// GET /api/Resource/CommandSchedule - 查询单个定时控制命令
+	// POST /api/Resource/CommandSchedule - 创建定时控制命令
+	// POST /api/Resource/CommandSchedulePause - 暂停定时控制命令
+	// POST /api/Resource/CommandScheduleResume - 恢复定时控制命令
+	// POST /api/Resource/CommandScheduleCancel - 取消定时控制命令
+	commandapi.Register(group)
+
+	// ==================== Admin 管理接口 ====================
+	// GET /api/Admin/NotifyOutbox - 查询通知发件箱
+	// POST /api/Admin/NotifyTest - 测试通知通道
+	notifyapi.Register(group)
+
 	// ==================== 预留扩展区域 ====================
 	// 后续新增接口请在此处添加，并添加相应注释说明
 	// 同时请在项目根目录的 ROUTES.md 文件中添加路由信息
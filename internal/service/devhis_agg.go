@@ -0,0 +1,504 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gf_api/internal/logic"
+
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+)
+
+// 设备历史数据的服务端聚合。
+// 外部 /HisData/DevHis 只能分页返回原始记录，趋势图一次要拉几千行。聚合模式下由服务自己逐页拉取，
+// 按 interval 分桶，计算 avg/min/max/last，返回可以直接画图的序列；支持多个 positionId 叠加。
+//
+// 外部接口返回的记录结构通过 external.hisDataService.devHis 配置，未配置时自动识别：
+//   - listPath / totalPath：记录列表和总数在响应中的路径，默认依次尝试 data.list、data.rows、data.records、data 和 data.total、data.count、total；
+//   - timeField：时间字段，默认依次尝试 time、save_time、data_time、create_time、timestamp；
+//   - valueField / nameField：每行一个值时的值字段和参数名字段，默认 value 和 parno/name；
+//     记录中没有值字段时，除时间和工位号以外的每个数值字段各是一条序列。
+//
+// source=local 时从本地历史库（见 logic/historian.go）汇总；不指定 source 时外部服务不可达的工位号改用本地历史库
+// （historian.fallback=false 时不回退），source=external 时不回退。
+
+// 历史数据来源
+const (
+	HisSourceExternal = "external"
+	HisSourceLocal    = "local"
+)
+
+// FallbackToLocal 外部服务的请求出错后是否改用本地历史库：只有不指定 source、允许回退（historian.fallback）
+// 并且外部服务不可达时才回退，外部服务返回的业务错误原样返回
+func FallbackToLocal(source string, err error, enabled bool) bool {
+	return source == "" && enabled && IsUnreachable(err)
+}
+
+// 支持的聚合方式
+const (
+	DevHisAggAvg  = "avg"
+	DevHisAggMin  = "min"
+	DevHisAggMax  = "max"
+	DevHisAggLast = "last"
+)
+
+// DevHisAggQuery 聚合查询条件
+type DevHisAggQuery struct {
+	PositionIds []string
+	BeginTime   string // YYYY-MM-DD HH:mm:ss，原样传给外部接口
+	EndTime     string
+	Interval    time.Duration
+	Aggs        []string
+	Source      string // 空 / external / local
+}
+
+// DevHisSeries 一条图表序列，Points 为 [桶开始时间的毫秒时间戳, 值]，只包含有数据的桶
+type DevHisSeries struct {
+	PositionId string       `json:"positionId"`
+	Name       string       `json:"name"`
+	Agg        string       `json:"agg"`
+	Points     [][2]float64 `json:"points"`
+}
+
+// DevHisPositionStat 每个 positionId 的拉取情况
+type DevHisPositionStat struct {
+	PositionId string `json:"positionId"`
+	Source     string `json:"source"` // external / local
+	Pages      int    `json:"pages"`
+	RawCount   int    `json:"rawCount"`
+	Truncated  bool   `json:"truncated"` // 超过 devHis.maxPages，后面的记录没有拉取
+	Error      string `json:"error,omitempty"`
+}
+
+// DevHisAggResult 聚合结果
+type DevHisAggResult struct {
+	Series    []DevHisSeries       `json:"series"`
+	Positions []DevHisPositionStat `json:"positions"`
+}
+
+// devHisPoint 一个原始采样值
+type devHisPoint struct {
+	time  time.Time
+	name  string
+	value float64
+}
+
+// devHisFields 记录结构配置
+type devHisFields struct {
+	listPath   string
+	totalPath  string
+	timeField  string
+	valueField string
+	nameField  string
+}
+
+func loadDevHisFields(ctx context.Context) devHisFields {
+	get := func(key string) string {
+		return g.Cfg().MustGet(ctx, "external.hisDataService.devHis."+key, "").String()
+	}
+	return devHisFields{
+		listPath:   get("listPath"),
+		totalPath:  get("totalPath"),
+		timeField:  get("timeField"),
+		valueField: get("valueField"),
+		nameField:  get("nameField"),
+	}
+}
+
+// ParseHisInterval 解析聚合间隔，支持 time.ParseDuration 的格式和按天的 1d、7d
+func ParseHisInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("聚合间隔 %q 格式错误", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Second {
+		return 0, fmt.Errorf("聚合间隔 %q 格式错误，如 5m、1h、1d", s)
+	}
+	return d, nil
+}
+
+// ParseHisAggs 解析逗号分隔的聚合方式，为空时默认 avg
+func ParseHisAggs(s string) ([]string, error) {
+	aggs := make([]string, 0, 4)
+	seen := make(map[string]bool)
+	for _, agg := range strings.Split(s, ",") {
+		agg = strings.ToLower(strings.TrimSpace(agg))
+		if agg == "" || seen[agg] {
+			continue
+		}
+		switch agg {
+		case DevHisAggAvg, DevHisAggMin, DevHisAggMax, DevHisAggLast:
+		default:
+			return nil, fmt.Errorf("不支持的聚合方式 %q，可选 avg、min、max、last", agg)
+		}
+		seen[agg] = true
+		aggs = append(aggs, agg)
+	}
+	if len(aggs) == 0 {
+		aggs = append(aggs, DevHisAggAvg)
+	}
+	return aggs, nil
+}
+
+// AggregateDevHis 逐页拉取每个 positionId 的历史数据并按间隔聚合。
+// 单个 positionId 拉取失败时记录在 Positions 中，其余照常返回；全部失败时返回第一个错误。
+func (s *ExternalService) AggregateDevHis(ctx context.Context, q DevHisAggQuery) (*DevHisAggResult, error) {
+	begin, err := gtime.StrToTime(q.BeginTime)
+	if err != nil {
+		return nil, fmt.Errorf("beginTime 格式错误: %w", err)
+	}
+	end, err := gtime.StrToTime(q.EndTime)
+	if err != nil {
+		return nil, fmt.Errorf("endTime 格式错误: %w", err)
+	}
+	if !end.After(begin) {
+		return nil, fmt.Errorf("endTime 必须晚于 beginTime")
+	}
+	maxBuckets := g.Cfg().MustGet(ctx, "external.hisDataService.devHis.maxBuckets", 10000).Int()
+	if buckets := int(end.Sub(begin) / q.Interval); buckets > maxBuckets {
+		return nil, fmt.Errorf("时间范围内有 %d 个桶，超过上限 %d，请增大 interval", buckets, maxBuckets)
+	}
+
+	fields := loadDevHisFields(ctx)
+	stats := make([]DevHisPositionStat, len(q.PositionIds))
+	points := make([][]devHisPoint, len(q.PositionIds))
+	errs := make([]error, len(q.PositionIds))
+	var wg sync.WaitGroup
+	for i, positionId := range q.PositionIds {
+		stats[i].PositionId = positionId
+		if q.Source == HisSourceLocal {
+			stats[i].Source = HisSourceLocal
+			continue
+		}
+		stats[i].Source = HisSourceExternal
+		wg.Add(1)
+		go func(i int, positionId string) {
+			defer wg.Done()
+			points[i], errs[i] = s.fetchDevHisPoints(ctx, positionId, q.BeginTime, q.EndTime, fields, &stats[i])
+		}(i, positionId)
+	}
+	wg.Wait()
+
+	// 外部服务不可达的改用本地历史库
+	fallback := g.Cfg().MustGet(ctx, "historian.fallback", true).Bool()
+	local := make([]string, 0)
+	for i := range q.PositionIds {
+		if FallbackToLocal(q.Source, errs[i], fallback) {
+			stats[i] = DevHisPositionStat{PositionId: q.PositionIds[i], Source: HisSourceLocal}
+			errs[i] = nil
+		}
+		if stats[i].Source == HisSourceLocal {
+			local = append(local, q.PositionIds[i])
+		}
+	}
+	var localSeries map[string][]DevHisSeries
+	if len(local) > 0 {
+		buckets, err := logic.QueryHistorianBuckets(ctx, local, begin.Time, end.Time, q.Interval)
+		for i := range q.PositionIds {
+			if stats[i].Source == HisSourceLocal {
+				errs[i] = err
+			}
+		}
+		localSeries = seriesFromHistorianBuckets(buckets, q.Aggs)
+	}
+
+	res := &DevHisAggResult{Series: make([]DevHisSeries, 0), Positions: stats}
+	failed := 0
+	for i, positionId := range q.PositionIds {
+		if errs[i] != nil {
+			stats[i].Error = errs[i].Error()
+			failed++
+			continue
+		}
+		if stats[i].Source == HisSourceLocal {
+			res.Series = append(res.Series, localSeries[positionId]...)
+			continue
+		}
+		res.Series = append(res.Series, aggregateDevHisPoints(positionId, points[i], q.Interval, q.Aggs)...)
+	}
+	if failed == len(q.PositionIds) && failed > 0 {
+		return nil, errs[0]
+	}
+	return res, nil
+}
+
+// seriesFromHistorianBuckets 把本地历史库的汇总转成图表序列，按工位号分组
+func seriesFromHistorianBuckets(buckets []logic.HistorianBucket, aggs []string) map[string][]DevHisSeries {
+	out := make(map[string][]DevHisSeries)
+	for start := 0; start < len(buckets); {
+		end := start
+		for end < len(buckets) && buckets[end].PositionId == buckets[start].PositionId && buckets[end].Parno == buckets[start].Parno {
+			end++
+		}
+		for _, agg := range aggs {
+			s := DevHisSeries{PositionId: buckets[start].PositionId, Name: buckets[start].Parno, Agg: agg, Points: make([][2]float64, 0, end-start)}
+			for _, b := range buckets[start:end] {
+				var v float64
+				switch agg {
+				case DevHisAggAvg:
+					v = b.Avg
+				case DevHisAggMin:
+					v = b.Min
+				case DevHisAggMax:
+					v = b.Max
+				case DevHisAggLast:
+					v = b.Last
+				}
+				s.Points = append(s.Points, [2]float64{float64(b.Bucket.UnixMilli()), v})
+			}
+			out[s.PositionId] = append(out[s.PositionId], s)
+		}
+		start = end
+	}
+	return out
+}
+
+// fetchDevHisPoints 逐页拉取一个 positionId 的所有记录，每页 devHis.fetchPageSize 条，最多 devHis.maxPages 页
+func (s *ExternalService) fetchDevHisPoints(ctx context.Context, positionId, beginTime, endTime string, fields devHisFields, stat *DevHisPositionStat) ([]devHisPoint, error) {
+	pageSize := g.Cfg().MustGet(ctx, "external.hisDataService.devHis.fetchPageSize", 500).Int()
+	maxPages := g.Cfg().MustGet(ctx, "external.hisDataService.devHis.maxPages", 200).Int()
+	points := make([]devHisPoint, 0)
+	for page := 1; ; page++ {
+		result, err := s.GetDevHis(ctx, positionId, beginTime, endTime, page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		rows, total := extractDevHisRows(result, fields)
+		stat.Pages = page
+		stat.RawCount += len(rows)
+		for _, row := range rows {
+			points = append(points, devHisRowPoints(row, fields)...)
+		}
+		if len(rows) < pageSize || (total > 0 && stat.RawCount >= total) {
+			return points, nil
+		}
+		if page >= maxPages {
+			stat.Truncated = true
+			return points, nil
+		}
+	}
+}
+
+// extractDevHisRows 取出响应中的记录列表和总数（没有总数时为0）
+func extractDevHisRows(result map[string]interface{}, fields devHisFields) ([]map[string]interface{}, int) {
+	j := gjson.New(result)
+	listPaths := []string{"data.list", "data.rows", "data.records", "data"}
+	if fields.listPath != "" {
+		listPaths = []string{fields.listPath}
+	}
+	var rows []map[string]interface{}
+	for _, path := range listPaths {
+		v := j.Get(path)
+		if v.IsNil() || !v.IsSlice() {
+			continue
+		}
+		for _, item := range v.Slice() {
+			if row, ok := item.(map[string]interface{}); ok {
+				rows = append(rows, row)
+			}
+		}
+		break
+	}
+	totalPaths := []string{"data.total", "data.count", "total"}
+	if fields.totalPath != "" {
+		totalPaths = []string{fields.totalPath}
+	}
+	for _, path := range totalPaths {
+		if v := j.Get(path); !v.IsNil() {
+			return rows, v.Int()
+		}
+	}
+	return rows, 0
+}
+
+// devHisRowPoints 一行记录中的采样值
+func devHisRowPoints(row map[string]interface{}, fields devHisFields) []devHisPoint {
+	timeField := firstField(row, fields.timeField, "time", "save_time", "data_time", "create_time", "timestamp")
+	if timeField == "" {
+		return nil
+	}
+	t, ok := parseHisTime(row[timeField])
+	if !ok {
+		return nil
+	}
+
+	if valueField := firstField(row, fields.valueField, "value"); valueField != "" {
+		v, ok := hisNumber(row[valueField])
+		if !ok {
+			return nil
+		}
+		name := valueField
+		if nameField := firstField(row, fields.nameField, "parno", "name"); nameField != "" {
+			name = fmt.Sprint(row[nameField])
+		}
+		return []devHisPoint{{time: t, name: name, value: v}}
+	}
+
+	points := make([]devHisPoint, 0, len(row))
+	for key, raw := range row {
+		switch strings.ToLower(key) {
+		case strings.ToLower(timeField), "id", "position_id", "positionid":
+			continue
+		}
+		if v, ok := hisNumber(raw); ok {
+			points = append(points, devHisPoint{time: t, name: key, value: v})
+		}
+	}
+	return points
+}
+
+// firstField 配置了字段名时只用配置的，否则返回候选中第一个存在的字段
+func firstField(row map[string]interface{}, configured string, candidates ...string) string {
+	if configured != "" {
+		if _, ok := row[configured]; ok {
+			return configured
+		}
+		return ""
+	}
+	for _, name := range candidates {
+		if _, ok := row[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// parseHisTime 时间字段：字符串按常见格式解析，数字按秒或毫秒时间戳解析
+func parseHisTime(v interface{}) (time.Time, bool) {
+	if s, ok := v.(string); ok {
+		t, err := gtime.StrToTime(s)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t.Time, true
+	}
+	n, ok := hisNumber(v)
+	if !ok || n <= 0 {
+		return time.Time{}, false
+	}
+	if n > 1e12 {
+		return time.UnixMilli(int64(n)), true
+	}
+	return time.Unix(int64(n), 0), true
+}
+
+// hisNumber 数值或数字字符串，其它类型不是采样值
+func hisNumber(v interface{}) (float64, bool) {
+	var f float64
+	switch x := v.(type) {
+	case float64:
+		f = x
+	case float32:
+		f = float64(x)
+	case int:
+		f = float64(x)
+	case int64:
+		f = float64(x)
+	case json.Number:
+		n, err := x.Float64()
+		if err != nil {
+			return 0, false
+		}
+		f = n
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return 0, false
+		}
+		f = n
+	default:
+		return 0, false
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// hisBucketStart 采样时间所在桶的开始时间，按本地时区对齐（1d 的桶从本地零点开始）
+func hisBucketStart(t time.Time, interval time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(interval).Add(-shift)
+}
+
+// hisBucket 一个桶的累计值
+type hisBucket struct {
+	sum, min, max, last float64
+	count               int
+	lastAt              time.Time
+}
+
+// aggregateDevHisPoints 按参数名和桶聚合，每个参数每种聚合方式一条序列，按参数名排序
+func aggregateDevHisPoints(positionId string, points []devHisPoint, interval time.Duration, aggs []string) []DevHisSeries {
+	byName := make(map[string]map[int64]*hisBucket)
+	for _, p := range points {
+		buckets := byName[p.name]
+		if buckets == nil {
+			buckets = make(map[int64]*hisBucket)
+			byName[p.name] = buckets
+		}
+		key := hisBucketStart(p.time, interval).UnixMilli()
+		b := buckets[key]
+		if b == nil {
+			b = &hisBucket{min: p.value, max: p.value, last: p.value, lastAt: p.time}
+			buckets[key] = b
+		}
+		b.sum += p.value
+		b.count++
+		b.min = math.Min(b.min, p.value)
+		b.max = math.Max(b.max, p.value)
+		if !p.time.Before(b.lastAt) {
+			b.last, b.lastAt = p.value, p.time
+		}
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	series := make([]DevHisSeries, 0, len(names)*len(aggs))
+	for _, name := range names {
+		buckets := byName[name]
+		keys := make([]int64, 0, len(buckets))
+		for key := range buckets {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		for _, agg := range aggs {
+			s := DevHisSeries{PositionId: positionId, Name: name, Agg: agg, Points: make([][2]float64, 0, len(keys))}
+			for _, key := range keys {
+				b := buckets[key]
+				var v float64
+				switch agg {
+				case DevHisAggAvg:
+					v = b.sum / float64(b.count)
+				case DevHisAggMin:
+					v = b.min
+				case DevHisAggMax:
+					v = b.max
+				case DevHisAggLast:
+					v = b.last
+				}
+				s.Points = append(s.Points, [2]float64{float64(key), v})
+			}
+			series = append(series, s)
+		}
+	}
+	return series
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHisInterval(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"5m", 5 * time.Minute, false},
+		{" 1h ", time.Hour, false},
+		{"1s", time.Second, false},
+		{"1d", 24 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"", 0, true},
+		{"0d", 0, true},
+		{"-1d", 0, true},
+		{"1.5d", 0, true},
+		{"500ms", 0, true},
+		{"abc", 0, true},
+	}
+	for _, c := range cases {
+		got, err := ParseHisInterval(c.in)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("ParseHisInterval(%q) = (%s, %v), want (%s, err=%v)", c.in, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+func TestParseHisAggs(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{DevHisAggAvg}, false},
+		{"max, MIN ,max,last", []string{DevHisAggMax, DevHisAggMin, DevHisAggLast}, false},
+		{"avg,sum", nil, true},
+	}
+	for _, c := range cases {
+		got, err := ParseHisAggs(c.in)
+		if (err != nil) != c.wantErr || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseHisAggs(%q) = (%v, %v), want (%v, err=%v)", c.in, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+func TestHisBucketStart(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	at := time.Date(2026, 10, 18, 3, 47, 12, 0, loc)
+	cases := []struct {
+		interval time.Duration
+		want     time.Time
+	}{
+		{5 * time.Minute, time.Date(2026, 10, 18, 3, 45, 0, 0, loc)},
+		{time.Hour, time.Date(2026, 10, 18, 3, 0, 0, 0, loc)},
+		// 按天的桶从本地零点开始，不是 UTC 零点
+		{24 * time.Hour, time.Date(2026, 10, 18, 0, 0, 0, 0, loc)},
+	}
+	for _, c := range cases {
+		if got := hisBucketStart(at, c.interval); !got.Equal(c.want) {
+			t.Errorf("hisBucketStart(%s) = %s, want %s", c.interval, got, c.want)
+		}
+	}
+}
+
+func TestAggregateDevHisPoints(t *testing.T) {
+	base := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	ms := func(minutes int) float64 { return float64(base.Add(time.Duration(minutes) * time.Minute).UnixMilli()) }
+	points := []devHisPoint{
+		{base.Add(1 * time.Minute), "Power", 10},
+		{base.Add(4 * time.Minute), "Power", 30},
+		// 乱序：last 取时间最晚的值，不是最后出现的值
+		{base.Add(2 * time.Minute), "Power", 20},
+		{base.Add(6 * time.Minute), "Power", 5},
+		{base.Add(3 * time.Minute), "Current", 1},
+	}
+	got := aggregateDevHisPoints("0101_TX1", points, 5*time.Minute, []string{DevHisAggAvg, DevHisAggMin, DevHisAggMax, DevHisAggLast})
+	want := []DevHisSeries{
+		{PositionId: "0101_TX1", Name: "Current", Agg: DevHisAggAvg, Points: [][2]float64{{ms(0), 1}}},
+		{PositionId: "0101_TX1", Name: "Current", Agg: DevHisAggMin, Points: [][2]float64{{ms(0), 1}}},
+		{PositionId: "0101_TX1", Name: "Current", Agg: DevHisAggMax, Points: [][2]float64{{ms(0), 1}}},
+		{PositionId: "0101_TX1", Name: "Current", Agg: DevHisAggLast, Points: [][2]float64{{ms(0), 1}}},
+		{PositionId: "0101_TX1", Name: "Power", Agg: DevHisAggAvg, Points: [][2]float64{{ms(0), 20}, {ms(5), 5}}},
+		{PositionId: "0101_TX1", Name: "Power", Agg: DevHisAggMin, Points: [][2]float64{{ms(0), 10}, {ms(5), 5}}},
+		{PositionId: "0101_TX1", Name: "Power", Agg: DevHisAggMax, Points: [][2]float64{{ms(0), 30}, {ms(5), 5}}},
+		{PositionId: "0101_TX1", Name: "Power", Agg: DevHisAggLast, Points: [][2]float64{{ms(0), 30}, {ms(5), 5}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("aggregateDevHisPoints:\n got  %v\n want %v", got, want)
+	}
+
+	if got := aggregateDevHisPoints("0101_TX1", nil, time.Minute, []string{DevHisAggAvg}); len(got) != 0 {
+		t.Errorf("没有采样点时应没有序列，得到 %v", got)
+	}
+}
+
+func TestParseHisTime(t *testing.T) {
+	sec := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		in     interface{}
+		want   time.Time
+		wantOk bool
+	}{
+		{float64(sec.Unix()), sec, true},
+		{float64(sec.UnixMilli()), sec, true},
+		{"abc", time.Time{}, false},
+		{float64(0), time.Time{}, false},
+		{true, time.Time{}, false},
+	}
+	for _, c := range cases {
+		got, ok := parseHisTime(c.in)
+		if ok != c.wantOk || !got.Equal(c.want) {
+			t.Errorf("parseHisTime(%v) = (%s, %v), want (%s, %v)", c.in, got, ok, c.want, c.wantOk)
+		}
+	}
+}
+
+func TestFallbackToLocal(t *testing.T) {
+	unreachable := &UnreachableError{Err: errors.New("connection refused")}
+	business := &BusinessError{Response: map[string]interface{}{"code": 500, "message": "工位号不存在"}}
+	cases := []struct {
+		name    string
+		source  string
+		err     error
+		enabled bool
+		want    bool
+	}{
+		{"不可达时回退", "", unreachable, true, true},
+		{"包装过的不可达错误", "", fmt.Errorf("查询 0101: %w", unreachable), true, true},
+		{"业务错误不回退", "", business, true, false},
+		{"其他错误不回退", "", errors.New("解析返回 JSON 失败"), true, false},
+		{"没有错误", "", nil, true, false},
+		{"指定 external 不回退", HisSourceExternal, unreachable, true, false},
+		{"关闭回退", "", unreachable, false, false},
+	}
+	for _, c := range cases {
+		if got := FallbackToLocal(c.source, c.err, c.enabled); got != c.want {
+			t.Errorf("%s: FallbackToLocal = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 
@@ -23,6 +24,25 @@ func (e *BusinessError) Error() string {
 	return "业务错误"
 }
 
+// UnreachableError 外部服务不可达（网络错误），调用方可以改用本地数据
+type UnreachableError struct {
+	Err error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("调用外部接口失败: %v", e.Err)
+}
+
+func (e *UnreachableError) Unwrap() error {
+	return e.Err
+}
+
+// IsUnreachable 是否是外部服务不可达的错误
+func IsUnreachable(err error) bool {
+	var target *UnreachableError
+	return errors.As(err, &target)
+}
+
 // ExternalService 外部服务调用封装
 type ExternalService struct {
 	baseURL string
@@ -119,7 +139,7 @@ func (s *ExternalService) CallAPI(ctx context.Context, path string, params map[s
 	resp, err := g.Client().Get(ctx, fullURL)
 	if err != nil {
 		log.logError("error", "网络请求失败", err)
-		return nil, fmt.Errorf("调用外部接口失败: %w", err)
+		return nil, &UnreachableError{Err: err}
 	}
 	defer resp.Close()
 
@@ -203,7 +223,7 @@ func (s *ExternalService) CallAPIPost(ctx context.Context, path string, bodyData
 	resp, err := g.Client().Post(ctx, requestURL, bodyData)
 	if err != nil {
 		log.logError("error", "网络请求失败", err)
-		return nil, fmt.Errorf("调用外部接口失败: %w", err)
+		return nil, &UnreachableError{Err: err}
 	}
 	defer resp.Close()
 
@@ -0,0 +1,12 @@
+-- 台站总览历史快照（overview.history），见 internal/logic/overview_history.go
+CREATE TABLE IF NOT EXISTS overview_snapshot (
+    id            BIGSERIAL PRIMARY KEY,
+    station_id    VARCHAR(64) NOT NULL,
+    kind          VARCHAR(8)  NOT NULL,
+    model_version BIGINT      NOT NULL DEFAULT 0,
+    captured_at   TIMESTAMPTZ NOT NULL,
+    content       JSONB       NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_overview_snapshot_station_time
+    ON overview_snapshot (station_id, kind, captured_at);
@@ -0,0 +1,37 @@
+-- 告警规则和告警记录（alarm），见 internal/logic/alarm_store.go
+CREATE TABLE IF NOT EXISTS alarm_rule (
+    id          BIGSERIAL PRIMARY KEY,
+    name        VARCHAR(128)     NOT NULL DEFAULT '',
+    model_id    VARCHAR(64)      NOT NULL DEFAULT '',
+    position_id VARCHAR(64)      NOT NULL DEFAULT '',
+    attribute   VARCHAR(128)     NOT NULL,
+    kind        VARCHAR(16)      NOT NULL,
+    thresholds  JSONB,
+    states      JSONB,
+    deadband    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    message     VARCHAR(256)     NOT NULL DEFAULT '',
+    enabled     BOOLEAN          NOT NULL DEFAULT TRUE
+);
+
+-- alarm_key 由台站、路径和属性名拼成，长度不固定，不能截断；其他字段写入前按列宽截断
+CREATE TABLE IF NOT EXISTS alarm_event (
+    id          BIGSERIAL PRIMARY KEY,
+    alarm_key   TEXT         NOT NULL,
+    station_id  VARCHAR(64)  NOT NULL,
+    path        VARCHAR(256) NOT NULL DEFAULT '',
+    attribute   VARCHAR(128) NOT NULL,
+    position_id VARCHAR(64)  NOT NULL DEFAULT '',
+    parno       VARCHAR(128) NOT NULL DEFAULT '',
+    rule_id     BIGINT       NOT NULL DEFAULT 0,
+    rule_source VARCHAR(16)  NOT NULL DEFAULT '',
+    severity    VARCHAR(16)  NOT NULL,
+    value       VARCHAR(256) NOT NULL DEFAULT '',
+    message     VARCHAR(512) NOT NULL DEFAULT '',
+    state       VARCHAR(16)  NOT NULL,
+    raised_at   TIMESTAMPTZ  NOT NULL,
+    updated_at  TIMESTAMPTZ  NOT NULL,
+    cleared_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_alarm_event_key_state ON alarm_event (alarm_key, state);
+CREATE INDEX IF NOT EXISTS idx_alarm_event_position_time ON alarm_event (position_id, raised_at);
@@ -0,0 +1,17 @@
+-- 告警确认、备注和搁置（alarm ack/shelve），见 internal/logic/alarm_ack.go
+ALTER TABLE alarm_event ADD COLUMN IF NOT EXISTS acked_by VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE alarm_event ADD COLUMN IF NOT EXISTS acked_at TIMESTAMPTZ;
+ALTER TABLE alarm_event ADD COLUMN IF NOT EXISTS shelved_by VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE alarm_event ADD COLUMN IF NOT EXISTS shelved_until TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS alarm_action (
+    id            BIGSERIAL PRIMARY KEY,
+    alarm_id      BIGINT       NOT NULL,
+    action        VARCHAR(16)  NOT NULL,
+    user_id       VARCHAR(64)  NOT NULL DEFAULT '',
+    comment       VARCHAR(512) NOT NULL DEFAULT '',
+    shelved_until TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_alarm_action_alarm ON alarm_action (alarm_id, created_at);
@@ -0,0 +1,19 @@
+-- 通知发件箱（notify），见 internal/logic/notify.go
+CREATE TABLE IF NOT EXISTS notify_outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    channel         VARCHAR(64)  NOT NULL,
+    kind            VARCHAR(16)  NOT NULL,
+    dedup_key       VARCHAR(512) NOT NULL DEFAULT '',
+    station_id      VARCHAR(64)  NOT NULL DEFAULT '',
+    severity        VARCHAR(16)  NOT NULL DEFAULT '',
+    payload         JSONB        NOT NULL,
+    status          VARCHAR(16)  NOT NULL,
+    attempts        INT          NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ  NOT NULL,
+    last_error      VARCHAR(512) NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ  NOT NULL,
+    sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_notify_outbox_status_next ON notify_outbox (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_notify_outbox_dedup ON notify_outbox (channel, dedup_key, created_at);
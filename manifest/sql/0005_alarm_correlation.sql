@@ -0,0 +1,3 @@
+-- 告警根因关联（alarm.correlation），见 internal/logic/alarm_correlate.go
+ALTER TABLE alarm_event ADD COLUMN IF NOT EXISTS root_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE alarm_event ADD COLUMN IF NOT EXISTS suppressed BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,23 @@
+-- 本地历史库（historian），见 internal/logic/historian.go
+CREATE TABLE IF NOT EXISTS his_sample (
+    id          BIGSERIAL PRIMARY KEY,
+    position_id VARCHAR(64)  NOT NULL,
+    parno       VARCHAR(128) NOT NULL,
+    ts          TIMESTAMPTZ  NOT NULL,
+    value       DOUBLE PRECISION,
+    text        VARCHAR(256) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_his_sample_position_ts ON his_sample (position_id, ts);
+
+CREATE TABLE IF NOT EXISTS his_rollup_hour (
+    position_id VARCHAR(64)      NOT NULL,
+    parno       VARCHAR(128)     NOT NULL,
+    bucket      TIMESTAMPTZ      NOT NULL,
+    avg         DOUBLE PRECISION NOT NULL,
+    min         DOUBLE PRECISION NOT NULL,
+    max         DOUBLE PRECISION NOT NULL,
+    last        DOUBLE PRECISION NOT NULL,
+    count       INT              NOT NULL,
+    PRIMARY KEY (position_id, parno, bucket)
+);
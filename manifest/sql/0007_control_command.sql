@@ -0,0 +1,38 @@
+-- 控制命令队列和状态记录（command），见 internal/logic/command.go
+CREATE TABLE IF NOT EXISTS control_command (
+    id               BIGSERIAL PRIMARY KEY,
+    station_id       VARCHAR(64)  NOT NULL DEFAULT '',
+    position_id      VARCHAR(128) NOT NULL,
+    path             VARCHAR(512) NOT NULL DEFAULT '',
+    operate_model_id VARCHAR(128) NOT NULL DEFAULT '',
+    name             VARCHAR(128) NOT NULL,
+    para             VARCHAR(128) NOT NULL DEFAULT '',
+    paranew          VARCHAR(256) NOT NULL DEFAULT '',
+    frequency        VARCHAR(64)  NOT NULL DEFAULT '',
+    client_ip        VARCHAR(64)  NOT NULL DEFAULT '',
+    user_code        VARCHAR(64)  NOT NULL DEFAULT '',
+    user_name        VARCHAR(64)  NOT NULL DEFAULT '',
+    real_name        VARCHAR(64)  NOT NULL DEFAULT '',
+    agent_type       VARCHAR(32)  NOT NULL DEFAULT '',
+    status           VARCHAR(16)  NOT NULL,
+    message          VARCHAR(512) NOT NULL DEFAULT '',
+    response         TEXT         NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ  NOT NULL,
+    sent_at          TIMESTAMPTZ,
+    acked_at         TIMESTAMPTZ,
+    finished_at      TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_control_command_status ON control_command (status, created_at);
+CREATE INDEX IF NOT EXISTS idx_control_command_position ON control_command (position_id, created_at);
+
+CREATE TABLE IF NOT EXISTS control_command_event (
+    id         BIGSERIAL PRIMARY KEY,
+    command_id BIGINT       NOT NULL,
+    status     VARCHAR(16)  NOT NULL,
+    message    VARCHAR(512) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_control_command_event_command ON control_command_event (command_id, id);
@@ -0,0 +1,3 @@
+-- 控制命令回读确认（command.verify），见 internal/logic/command_verify.go
+ALTER TABLE control_command ADD COLUMN IF NOT EXISTS readback_parno VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE control_command ADD COLUMN IF NOT EXISTS readback_value VARCHAR(256) NOT NULL DEFAULT '';
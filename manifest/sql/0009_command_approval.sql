@@ -0,0 +1,7 @@
+-- 控制命令的审批（command.approval），见 internal/logic/command_approval.go
+ALTER TABLE control_command ADD COLUMN IF NOT EXISTS requested_by VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE control_command ADD COLUMN IF NOT EXISTS approved_by VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE control_command ADD COLUMN IF NOT EXISTS approved_at TIMESTAMPTZ;
+ALTER TABLE control_command ADD COLUMN IF NOT EXISTS approval_deadline TIMESTAMPTZ;
+ALTER TABLE control_command ADD COLUMN IF NOT EXISTS queued_at TIMESTAMPTZ;
+ALTER TABLE control_command_event ADD COLUMN IF NOT EXISTS user_id VARCHAR(64) NOT NULL DEFAULT '';
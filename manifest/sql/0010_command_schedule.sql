@@ -0,0 +1,32 @@
+-- 定时和周期控制命令（command.schedule），见 internal/logic/command_schedule.go
+ALTER TABLE control_command ADD COLUMN IF NOT EXISTS schedule_id BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS control_command_schedule (
+    id              BIGSERIAL PRIMARY KEY,
+    station_id      VARCHAR(64)  NOT NULL DEFAULT '',
+    position_id     VARCHAR(128) NOT NULL,
+    name            VARCHAR(128) NOT NULL,
+    para            VARCHAR(128) NOT NULL DEFAULT '',
+    paranew         VARCHAR(256) NOT NULL DEFAULT '',
+    frequency       VARCHAR(64)  NOT NULL DEFAULT '',
+    client_ip       VARCHAR(64)  NOT NULL DEFAULT '',
+    user_code       VARCHAR(64)  NOT NULL DEFAULT '',
+    user_name       VARCHAR(64)  NOT NULL DEFAULT '',
+    real_name       VARCHAR(64)  NOT NULL DEFAULT '',
+    agent_type      VARCHAR(32)  NOT NULL DEFAULT '',
+    remark          VARCHAR(256) NOT NULL DEFAULT '',
+    cron            VARCHAR(128) NOT NULL DEFAULT '',
+    run_at          TIMESTAMPTZ,
+    misfire         VARCHAR(16)  NOT NULL DEFAULT 'skip',
+    status          VARCHAR(16)  NOT NULL,
+    next_run_at     TIMESTAMPTZ,
+    last_run_at     TIMESTAMPTZ,
+    last_command_id BIGINT       NOT NULL DEFAULT 0,
+    last_result     VARCHAR(512) NOT NULL DEFAULT '',
+    run_count       INT          NOT NULL DEFAULT 0,
+    missed_count    INT          NOT NULL DEFAULT 0,
+    created_by      VARCHAR(64)  NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ  NOT NULL,
+    updated_at      TIMESTAMPTZ  NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_control_command_schedule_next ON control_command_schedule (status, next_run_at);